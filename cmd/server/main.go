@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,9 +19,19 @@ import (
 	"url_shortener/internal/config"
 	"url_shortener/internal/db"
 	"url_shortener/internal/handlers"
+	"url_shortener/internal/health"
+	"url_shortener/internal/importer"
 	"url_shortener/internal/logger"
 	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/notify"
+	"url_shortener/internal/preview"
 	"url_shortener/internal/repository"
+	"url_shortener/internal/scheduler"
+	"url_shortener/internal/threatlist"
+	"url_shortener/internal/trash"
+	"url_shortener/internal/unfurl"
+	"url_shortener/internal/urlcheck"
 )
 
 func main() {
@@ -72,16 +83,90 @@ func main() {
 	// Initialize repositories
 	repo := repository.NewShortURLRepository(database)
 	userRepo := repository.NewUserRepository(database)
+	workspaceRepo := repository.NewWorkspaceRepository(database)
+	auditRepo := repository.NewAuditRepository(database)
+	reportRepo := repository.NewReportRepository(database)
+	importRepo := repository.NewImportRepository(database)
+	revisionRepo := repository.NewRevisionRepository(database)
+	groupRepo := repository.NewGroupRepository(database)
+
+	// Initialize notifier used for account emails
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		log.Error("Could not initialize notifier", zap.Error(err))
+		os.Exit(1)
+	}
+
+	// Load threat feeds and reload them when they change
+	threats, err := threatlist.New(cfg.ThreatList)
+	if err != nil {
+		log.Error("Could not load threat feeds", zap.Error(err))
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go threats.Watch(ctx, time.Duration(cfg.ThreatList.ReloadIntervalSeconds)*time.Second)
+
+	// Check link destinations in the background
+	if cfg.HealthCheck.Enabled {
+		client := urlcheck.NewHTTPClient(time.Duration(cfg.HealthCheck.TimeoutSeconds)*time.Second, cfg.URLValidation.AllowPrivateNetworks)
+		go health.NewChecker(repo, client, cfg.HealthCheck).Run(ctx)
+	}
+
+	// Fetch the titles and OpenGraph previews of new destinations
+	if cfg.Preview.Enabled {
+		client := urlcheck.NewHTTPClient(time.Duration(cfg.Preview.TimeoutSeconds)*time.Second, cfg.URLValidation.AllowPrivateNetworks)
+		go preview.NewRefresher(repo, client, cfg.Preview).Run(ctx)
+	}
+
+	// Apply scheduled destination changes when they are due
+	go scheduler.New(revisionRepo, cfg.ScheduledChanges).Run(ctx)
+
+	// Purge deleted links once their retention period has passed
+	go trash.New(repo, cfg.Trash).Run(ctx)
+
+	// Imports run in memory, so jobs cut short by the last shutdown can't resume
+	if n, err := importRepo.FailInterrupted(); err != nil {
+		log.Error("Could not fail interrupted import jobs", zap.Error(err))
+	} else if n > 0 {
+		log.Warn("Failed import jobs interrupted by the last shutdown", zap.Int64("jobs", n))
+	}
 
 	// Initialize rate limiter
-	rateLimiter := middleware.NewRateLimiterStore(100, 200) // 100 requests per second, burst of 200
+	rateLimiter := middleware.NewRateLimiterStore(100, 200)  // 100 requests per second, burst of 200
+	authRateLimiter := middleware.NewRateLimiterStore(1, 10) // 1 request per second, burst of 10
+	reportRateLimiter := middleware.NewRateLimiterStore(float64(cfg.Abuse.ReportsPerHour)/3600, float64(cfg.Abuse.ReportsPerHour))
 
 	// Initialize handlers
-	shortURLHandler := handlers.NewShortURLHandler(repo, redisCache)
-	authHandler := handlers.NewAuthHandler(userRepo, cfg.JWT.Secret)
+	urlValidator := urlcheck.New(cfg.URLValidation, nil)
+	redirectChecker := urlcheck.NewRedirectChecker(cfg.RedirectCheck, nil, urlValidator)
+	homographs := urlcheck.NewHomographDetector(cfg.Homograph)
+	var unfurlers *unfurl.Detector
+	if cfg.Unfurl.Enabled {
+		unfurlers = unfurl.NewDetector(cfg.Unfurl.UserAgents)
+	}
+	shortURLHandler := handlers.NewShortURLHandler(repo, workspaceRepo, revisionRepo, redisCache, urlValidator, redirectChecker, homographs, threats, unfurlers, cfg.Canonicalization, cfg.Batch)
+	tagHandler := handlers.NewGroupHandler(models.GroupTag, groupRepo, repo, workspaceRepo)
+	collectionHandler := handlers.NewGroupHandler(models.GroupCollection, groupRepo, repo, workspaceRepo)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceRepo, notifier, cfg.Workspace)
+	auditHandler := handlers.NewAuditHandler(auditRepo)
+	reportHandler := handlers.NewReportHandler(reportRepo, cfg.Abuse)
+	importExportHandler := handlers.NewImportExportHandler(repo, importRepo, workspaceRepo, importer.New(repo, importRepo, urlValidator, redirectChecker, threats, homographs, cfg.Import), cfg.Canonicalization, cfg.Import)
+	authHandler := handlers.NewAuthHandler(userRepo, auditRepo, cfg.JWT.Secret, notifier, cfg.Auth, cfg.Account)
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error("Invalid server.trusted_proxies", zap.Error(err))
+		os.Exit(1)
+	}
 
 	// Setup router
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.ClientIPMiddleware(trustedProxies))
+	r.Use(middleware.MaxBodyBytesMiddleware(cfg.Server.MaxBodyBytes, map[string]int64{
+		"/api/import": cfg.Import.MaxBodyBytes,
+	}))
 
 	// API Documentation
 	opts := swaggerMiddleware.SwaggerUIOpts{
@@ -96,8 +181,15 @@ func main() {
 	r.Handle("/metrics", promhttp.Handler())
 
 	// Auth routes (no auth required)
-	r.HandleFunc("/auth/signup", authHandler.Signup).Methods("POST")
-	r.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+	auth := r.PathPrefix("/auth").Subrouter()
+	auth.Use(middleware.LoggingMiddleware)
+	auth.Use(middleware.MetricsMiddleware)
+	auth.Use(middleware.RateLimitMiddleware(authRateLimiter))
+	auth.HandleFunc("/signup", authHandler.Signup).Methods("POST")
+	auth.HandleFunc("/login", authHandler.Login).Methods("POST")
+	auth.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods("POST")
+	auth.HandleFunc("/password/reset", authHandler.RequestPasswordReset).Methods("POST")
+	auth.HandleFunc("/password/reset/confirm", authHandler.ConfirmPasswordReset).Methods("POST")
 
 	// Add middleware
 	api := r.PathPrefix("/api").Subrouter()
@@ -106,16 +198,80 @@ func main() {
 	api.Use(middleware.RateLimitMiddleware(rateLimiter))
 	api.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
 
+	// Retries of creating requests with the same Idempotency-Key get the first response
+	idempotent := middleware.IdempotencyMiddleware(redisCache, cfg.Idempotency)
+
 	// Protected routes
-	api.HandleFunc("/shorten", shortURLHandler.CreateShortURL).Methods("POST")
+	api.Handle("/shorten", idempotent(http.HandlerFunc(shortURLHandler.CreateShortURL))).Methods("POST")
+	api.HandleFunc("/shorten", shortURLHandler.ListShortURLs).Methods("GET")
+	api.Handle("/shorten/batch", idempotent(http.HandlerFunc(shortURLHandler.CreateShortURLs))).Methods("POST")
+	api.Handle("/shorten/batch/update", idempotent(http.HandlerFunc(shortURLHandler.UpdateShortURLs))).Methods("POST")
+	api.Handle("/shorten/batch/delete", idempotent(http.HandlerFunc(shortURLHandler.DeleteShortURLs))).Methods("POST")
 	api.HandleFunc("/shorten/{shortCode}", shortURLHandler.GetShortURL).Methods("GET")
 	api.HandleFunc("/shorten/{shortCode}", shortURLHandler.UpdateShortURL).Methods("PUT")
+	api.HandleFunc("/shorten/{shortCode}", shortURLHandler.PatchShortURL).Methods("PATCH")
 	api.HandleFunc("/shorten/{shortCode}", shortURLHandler.DeleteShortURL).Methods("DELETE")
 	api.HandleFunc("/shorten/{shortCode}/stats", shortURLHandler.GetShortURLStats).Methods("GET")
+	api.HandleFunc("/shorten/{shortCode}/history", shortURLHandler.GetShortURLHistory).Methods("GET")
+	api.HandleFunc("/shorten/{shortCode}/rollback/{revision:[0-9]+}", shortURLHandler.RollbackShortURL).Methods("POST")
+	api.HandleFunc("/shorten/{shortCode}/scheduled", shortURLHandler.ScheduleChange).Methods("POST")
+	api.HandleFunc("/shorten/{shortCode}/scheduled", shortURLHandler.ListScheduledChanges).Methods("GET")
+	api.HandleFunc("/shorten/{shortCode}/scheduled/{changeID:[0-9]+}", shortURLHandler.CancelScheduledChange).Methods("DELETE")
+	api.HandleFunc("/search", shortURLHandler.SearchShortURLs).Methods("GET")
+	api.HandleFunc("/trash", shortURLHandler.ListTrash).Methods("GET")
+	api.HandleFunc("/trash/{shortCode}/restore", shortURLHandler.RestoreShortURL).Methods("POST")
+	api.HandleFunc("/tags", tagHandler.ListGroups).Methods("GET")
+	api.HandleFunc("/tags", tagHandler.CreateGroup).Methods("POST")
+	api.HandleFunc("/tags/{groupID:[0-9]+}", tagHandler.GetGroup).Methods("GET")
+	api.HandleFunc("/tags/{groupID:[0-9]+}", tagHandler.UpdateGroup).Methods("PUT")
+	api.HandleFunc("/tags/{groupID:[0-9]+}", tagHandler.DeleteGroup).Methods("DELETE")
+	api.HandleFunc("/tags/{groupID:[0-9]+}/links", tagHandler.AddLinks).Methods("POST")
+	api.HandleFunc("/tags/{groupID:[0-9]+}/links/{shortCode}", tagHandler.RemoveLink).Methods("DELETE")
+	api.HandleFunc("/tags/{groupID:[0-9]+}/stats", tagHandler.GetGroupStats).Methods("GET")
+	api.HandleFunc("/collections", collectionHandler.ListGroups).Methods("GET")
+	api.HandleFunc("/collections", collectionHandler.CreateGroup).Methods("POST")
+	api.HandleFunc("/collections/{groupID:[0-9]+}", collectionHandler.GetGroup).Methods("GET")
+	api.HandleFunc("/collections/{groupID:[0-9]+}", collectionHandler.UpdateGroup).Methods("PUT")
+	api.HandleFunc("/collections/{groupID:[0-9]+}", collectionHandler.DeleteGroup).Methods("DELETE")
+	api.HandleFunc("/collections/{groupID:[0-9]+}/links", collectionHandler.AddLinks).Methods("POST")
+	api.HandleFunc("/collections/{groupID:[0-9]+}/links/{shortCode}", collectionHandler.RemoveLink).Methods("DELETE")
+	api.HandleFunc("/collections/{groupID:[0-9]+}/stats", collectionHandler.GetGroupStats).Methods("GET")
+	api.HandleFunc("/export", importExportHandler.ExportLinks).Methods("GET")
+	api.HandleFunc("/import", importExportHandler.ImportLinks).Methods("POST")
+	api.HandleFunc("/import/{jobID:[0-9]+}", importExportHandler.GetImportJob).Methods("GET")
+	api.HandleFunc("/import/{jobID:[0-9]+}/results", importExportHandler.ListImportResults).Methods("GET")
+	api.HandleFunc("/account/password", authHandler.ChangePassword).Methods("PUT")
+	api.HandleFunc("/account", authHandler.DeleteAccount).Methods("DELETE")
+	api.HandleFunc("/account/2fa/enroll", authHandler.EnrollTOTP).Methods("POST")
+	api.HandleFunc("/account/2fa/confirm", authHandler.ConfirmTOTP).Methods("POST")
+	api.HandleFunc("/account/2fa", authHandler.DisableTOTP).Methods("DELETE")
+	api.HandleFunc("/workspaces", workspaceHandler.CreateWorkspace).Methods("POST")
+	api.HandleFunc("/workspaces", workspaceHandler.ListWorkspaces).Methods("GET")
+	api.HandleFunc("/workspaces/{workspaceID:[0-9]+}/settings", workspaceHandler.UpdateSettings).Methods("PUT")
+	api.HandleFunc("/workspaces/{workspaceID:[0-9]+}/members", workspaceHandler.ListMembers).Methods("GET")
+	api.HandleFunc("/workspaces/{workspaceID:[0-9]+}/members/{userID:[0-9]+}", workspaceHandler.UpdateMember).Methods("PUT")
+	api.HandleFunc("/workspaces/{workspaceID:[0-9]+}/members/{userID:[0-9]+}", workspaceHandler.RemoveMember).Methods("DELETE")
+	api.HandleFunc("/workspaces/{workspaceID:[0-9]+}/invitations", workspaceHandler.InviteMember).Methods("POST")
+	api.HandleFunc("/invitations/accept", workspaceHandler.AcceptInvitation).Methods("POST")
+	api.HandleFunc("/audit", auditHandler.ListOwnEvents).Methods("GET")
+
+	// Admin routes
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminMiddleware(userRepo))
+	admin.HandleFunc("/users/{userID:[0-9]+}/2fa/reset", authHandler.AdminResetTOTP).Methods("POST")
+	admin.HandleFunc("/audit", auditHandler.ListAllEvents).Methods("GET")
+	admin.HandleFunc("/shorten/{shortCode}/flag", shortURLHandler.FlagShortURL).Methods("PUT")
+	admin.HandleFunc("/shorten/{shortCode}/flag", shortURLHandler.UnflagShortURL).Methods("DELETE")
+	admin.HandleFunc("/shorten/{shortCode}/disabled", shortURLHandler.DisableShortURL).Methods("PUT")
+	admin.HandleFunc("/shorten/{shortCode}/disabled", shortURLHandler.EnableShortURL).Methods("DELETE")
+	admin.HandleFunc("/reports", reportHandler.ListReports).Methods("GET")
+	admin.HandleFunc("/reports/{reportID:[0-9]+}/dismiss", reportHandler.DismissReport).Methods("POST")
+	admin.HandleFunc("/reports/{reportID:[0-9]+}/disable", reportHandler.DisableReportedLink).Methods("POST")
 
 	// Redirect route (no auth required)
 	redirectRouter := mux.NewRouter()
 	redirectRouter.HandleFunc("/{shortCode}", shortURLHandler.RedirectToOriginalURL).Methods("GET")
+	redirectRouter.Handle("/{shortCode}/report", middleware.RateLimitMiddleware(reportRateLimiter)(http.HandlerFunc(reportHandler.ReportShortURL))).Methods("POST")
 	r.PathPrefix("/").Handler(redirectRouter)
 
 	// Create server with timeouts
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"url_shortener/internal/models"
@@ -78,6 +79,57 @@ func (c *RedisCache) GetAccessCount(shortCode string) (int64, error) {
 	return c.client.Get(c.ctx, "count:"+shortCode).Int64()
 }
 
+// ReserveIdempotencyKey stores rec under key unless the key is already used,
+// in which case the stored record is returned instead. Only one of several
+// concurrent requests with the same key gets nil.
+func (c *RedisCache) ReserveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key may expire between SETNX and GET, so try again once
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := c.client.SetNX(c.ctx, "idem:"+key, data, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+
+		val, err := c.client.Get(c.ctx, "idem:"+key).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var existing models.IdempotencyRecord
+		if err := json.Unmarshal(val, &existing); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	return nil, errors.New("idempotency key changed during reservation")
+}
+
+// SaveIdempotencyKey replaces the record of a reserved key
+func (c *RedisCache) SaveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return c.client.Set(c.ctx, "idem:"+key, data, ttl).Err()
+}
+
+// ReleaseIdempotencyKey removes a reserved key so the request can be retried
+func (c *RedisCache) ReleaseIdempotencyKey(key string) error {
+	return c.client.Del(c.ctx, "idem:"+key).Err()
+}
+
 // Close closes the Redis connection
 func (c *RedisCache) Close() error {
 	return c.client.Close()
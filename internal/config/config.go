@@ -5,14 +5,40 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	JWT      JWTConfig     `mapstructure:"jwt"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Account   AccountConfig   `mapstructure:"account"`
+	Notifier  NotifierConfig  `mapstructure:"notifier"`
+	Workspace WorkspaceConfig `mapstructure:"workspace"`
+
+	URLValidation URLValidationConfig `mapstructure:"url_validation"`
+	ThreatList    ThreatListConfig    `mapstructure:"threat_list"`
+
+	Canonicalization CanonicalizationConfig `mapstructure:"canonicalization"`
+	RedirectCheck    RedirectCheckConfig    `mapstructure:"redirect_check"`
+	Homograph        HomographConfig        `mapstructure:"homograph"`
+	HealthCheck      HealthCheckConfig      `mapstructure:"health_check"`
+	Abuse            AbuseConfig            `mapstructure:"abuse"`
+	Batch            BatchConfig            `mapstructure:"batch"`
+	Import           ImportConfig           `mapstructure:"import"`
+	Idempotency      IdempotencyConfig      `mapstructure:"idempotency"`
+	ScheduledChanges ScheduledChangesConfig `mapstructure:"scheduled_changes"`
+	Trash            TrashConfig            `mapstructure:"trash"`
+	Preview          PreviewConfig          `mapstructure:"preview"`
+	Unfurl           UnfurlConfig           `mapstructure:"unfurl"`
 }
 
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
 	Mode string `mapstructure:"mode"` // development or production
+	// MaxBodyBytes limits the size of request bodies
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// in front of the service. X-Forwarded-For is ignored unless the request
+	// came through one of them.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -20,10 +46,167 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string `mapstructure:"secret"`
+	Secret      string `mapstructure:"secret"`
 	ExpiryHours int    `mapstructure:"expiry_hours"`
 }
 
+type AuthConfig struct {
+	PasswordMinLength     int    `mapstructure:"password_min_length"`
+	PasswordRequireDigit  bool   `mapstructure:"password_require_digit"`
+	PasswordRequireLetter bool   `mapstructure:"password_require_letter"`
+	ResetTokenTTLMinutes  int    `mapstructure:"reset_token_ttl_minutes"`
+	ResetURL              string `mapstructure:"reset_url"` // optional, the token is appended as ?token=
+	TOTPIssuer            string `mapstructure:"totp_issuer"`
+
+	LoginThrottle LoginThrottleConfig `mapstructure:"login_throttle"`
+}
+
+type LoginThrottleConfig struct {
+	FreeAttempts         int `mapstructure:"free_attempts"`
+	BaseDelaySeconds     int `mapstructure:"base_delay_seconds"`
+	MaxDelaySeconds      int `mapstructure:"max_delay_seconds"`
+	UserLockoutThreshold int `mapstructure:"user_lockout_threshold"`
+	IPLockoutThreshold   int `mapstructure:"ip_lockout_threshold"`
+	LockoutMinutes       int `mapstructure:"lockout_minutes"`
+}
+
+type AccountConfig struct {
+	// LinkDeletionPolicy controls what happens to a user's short URLs when
+	// the account is deleted: "delete" removes them, "retain" keeps them
+	// active without an owner.
+	LinkDeletionPolicy string `mapstructure:"link_deletion_policy"`
+}
+
+type WorkspaceConfig struct {
+	InvitationTTLHours int    `mapstructure:"invitation_ttl_hours"`
+	InvitationURL      string `mapstructure:"invitation_url"` // optional, the token is appended as ?token=
+}
+
+type URLValidationConfig struct {
+	// AllowPrivateNetworks permits destinations on loopback and private
+	// networks, e.g. for local development
+	AllowPrivateNetworks bool     `mapstructure:"allow_private_networks"`
+	AllowedDomains       []string `mapstructure:"allowed_domains"` // trusted, skip the private network checks
+	DeniedDomains        []string `mapstructure:"denied_domains"`  // always rejected, including subdomains
+	ResolveTimeoutMillis int      `mapstructure:"resolve_timeout_ms"`
+}
+
+type CanonicalizationConfig struct {
+	// StripTrackingParams removes TrackingParams from the destinations of
+	// personal links. Workspaces have their own setting.
+	StripTrackingParams bool     `mapstructure:"strip_tracking_params"`
+	TrackingParams      []string `mapstructure:"tracking_params"` // a trailing * matches a prefix
+}
+
+type RedirectCheckConfig struct {
+	OwnDomains      []string `mapstructure:"own_domains"`      // domains this service is reachable on
+	KnownShorteners []string `mapstructure:"known_shorteners"` // followed to find the real destination
+	MaxRedirects    int      `mapstructure:"max_redirects"`
+	TimeoutSeconds  int      `mapstructure:"timeout_seconds"`
+}
+
+type HomographConfig struct {
+	// Action is what happens to links whose host mixes scripts or imitates a
+	// protected brand: "reject" or "flag" (a warning page is shown)
+	Action          string   `mapstructure:"action"`
+	ProtectedBrands []string `mapstructure:"protected_brands"`
+}
+
+type AbuseConfig struct {
+	ReportsPerHour       int `mapstructure:"reports_per_hour"`       // per IP
+	AutoSuspendThreshold int `mapstructure:"auto_suspend_threshold"` // open reports from distinct IPs; 0 disables
+}
+
+type BatchConfig struct {
+	MaxItems            int `mapstructure:"max_items"`             // per batch request
+	ChunkSize           int `mapstructure:"chunk_size"`            // items written per transaction
+	Concurrency         int `mapstructure:"concurrency"`           // items whose URLs are checked at once
+	CheckTimeoutSeconds int `mapstructure:"check_timeout_seconds"` // for the URL checks of all items
+}
+
+type ImportConfig struct {
+	MaxBodyBytes         int64 `mapstructure:"max_body_bytes"` // replaces server.max_body_bytes for uploads
+	MaxRows              int   `mapstructure:"max_rows"`
+	ChunkSize            int   `mapstructure:"chunk_size"` // rows written per transaction
+	MaxConcurrentJobs    int   `mapstructure:"max_concurrent_jobs"`
+	UploadTimeoutSeconds int   `mapstructure:"upload_timeout_seconds"`
+}
+
+type IdempotencyConfig struct {
+	TTLHours         int `mapstructure:"ttl_hours"`          // how long responses are replayed
+	LockSeconds      int `mapstructure:"lock_seconds"`       // how long a key stays reserved by a request that never finishes
+	MaxResponseBytes int `mapstructure:"max_response_bytes"` // larger responses aren't stored
+}
+
+type ScheduledChangesConfig struct {
+	IntervalSeconds int `mapstructure:"interval_seconds"` // how often due changes are looked for
+	BatchSize       int `mapstructure:"batch_size"`
+}
+
+// TrashConfig controls how long deleted links are kept for restoring and how
+// long their short codes can't be reused
+type TrashConfig struct {
+	RetentionDays        int `mapstructure:"retention_days"`  // until deleted links are purged
+	QuarantineDays       int `mapstructure:"quarantine_days"` // from deletion until the code is free again
+	PurgeIntervalMinutes int `mapstructure:"purge_interval_minutes"`
+	BatchSize            int `mapstructure:"batch_size"`
+}
+
+// PreviewConfig controls fetching the title, OpenGraph data and favicon of
+// link destinations
+type PreviewConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	IntervalSeconds int    `mapstructure:"interval_seconds"` // between looks for links without a preview
+	Concurrency     int    `mapstructure:"concurrency"`
+	BatchSize       int    `mapstructure:"batch_size"`
+	TimeoutSeconds  int    `mapstructure:"timeout_seconds"`
+	MaxBytes        int64  `mapstructure:"max_bytes"` // of a page that are read
+	MaxRedirects    int    `mapstructure:"max_redirects"`
+	UserAgent       string `mapstructure:"user_agent"`
+}
+
+// UnfurlConfig controls the preview page served to the bots of chats and
+// social networks instead of a redirect
+type UnfurlConfig struct {
+	Enabled    bool     `mapstructure:"enabled"`
+	UserAgents []string `mapstructure:"user_agents"` // User-Agent substrings, ignoring case
+}
+
+type HealthCheckConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	IntervalMinutes  int  `mapstructure:"interval_minutes"`
+	Concurrency      int  `mapstructure:"concurrency"`
+	HostDelayMillis  int  `mapstructure:"host_delay_ms"` // minimum time between requests to one host
+	TimeoutSeconds   int  `mapstructure:"timeout_seconds"`
+	FailureThreshold int  `mapstructure:"failure_threshold"` // failed checks in a row before a link is broken
+	BatchSize        int  `mapstructure:"batch_size"`
+}
+
+type ThreatListConfig struct {
+	Feeds                 []ThreatFeedConfig `mapstructure:"feeds"`
+	ReloadIntervalSeconds int                `mapstructure:"reload_interval_seconds"`
+}
+
+type ThreatFeedConfig struct {
+	Name   string `mapstructure:"name"` // reported on matches, e.g. malware or phishing
+	Path   string `mapstructure:"path"`
+	Format string `mapstructure:"format"` // hosts or hashprefix
+}
+
+type NotifierConfig struct {
+	Type     string     `mapstructure:"type"` // log, file or smtp
+	FilePath string     `mapstructure:"file_path"`
+	SMTP     SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -33,9 +216,73 @@ func LoadConfig() (*Config, error) {
 	// Set defaults
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.mode", "development")
+	viper.SetDefault("server.max_body_bytes", 1<<20)
 	viper.SetDefault("database.dsn", "root@tcp(127.0.0.1:3306)/url_shortener?parseTime=true")
 	viper.SetDefault("jwt.secret", "your-secret-key")
 	viper.SetDefault("jwt.expiry_hours", 24)
+	viper.SetDefault("auth.password_min_length", 8)
+	viper.SetDefault("auth.password_require_digit", true)
+	viper.SetDefault("auth.password_require_letter", true)
+	viper.SetDefault("auth.reset_token_ttl_minutes", 30)
+	viper.SetDefault("auth.totp_issuer", "URL Shortener")
+	viper.SetDefault("auth.login_throttle.free_attempts", 3)
+	viper.SetDefault("auth.login_throttle.base_delay_seconds", 1)
+	viper.SetDefault("auth.login_throttle.max_delay_seconds", 300)
+	viper.SetDefault("auth.login_throttle.user_lockout_threshold", 10)
+	viper.SetDefault("auth.login_throttle.ip_lockout_threshold", 50)
+	viper.SetDefault("auth.login_throttle.lockout_minutes", 15)
+	viper.SetDefault("account.link_deletion_policy", "delete")
+	viper.SetDefault("workspace.invitation_ttl_hours", 72)
+	viper.SetDefault("url_validation.allow_private_networks", false)
+	viper.SetDefault("url_validation.resolve_timeout_ms", 2000)
+	viper.SetDefault("redirect_check.known_shorteners", []string{"bit.ly", "bitly.com", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd", "v.gd", "buff.ly", "rebrand.ly", "cutt.ly", "tiny.cc", "shorturl.at", "rb.gy", "t.ly", "lnkd.in"})
+	viper.SetDefault("redirect_check.max_redirects", 5)
+	viper.SetDefault("redirect_check.timeout_seconds", 5)
+	viper.SetDefault("homograph.action", "flag")
+	viper.SetDefault("homograph.protected_brands", []string{"apple", "amazon", "google", "microsoft", "paypal", "facebook", "instagram", "netflix", "github"})
+	viper.SetDefault("abuse.reports_per_hour", 10)
+	viper.SetDefault("abuse.auto_suspend_threshold", 5)
+	viper.SetDefault("batch.max_items", 1000)
+	viper.SetDefault("batch.chunk_size", 100)
+	viper.SetDefault("batch.concurrency", 8)
+	viper.SetDefault("batch.check_timeout_seconds", 10)
+	viper.SetDefault("import.max_body_bytes", 64<<20)
+	viper.SetDefault("import.max_rows", 250000)
+	viper.SetDefault("import.chunk_size", 500)
+	viper.SetDefault("import.max_concurrent_jobs", 2)
+	viper.SetDefault("import.upload_timeout_seconds", 300)
+	viper.SetDefault("idempotency.ttl_hours", 24)
+	viper.SetDefault("idempotency.lock_seconds", 60)
+	viper.SetDefault("idempotency.max_response_bytes", 1<<20)
+	viper.SetDefault("scheduled_changes.interval_seconds", 30)
+	viper.SetDefault("scheduled_changes.batch_size", 100)
+	viper.SetDefault("trash.retention_days", 30)
+	viper.SetDefault("trash.quarantine_days", 180)
+	viper.SetDefault("trash.purge_interval_minutes", 60)
+	viper.SetDefault("trash.batch_size", 500)
+	viper.SetDefault("preview.enabled", true)
+	viper.SetDefault("preview.interval_seconds", 15)
+	viper.SetDefault("preview.concurrency", 4)
+	viper.SetDefault("preview.batch_size", 50)
+	viper.SetDefault("preview.timeout_seconds", 5)
+	viper.SetDefault("preview.max_bytes", 524288)
+	viper.SetDefault("preview.max_redirects", 5)
+	viper.SetDefault("preview.user_agent", "url-shortener-preview/1.0")
+	viper.SetDefault("unfurl.enabled", true)
+	viper.SetDefault("unfurl.user_agents", []string{"facebookexternalhit", "Twitterbot", "Slackbot-LinkExpanding", "LinkedInBot", "Discordbot", "WhatsApp", "TelegramBot", "Pinterestbot", "redditbot", "SkypeUriPreview", "vkShare", "Embedly", "Iframely", "Mastodon", "Cardyb"})
+	viper.SetDefault("health_check.enabled", true)
+	viper.SetDefault("health_check.interval_minutes", 60)
+	viper.SetDefault("health_check.concurrency", 4)
+	viper.SetDefault("health_check.host_delay_ms", 1000)
+	viper.SetDefault("health_check.timeout_seconds", 10)
+	viper.SetDefault("health_check.failure_threshold", 2)
+	viper.SetDefault("health_check.batch_size", 500)
+	viper.SetDefault("threat_list.reload_interval_seconds", 60)
+	viper.SetDefault("canonicalization.strip_tracking_params", false)
+	viper.SetDefault("canonicalization.tracking_params", []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "yclid", "igshid", "_hsenc", "_hsmi"})
+	viper.SetDefault("notifier.type", "log")
+	viper.SetDefault("notifier.file_path", "notifications.log")
+	viper.SetDefault("notifier.smtp.port", 587)
 
 	// Environment variables override
 	viper.AutomaticEnv()
@@ -53,4 +300,4 @@ func LoadConfig() (*Config, error) {
 	}
 
 	return &config, nil
-} 
\ No newline at end of file
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 	_ "github.com/go-sql-driver/mysql"
 	"go.uber.org/zap"
@@ -75,6 +76,200 @@ func createSchema(db *sql.DB) error {
 			INDEX idx_short_code (short_code),
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			code_hash CHAR(64) NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_user_code (user_id, code_hash),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS workspaces (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			created_by INT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id INT NOT NULL,
+			user_id INT NOT NULL,
+			role ENUM('owner', 'editor', 'viewer') NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (workspace_id, user_id),
+			INDEX idx_user (user_id),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS workspace_invitations (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			workspace_id INT NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			role ENUM('owner', 'editor', 'viewer') NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			invited_by INT,
+			expires_at TIMESTAMP NOT NULL,
+			accepted_at TIMESTAMP NULL,
+			accepted_by INT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+			FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		// Append-only, rows are never updated or deleted. actor_id has no
+		// foreign key so history survives account deletion.
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			actor_id INT NULL,
+			action VARCHAR(50) NOT NULL,
+			target_type VARCHAR(30) NOT NULL,
+			target_id VARCHAR(100) NOT NULL,
+			before_value JSON NULL,
+			after_value JSON NULL,
+			ip VARCHAR(45) NULL,
+			user_agent VARCHAR(255) NULL,
+			request_id VARCHAR(64) NULL,
+			created_at TIMESTAMP(3) NOT NULL,
+			INDEX idx_actor (actor_id, id),
+			INDEX idx_target (target_type, target_id, id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+		`CREATE TABLE IF NOT EXISTS link_reports (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			reason ENUM('malware', 'phishing', 'spam', 'illegal', 'other') NOT NULL,
+			details TEXT NULL,
+			reporter_ip VARCHAR(45) NOT NULL,
+			reporter_network VARCHAR(49) NULL,
+			status ENUM('open', 'dismissed', 'actioned') NOT NULL DEFAULT 'open',
+			reviewed_by INT NULL,
+			reviewed_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE,
+			FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_status (status, id),
+			INDEX idx_short_url_status (short_url_id, status)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS import_jobs (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			workspace_id INT NULL,
+			format VARCHAR(10) NOT NULL,
+			on_conflict VARCHAR(10) NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			total_rows INT NOT NULL,
+			processed_rows INT NOT NULL DEFAULT 0,
+			created_rows INT NOT NULL DEFAULT 0,
+			failed_rows INT NOT NULL DEFAULT 0,
+			error VARCHAR(255) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP NULL,
+			INDEX idx_status (status),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS import_job_results (
+			job_id INT NOT NULL,
+			line INT NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			short_code VARCHAR(10) NULL,
+			requested_code VARCHAR(255) NULL,
+			error VARCHAR(255) NULL,
+			PRIMARY KEY (job_id, line),
+			INDEX idx_job_status (job_id, status, line),
+			FOREIGN KEY (job_id) REFERENCES import_jobs(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		// author_id has no foreign key so history survives account deletion
+		`CREATE TABLE IF NOT EXISTS short_url_revisions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			version INT NOT NULL,
+			source VARCHAR(10) NOT NULL,
+			original_url TEXT NOT NULL,
+			fallback_url TEXT NULL,
+			expires_at TIMESTAMP NULL,
+			author_id INT NULL,
+			created_at TIMESTAMP NOT NULL,
+			INDEX idx_short_url (short_url_id, id),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS scheduled_changes (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			short_url_id INT NOT NULL,
+			url TEXT NOT NULL,
+			canonical_url_hash CHAR(64) NULL,
+			resolved_url TEXT NULL,
+			unicode_host VARCHAR(255) NULL,
+			flag_reason VARCHAR(255) NULL,
+			activate_at TIMESTAMP NOT NULL,
+			author_id INT NULL,
+			created_at TIMESTAMP NOT NULL,
+			INDEX idx_activate_at (activate_at),
+			INDEX idx_short_url (short_url_id, activate_at),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		// Short codes of purged links that can't be reused yet
+		`CREATE TABLE IF NOT EXISTS quarantined_codes (
+			short_code VARCHAR(10) NOT NULL PRIMARY KEY,
+			released_at TIMESTAMP NOT NULL,
+			INDEX idx_released_at (released_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		// Clicks per link and day, for statistics over time
+		`CREATE TABLE IF NOT EXISTS daily_clicks (
+			short_url_id INT NOT NULL,
+			day DATE NOT NULL,
+			clicks INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (short_url_id, day),
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		// Tags and collections. Names are unique per kind and owner, which is
+		// checked by the repository since MySQL unique keys ignore NULLs.
+		`CREATE TABLE IF NOT EXISTS link_groups (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			kind VARCHAR(10) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			description VARCHAR(500) NULL,
+			user_id INT NULL,
+			workspace_id INT NULL,
+			created_at TIMESTAMP NOT NULL,
+			INDEX idx_user (user_id, kind, name),
+			INDEX idx_workspace (workspace_id, kind, name),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
+
+		`CREATE TABLE IF NOT EXISTS link_group_links (
+			group_id INT NOT NULL,
+			short_url_id INT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (group_id, short_url_id),
+			INDEX idx_short_url (short_url_id),
+			FOREIGN KEY (group_id) REFERENCES link_groups(id) ON DELETE CASCADE,
+			FOREIGN KEY (short_url_id) REFERENCES short_urls(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`,
 	}
 
 	for _, query := range queries {
@@ -83,5 +278,121 @@ func createSchema(db *sql.DB) error {
 		}
 	}
 
+	if err := migrateColumns(db); err != nil {
+		return err
+	}
+	return migrateIndexes(db)
+}
+
+// column describes a column added to a table after its initial release.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addedColumns lists the columns that existing deployments may be missing.
+// MySQL has no ADD COLUMN IF NOT EXISTS, so each one is checked against
+// information_schema before being added.
+var addedColumns = []column{
+	{"users", "email", "VARCHAR(255) NULL"},
+	{"users", "is_admin", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"users", "totp_secret", "VARCHAR(64) NULL"},
+	{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"users", "totp_last_step", "BIGINT NOT NULL DEFAULT 0"},
+	{"short_urls", "workspace_id", "INT NULL, ADD INDEX idx_workspace (workspace_id), ADD FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE"},
+	{"short_urls", "flag_reason", "VARCHAR(255) NULL"},
+	{"short_urls", "canonical_url_hash", "CHAR(64) NULL, ADD INDEX idx_canonical_url_hash (canonical_url_hash)"},
+	{"short_urls", "resolved_url", "TEXT NULL"},
+	{"short_urls", "unicode_host", "VARCHAR(255) NULL"},
+	{"short_urls", "fallback_url", "TEXT NULL"},
+	{"short_urls", "health_status", "VARCHAR(10) NOT NULL DEFAULT 'unknown', ADD INDEX idx_health_status (health_status)"},
+	{"short_urls", "last_status_code", "SMALLINT NULL"},
+	{"short_urls", "last_latency_ms", "INT NULL"},
+	{"short_urls", "last_checked_at", "TIMESTAMP NULL"},
+	{"short_urls", "health_failures", "INT NOT NULL DEFAULT 0"},
+	{"short_urls", "disabled_at", "TIMESTAMP NULL"},
+	{"short_urls", "disabled_reason", "VARCHAR(20) NULL"},
+	{"short_urls", "expires_at", "TIMESTAMP NULL"},
+	{"short_urls", "version", "INT NOT NULL DEFAULT 1"},
+	{"short_urls", "deleted_at", "TIMESTAMP NULL, ADD INDEX idx_deleted_at (deleted_at)"},
+	{"short_urls", "title", "VARCHAR(255) NULL"},
+	{"short_urls", "description", "VARCHAR(1000) NULL"},
+	{"short_urls", "notes", "TEXT NULL"},
+	{"short_urls", "preview_title", "VARCHAR(255) NULL"},
+	{"short_urls", "preview_description", "VARCHAR(1000) NULL"},
+	{"short_urls", "preview_image_url", "TEXT NULL"},
+	{"short_urls", "preview_site_name", "VARCHAR(255) NULL"},
+	{"short_urls", "favicon_url", "TEXT NULL"},
+	{"short_urls", "preview_fetched_at", "TIMESTAMP NULL, ADD INDEX idx_preview_fetched_at (preview_fetched_at)"},
+	{"short_urls", "og_title", "VARCHAR(255) NULL"},
+	{"short_urls", "og_description", "VARCHAR(1000) NULL"},
+	{"short_urls", "og_image_url", "TEXT NULL"},
+	{"short_urls", "owner_deleted_at", "TIMESTAMP NULL"},
+	{"workspaces", "strip_tracking_params", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"link_reports", "reporter_network", "VARCHAR(49) NULL"},
+}
+
+// migrateColumns adds any missing columns from addedColumns.
+func migrateColumns(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var count int
+		err := db.QueryRow(`
+			SELECT COUNT(*)
+			FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+		`, c.table, c.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// index describes an index added to a table after its initial release.
+type index struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addedIndexes lists the indexes that existing deployments may be missing.
+var addedIndexes = []index{
+	{"short_urls", "ft_short_urls", "FULLTEXT INDEX ft_short_urls (short_code, original_url)"},
+	{"link_groups", "ft_link_groups", "FULLTEXT INDEX ft_link_groups (name)"},
+	{"short_urls", "ft_short_urls_text", "FULLTEXT INDEX ft_short_urls_text (title, description, notes, preview_title)"},
+}
+
+// migrateIndexes adds any missing indexes from addedIndexes.
+func migrateIndexes(db *sql.DB) error {
+	for _, i := range addedIndexes {
+		var count int
+		err := db.QueryRow(`
+			SELECT COUNT(*)
+			FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?
+		`, i.table, i.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD %s", i.table, i.definition)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+)
+
+// auditContext describes the user and request responsible for a change
+func auditContext(r *http.Request) models.AuditContext {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	return models.AuditContext{
+		ActorID:   userID,
+		IP:        middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	}
+}
+
+// AuditHandler serves the audit log.
+type AuditHandler struct {
+	repo repository.AuditRepository
+}
+
+// NewAuditHandler returns a new AuditHandler instance.
+func NewAuditHandler(repo repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{repo: repo}
+}
+
+// ListOwnEvents - GET /audit
+//
+// Lists the events performed by the current user.
+func (h *AuditHandler) ListOwnEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	filter, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.ActorID = userID
+
+	h.writeEvents(w, r, filter)
+}
+
+// ListAllEvents - GET /admin/audit
+//
+// Lists all events, optionally filtered by actorId, action, targetType and targetId.
+func (h *AuditHandler) ListAllEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	if v := r.URL.Query().Get("actorId"); v != "" {
+		actorID, err := strconv.Atoi(v)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid actorId")
+			return
+		}
+		filter.ActorID = actorID
+	}
+
+	h.writeEvents(w, r, filter)
+}
+
+func (h *AuditHandler) writeEvents(w http.ResponseWriter, r *http.Request, filter repository.AuditFilter) {
+	events, err := h.repo.List(filter)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list audit events", err)
+		return
+	}
+
+	// The ID of the last event is the cursor for the next page
+	var nextCursor int64
+	if len(events) > 0 && len(events) == filter.Limit {
+		nextCursor = events[len(events)-1].ID
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Events     []*models.AuditEvent `json:"events"`
+		NextCursor int64                `json:"nextCursor,omitempty"`
+	}{events, nextCursor})
+}
+
+// parseAuditFilter reads the common listing parameters
+func parseAuditFilter(w http.ResponseWriter, r *http.Request) (repository.AuditFilter, bool) {
+	query := r.URL.Query()
+	filter := repository.AuditFilter{
+		Action:     models.AuditAction(query.Get("action")),
+		TargetType: query.Get("targetType"),
+		TargetID:   query.Get("targetId"),
+		Limit:      50,
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 100 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 100")
+			return filter, false
+		}
+		filter.Limit = limit
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor")
+			return filter, false
+		}
+		filter.BeforeID = cursor
+	}
+
+	return filter, true
+}
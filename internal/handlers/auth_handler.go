@@ -2,64 +2,124 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 
+	"url_shortener/internal/config"
 	"url_shortener/internal/logger"
+	"url_shortener/internal/metrics"
+	"url_shortener/internal/middleware"
 	"url_shortener/internal/models"
+	"url_shortener/internal/notify"
+	"url_shortener/internal/problem"
 	"url_shortener/internal/repository"
+	"url_shortener/internal/utils"
 )
 
 type AuthHandler struct {
-	userRepo repository.UserRepository
-	jwtSecret string
+	userRepo       repository.UserRepository
+	auditRepo      repository.AuditRepository
+	jwtSecret      string
+	notifier       notify.Notifier
+	passwordPolicy models.PasswordPolicy
+	resetTokenTTL  time.Duration
+	resetURL       string
+	deleteLinks    bool
+	userThrottle   *middleware.LoginThrottler
+	ipThrottle     *middleware.LoginThrottler
+	dummyHash      []byte
+	totpIssuer     string
 }
 
-func NewAuthHandler(userRepo repository.UserRepository, jwtSecret string) *AuthHandler {
+func NewAuthHandler(userRepo repository.UserRepository, auditRepo repository.AuditRepository, jwtSecret string, notifier notify.Notifier, authCfg config.AuthConfig, accountCfg config.AccountConfig) *AuthHandler {
+	resetTokenTTL := time.Duration(authCfg.ResetTokenTTLMinutes) * time.Minute
+	if resetTokenTTL <= 0 {
+		resetTokenTTL = 30 * time.Minute
+	}
+
+	throttle := authCfg.LoginThrottle
+	policy := middleware.LoginThrottlePolicy{
+		FreeAttempts:     throttle.FreeAttempts,
+		BaseDelay:        time.Duration(throttle.BaseDelaySeconds) * time.Second,
+		MaxDelay:         time.Duration(throttle.MaxDelaySeconds) * time.Second,
+		LockoutThreshold: throttle.UserLockoutThreshold,
+		LockoutDuration:  time.Duration(throttle.LockoutMinutes) * time.Minute,
+	}
+	// IPs are often shared (NAT, proxies) so they get a larger allowance
+	ipPolicy := policy
+	ipPolicy.FreeAttempts = throttle.IPLockoutThreshold / 2
+	ipPolicy.LockoutThreshold = throttle.IPLockoutThreshold
+
+	// Compared against when the username doesn't exist so unknown and known
+	// users take the same time to reject
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 	return &AuthHandler{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
 		jwtSecret: jwtSecret,
+		notifier:  notifier,
+		passwordPolicy: models.PasswordPolicy{
+			MinLength:     authCfg.PasswordMinLength,
+			RequireDigit:  authCfg.PasswordRequireDigit,
+			RequireLetter: authCfg.PasswordRequireLetter,
+		},
+		resetTokenTTL: resetTokenTTL,
+		resetURL:      authCfg.ResetURL,
+		deleteLinks:   accountCfg.LinkDeletionPolicy != "retain",
+		userThrottle:  middleware.NewLoginThrottler(policy),
+		ipThrottle:    middleware.NewLoginThrottler(ipPolicy),
+		dummyHash:     dummyHash,
+		totpIssuer:    authCfg.TOTPIssuer,
 	}
 }
 
 func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	var req models.SignupRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(h.passwordPolicy); err != nil {
+		problem.Invalid(w, r, err)
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		logger.GetLogger().Error("Failed to hash password", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to hash password", err)
 		return
 	}
 
 	user := &models.User{
 		Username: req.Username,
+		Email:    req.Email,
 	}
 
-	if err := h.userRepo.Create(user, string(hashedPassword)); err != nil {
+	if err := h.userRepo.Create(user, string(hashedPassword), auditContext(r)); err != nil {
 		if err == repository.ErrUserAlreadyExists {
-			http.Error(w, "Username already exists", http.StatusConflict)
+			problem.Write(w, r, http.StatusConflict, problem.CodeAlreadyExists, "Username already exists")
 			return
 		}
-		logger.GetLogger().Error("Failed to create user", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to create user", err)
 		return
 	}
 
 	// Generate token
 	token, err := h.generateToken(user)
 	if err != nil {
-		logger.GetLogger().Error("Failed to generate token", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to generate token", err)
 		return
 	}
 
@@ -72,32 +132,49 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	userKey := strings.ToLower(strings.TrimSpace(req.Username))
+	if !h.allowLogin(w, r, userKey, ip) {
 		return
 	}
 
 	user, err := h.userRepo.GetByUsername(req.Username)
 	if err == repository.ErrUserNotFound {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		// Spend the same time as a wrong password to not leak which users exist
+		bcrypt.CompareHashAndPassword(h.dummyHash, []byte(req.Password))
+		h.recordLogin(r, models.ActionUserLoginFailed, 0, userKey, "password")
+		h.loginFailed(w, r, userKey, ip)
 		return
 	} else if err != nil {
-		logger.GetLogger().Error("Failed to get user", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.refundLogin(userKey, ip)
+		problem.Internal(w, r, "Failed to get user", err)
 		return
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.recordLogin(r, models.ActionUserLoginFailed, user.ID, user.Username, "password")
+		h.loginFailed(w, r, userKey, ip)
+		return
+	}
+	// The username throttle is only reset once the second factor is verified
+	if user.TOTPEnabled {
+		h.refundLogin(userKey, ip)
+		h.writeMFAChallenge(w, r, user)
 		return
 	}
+	h.userThrottle.Reset(userKey)
+	h.ipThrottle.Refund(ip)
+	h.recordLogin(r, models.ActionUserLogin, user.ID, user.Username, "password")
 
 	// Generate token
 	token, err := h.generateToken(user)
 	if err != nil {
-		logger.GetLogger().Error("Failed to generate token", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to generate token", err)
 		return
 	}
 
@@ -107,12 +184,276 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// allowLogin checks the username and IP throttles, which count the attempt as
+// a failure until refundLogin is called. It writes a 429 response and returns
+// false if the attempt has to wait.
+func (h *AuthHandler) allowLogin(w http.ResponseWriter, r *http.Request, userKey, ip string) bool {
+	retryAfter, locked, ok := h.userThrottle.Allow(userKey)
+	if ok {
+		if retryAfter, locked, ok = h.ipThrottle.Allow(ip); !ok {
+			h.userThrottle.Refund(userKey)
+		}
+	}
+	if ok {
+		return true
+	}
+
+	reason := "throttled"
+	if locked {
+		reason = "locked"
+	}
+	metrics.RecordLoginFailure(reason)
+	logger.GetLogger().Warn("Login attempt rejected by throttle",
+		zap.String("username", userKey),
+		zap.String("ip", ip),
+		zap.String("reason", reason),
+		zap.Duration("retry_after", retryAfter),
+	)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	problem.Write(w, r, http.StatusTooManyRequests, problem.CodeLoginThrottled, "Too many failed login attempts, try again later")
+	return false
+}
+
+// recordLogin writes a login audit event. Failures are only logged since
+// they must not prevent the login response.
+func (h *AuthHandler) recordLogin(r *http.Request, action models.AuditAction, userID int, username, factor string) {
+	ac := auditContext(r)
+	ac.ActorID = userID
+
+	targetID := ""
+	if userID != 0 {
+		targetID = strconv.Itoa(userID)
+	}
+
+	event, err := ac.NewEvent(action, models.TargetUser, targetID, nil, map[string]string{
+		"username": username,
+		"factor":   factor,
+	})
+	if err == nil {
+		err = h.auditRepo.Record(event)
+	}
+	if err != nil {
+		logger.GetLogger().Error("Failed to record login audit event", zap.Error(err))
+	}
+}
+
+// refundLogin takes back an attempt allowed by allowLogin that didn't fail
+func (h *AuthHandler) refundLogin(userKey, ip string) {
+	h.userThrottle.Refund(userKey)
+	h.ipThrottle.Refund(ip)
+}
+
+// loginFailed records a failed attempt and writes the 401 response
+func (h *AuthHandler) loginFailed(w http.ResponseWriter, r *http.Request, userKey, ip string) {
+	metrics.RecordLoginFailure("invalid_credentials")
+
+	if h.userThrottle.Fail(userKey) {
+		metrics.RecordLoginLockout("user")
+		logger.GetLogger().Warn("Username locked after repeated login failures",
+			zap.String("username", userKey),
+			zap.String("ip", ip),
+		)
+	}
+	if h.ipThrottle.Fail(ip) {
+		metrics.RecordLoginLockout("ip")
+		logger.GetLogger().Warn("IP locked after repeated login failures",
+			zap.String("ip", ip),
+		)
+	}
+
+	problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+}
+
+// ChangePassword - PUT /api/account/password
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+
+	if err := h.passwordPolicy.Validate("newPassword", req.NewPassword); err != nil {
+		problem.Invalid(w, r, err)
+		return
+	}
+
+	if err := h.setPassword(user.ID, req.NewPassword, auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to change password", err, zap.Int("user_id", user.ID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestPasswordReset - POST /auth/password/reset
+//
+// The response is the same whether or not the account exists so the endpoint
+// can't be used to enumerate usernames. The token is issued and sent in the
+// background, so the response time doesn't tell either.
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordResetRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	go func(username string) {
+		if err := h.sendResetToken(username); err != nil {
+			logger.GetLogger().Error("Failed to issue password reset token", zap.Error(err))
+		}
+	}(req.Username)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) sendResetToken(username string) error {
+	user, err := h.userRepo.GetByUsername(username)
+	if err == repository.ErrUserNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	to := user.ContactAddress()
+	if to == "" {
+		logger.GetLogger().Warn("Password reset requested for account without contact address",
+			zap.Int("user_id", user.ID))
+		return nil
+	}
+
+	token, err := utils.GenerateSecureToken(utils.DefaultTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(h.resetTokenTTL)
+	if err := h.userRepo.CreatePasswordResetToken(user.ID, utils.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your account %q.\n\n", user.Username)
+	if h.resetURL != "" {
+		body += fmt.Sprintf("Reset your password here: %s?token=%s\n\n", h.resetURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("Your reset token is: %s\n\n", token)
+	}
+	body += fmt.Sprintf("This link expires at %s. If you didn't request it, you can ignore this message.\n",
+		expiresAt.UTC().Format(time.RFC1123))
+
+	return h.notifier.Send(notify.Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+// ConfirmPasswordReset - POST /auth/password/reset/confirm
+func (h *AuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordResetConfirmRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.passwordPolicy.Validate("newPassword", req.NewPassword); err != nil {
+		problem.Invalid(w, r, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		problem.Internal(w, r, "Failed to hash password", err)
+		return
+	}
+
+	_, err = h.userRepo.ResetPassword(utils.HashToken(req.Token), string(hashedPassword), auditContext(r))
+	if err == repository.ErrInvalidResetToken {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAccount - DELETE /api/account
+func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+
+	err := h.userRepo.Delete(user.ID, h.deleteLinks, auditContext(r))
+	var soleOwner *repository.SoleOwnerError
+	if errors.As(err, &soleOwner) {
+		p := problem.New(r, http.StatusConflict, problem.CodeConflict,
+			"You are the only owner of some workspaces; make another member an owner first")
+		p.WorkspaceIDs = soleOwner.WorkspaceIDs
+		p.Write(w)
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to delete account", err, zap.Int("user_id", user.ID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser loads the authenticated user. It writes an error response and
+// returns false if that isn't possible.
+func (h *AuthHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err == repository.ErrUserNotFound {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+		return nil, false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get user", err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *AuthHandler) setPassword(userID int, password string, ac models.AuditContext) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return h.userRepo.UpdatePassword(userID, string(hashedPassword), ac)
+}
+
 func (h *AuthHandler) generateToken(user *models.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
+		"sub":      user.ID,
 		"username": user.Username,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"exp":      time.Now().Add(time.Hour * 24).Unix(),
 	})
 
 	return token.SignedString([]byte(h.jwtSecret))
-} 
\ No newline at end of file
+}
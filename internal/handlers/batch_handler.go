@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"url_shortener/internal/logger"
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+	"url_shortener/internal/utils"
+	"url_shortener/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+// CreateShortURLs - POST /shorten/batch
+//
+// Creates up to batch.max_items links in one request. Items are validated on
+// their own, see checkItems, and written in chunks of batch.chunk_size, one
+// transaction per chunk, so the response reports the outcome of every item.
+func (h *ShortURLHandler) CreateShortURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.BatchCreateRequest
+	if !decodeJSON(w, r, &req) || !h.checkBatchSize(w, r, "items", len(req.Items)) {
+		return
+	}
+
+	if req.WorkspaceID != 0 && !authorizeWorkspace(w, r, h.workspaceRepo, req.WorkspaceID, userID, models.RoleEditor) {
+		return
+	}
+
+	trackingParams, err := trackingParamsFor(h.workspaceRepo, h.canonicalization, req.WorkspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
+		return
+	}
+
+	results := make([]*models.BatchItemResult, len(req.Items))
+	var pending []int
+	shortURLs := make([]*models.ShortURL, len(req.Items))
+	for i, item := range req.Items {
+		if errs := validation.Struct(item); len(errs) > 0 {
+			results[i] = invalidItem(i, "", errs)
+			continue
+		}
+		pending = append(pending, i)
+	}
+	pending = h.checkItems(r, pending, results, func(int) string { return "" }, func(r *http.Request, i int) error {
+		su, err := h.newShortURL(r, userID, req.WorkspaceID, trackingParams, req.Items[i])
+		shortURLs[i] = su
+		return err
+	})
+
+	// Items whose generated code was taken get a new one and another try
+	ac := auditContext(r)
+	for attempt := 1; len(pending) > 0; attempt++ {
+		var retry []int
+		h.inChunks(len(pending), func(start, end int) {
+			chunk := make([]*models.ShortURL, 0, end-start)
+			for _, i := range pending[start:end] {
+				chunk = append(chunk, shortURLs[i])
+			}
+
+			errs, err := h.repo.CreateBatch(chunk, ac)
+			for j, i := range pending[start:end] {
+				su := shortURLs[i]
+				switch {
+				case err != nil:
+					results[i] = failedItem(r, i, su.ShortCode, err)
+				case errs[j] == nil:
+					results[i] = &models.BatchItemResult{Index: i, ShortCode: su.ShortCode, Status: http.StatusCreated, ShortURL: su}
+				case req.Items[i].Alias != "":
+					results[i] = itemError(i, su.ShortCode, http.StatusConflict, problem.CodeAlreadyExists, "Alias is already taken")
+				case attempt == maxCodeAttempts:
+					results[i] = failedItem(r, i, su.ShortCode, errs[j])
+				default:
+					code, err := utils.GenerateSecureShortCode(6)
+					if err != nil {
+						results[i] = failedItem(r, i, su.ShortCode, err)
+						continue
+					}
+					su.ShortCode = code
+					retry = append(retry, i)
+				}
+			}
+		})
+		pending = retry
+	}
+
+	writeBatchResults(w, results)
+}
+
+// UpdateShortURLs - POST /shorten/batch/update
+//
+// Replaces the destination, fallback, expiry, texts and social preview
+// overrides of many links, each item like PUT /shorten/{shortCode}.
+func (h *ShortURLHandler) UpdateShortURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.BatchUpdateRequest
+	if !decodeJSON(w, r, &req) || !h.checkBatchSize(w, r, "items", len(req.Items)) {
+		return
+	}
+
+	codes := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		codes[i] = item.ShortCode
+	}
+	existing, err := h.repo.GetByShortCodes(codes)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get short URLs", err)
+		return
+	}
+
+	// The tracking parameters to strip are looked up once per workspace
+	trackingParams := map[int][]string{}
+	results := make([]*models.BatchItemResult, len(req.Items))
+	var pending []int
+	shortURLs := make([]*models.ShortURL, len(req.Items))
+	for i, item := range req.Items {
+		if errs := validation.Struct(item); len(errs) > 0 {
+			results[i] = invalidItem(i, item.ShortCode, errs)
+			continue
+		}
+		if su := existing[strings.ToLower(item.ShortCode)]; su != nil {
+			if _, ok := trackingParams[su.WorkspaceID]; !ok {
+				params, err := trackingParamsFor(h.workspaceRepo, h.canonicalization, su.WorkspaceID)
+				if err != nil {
+					results[i] = failedItem(r, i, item.ShortCode, err)
+					continue
+				}
+				trackingParams[su.WorkspaceID] = params
+			}
+		}
+		pending = append(pending, i)
+	}
+	codeOf := func(i int) string { return req.Items[i].ShortCode }
+	pending = h.checkItems(r, pending, results, codeOf, func(r *http.Request, i int) error {
+		su := existing[strings.ToLower(req.Items[i].ShortCode)]
+		updated, err := h.updatedShortURL(r, userID, su, trackingParams[workspaceOf(su)], req.Items[i])
+		shortURLs[i] = updated
+		return err
+	})
+
+	ac := auditContext(r)
+	h.inChunks(len(pending), func(start, end int) {
+		chunk := make([]*models.ShortURL, 0, end-start)
+		for _, i := range pending[start:end] {
+			chunk = append(chunk, shortURLs[i])
+		}
+
+		errs, err := h.repo.UpdateBatch(chunk, ac)
+		for j, i := range pending[start:end] {
+			su := shortURLs[i]
+			switch {
+			case err != nil:
+				results[i] = failedItem(r, i, su.ShortCode, err)
+			case errs[j] == repository.ErrVersionMismatch:
+				results[i] = itemError(i, su.ShortCode, http.StatusConflict, problem.CodeConflict, "The link was changed by another request, retry")
+			case errs[j] != nil:
+				results[i] = failedItem(r, i, su.ShortCode, errLinkNotVisible)
+			default:
+				results[i] = &models.BatchItemResult{Index: i, ShortCode: su.ShortCode, Status: http.StatusOK, ShortURL: su}
+			}
+		}
+	})
+
+	writeBatchResults(w, results)
+}
+
+// updatedShortURL checks that the user may edit su and returns a copy of it
+// with the changes of item applied. A nil su is reported as not found.
+func (h *ShortURLHandler) updatedShortURL(r *http.Request, userID int, su *models.ShortURL, trackingParams []string, item models.BatchUpdateItem) (*models.ShortURL, error) {
+	if su == nil {
+		return nil, errLinkNotVisible
+	}
+	if err := h.checkAccess(userID, su, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	if err := validateExpiry(item.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	dest, err := h.resolveDestination(r, item.URL, trackingParams)
+	if err != nil {
+		return nil, err
+	}
+	fallbackURL, err := h.resolveFallback(r, item.FallbackURL)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *su
+	dest.apply(&updated)
+	updated.FallbackURL = fallbackURL
+	updated.ExpiresAt = item.ExpiresAt
+	updated.Title = item.Title
+	updated.Description = item.Description
+	updated.Notes = item.Notes
+	updated.OGTitle = item.OGTitle
+	updated.OGDescription = item.OGDescription
+	updated.OGImageURL = strings.TrimSpace(item.OGImageURL)
+	return &updated, nil
+}
+
+// DeleteShortURLs - POST /shorten/batch/delete
+func (h *ShortURLHandler) DeleteShortURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.BatchDeleteRequest
+	if !decodeJSON(w, r, &req) || !h.checkBatchSize(w, r, "shortCodes", len(req.ShortCodes)) {
+		return
+	}
+
+	existing, err := h.repo.GetByShortCodes(req.ShortCodes)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get short URLs", err)
+		return
+	}
+
+	results := make([]*models.BatchItemResult, len(req.ShortCodes))
+	var pending []int
+	for i, code := range req.ShortCodes {
+		su := existing[strings.ToLower(code)]
+		if su == nil {
+			results[i] = failedItem(r, i, code, errLinkNotVisible)
+			continue
+		}
+		if err := h.checkAccess(userID, su, models.RoleEditor); err != nil {
+			results[i] = failedItem(r, i, code, err)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	ac := auditContext(r)
+	h.inChunks(len(pending), func(start, end int) {
+		chunk := make([]string, 0, end-start)
+		for _, i := range pending[start:end] {
+			chunk = append(chunk, req.ShortCodes[i])
+		}
+
+		errs, err := h.repo.DeleteBatch(chunk, ac)
+		for j, i := range pending[start:end] {
+			code := req.ShortCodes[i]
+			switch {
+			case err != nil:
+				results[i] = failedItem(r, i, code, err)
+			case errs[j] != nil:
+				// Deleted by an earlier duplicate in the batch or a concurrent request
+				results[i] = failedItem(r, i, code, errLinkNotVisible)
+			default:
+				results[i] = &models.BatchItemResult{Index: i, ShortCode: code, Status: http.StatusNoContent}
+			}
+		}
+	})
+
+	writeBatchResults(w, results)
+}
+
+// checkBatchSize writes an error response and returns false if a batch has
+// more than batch.max_items items
+func (h *ShortURLHandler) checkBatchSize(w http.ResponseWriter, r *http.Request, field string, n int) bool {
+	if n > h.batch.MaxItems {
+		problem.Field(w, r, field, fmt.Sprintf("must contain at most %d items", h.batch.MaxItems))
+		return false
+	}
+	return true
+}
+
+// checkItems runs check for the given items, batch.concurrency at a time, and
+// returns those that passed in order. The results of the others are set from
+// their errors like failedItem. The URL checks resolve hosts and follow links
+// of other shorteners, so all of them share a deadline of
+// batch.check_timeout_seconds to answer within the server's write timeout;
+// items not checked by then fail with a 503 and can be sent again.
+func (h *ShortURLHandler) checkItems(r *http.Request, items []int, results []*models.BatchItemResult, codeOf func(i int) string, check func(r *http.Request, i int) error) []int {
+	timeout := time.Duration(h.batch.CheckTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	concurrency := h.batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	errs := make([]error, len(items))
+	timedOut := make([]bool, len(items))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for j, i := range items {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			timedOut[j] = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(j, i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[j] = check(r, i)
+			// A check cut short by the deadline says nothing about the item
+			timedOut[j] = errs[j] != nil && ctx.Err() != nil
+		}(j, i)
+	}
+	wg.Wait()
+
+	var passed []int
+	for j, i := range items {
+		switch {
+		case timedOut[j]:
+			results[i] = itemError(i, codeOf(i), http.StatusServiceUnavailable, problem.CodeTimeout, "The item could not be checked in time, retry it")
+		case errs[j] != nil:
+			results[i] = failedItem(r, i, codeOf(i), errs[j])
+		default:
+			passed = append(passed, i)
+		}
+	}
+	return passed
+}
+
+// workspaceOf returns the workspace of su, 0 for personal links or a nil su
+func workspaceOf(su *models.ShortURL) int {
+	if su == nil {
+		return 0
+	}
+	return su.WorkspaceID
+}
+
+// inChunks calls fn with the bounds of consecutive chunks of n items
+func (h *ShortURLHandler) inChunks(n int, fn func(start, end int)) {
+	size := h.batch.ChunkSize
+	if size <= 0 {
+		size = n
+	}
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		fn(start, end)
+	}
+}
+
+func itemError(index int, shortCode string, status int, code problem.Code, message string) *models.BatchItemResult {
+	return &models.BatchItemResult{
+		Index:     index,
+		ShortCode: shortCode,
+		Status:    status,
+		Error:     &models.BatchItemError{Code: string(code), Message: message},
+	}
+}
+
+func invalidItem(index int, shortCode string, errs []*models.ValidationError) *models.BatchItemResult {
+	result := itemError(index, shortCode, http.StatusBadRequest, problem.CodeValidationFailed, "Validation failed")
+	result.Error.Errors = errs
+	return result
+}
+
+// failedItem reports an error of the URL checks, an access check or the
+// repository as the result of an item. Internal errors are logged with the
+// request ID and hidden from the client.
+func failedItem(r *http.Request, index int, shortCode string, err error) *models.BatchItemResult {
+	switch e := err.(type) {
+	case *models.ValidationError:
+		return invalidItem(index, shortCode, []*models.ValidationError{e})
+	case *accessError:
+		return itemError(index, shortCode, e.status, e.code, e.detail)
+	}
+
+	logger.GetLogger().Error("Batch item failed",
+		zap.Error(err),
+		zap.Int("index", index),
+		zap.String("short_code", shortCode),
+		zap.String("request_id", middleware.RequestIDFromContext(r.Context())),
+	)
+	return itemError(index, shortCode, http.StatusInternalServerError, problem.CodeInternal, "Internal server error")
+}
+
+func writeBatchResults(w http.ResponseWriter, results []*models.BatchItemResult) {
+	resp := models.BatchResponse{Results: results}
+	for _, result := range results {
+		if result.Error == nil {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
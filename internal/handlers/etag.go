@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+)
+
+// etag returns the entity tag of a link: its version, which If-Match is
+// checked against, and a hash of its JSON representation, since clicks,
+// health checks, previews and tags change what's returned without a new
+// version
+func etag(su *models.ShortURL) string {
+	tag := strconv.Itoa(su.Version)
+	if data, err := json.Marshal(su); err == nil {
+		sum := sha256.Sum256(data)
+		tag += "-" + hex.EncodeToString(sum[:8])
+	}
+	return `"` + tag + `"`
+}
+
+// etagVersion returns the version part of an entity tag made by etag. Tags
+// of earlier releases are the quoted version alone.
+func etagVersion(tag string) string {
+	tag = strings.Trim(tag, `"`)
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// etagMatches reports whether a list of entity tags from an If-None-Match
+// header contains tag, using weak comparison. "*" matches any tag.
+func etagMatches(header, tag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch writes a 412 response and returns false if the request has an
+// If-Match header that doesn't match the current version of su. Only the
+// version of the tags is compared, so clicks and health checks since the
+// client read the link don't fail its update.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, su *models.ShortURL) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !versionMatches(ifMatch, su.Version) {
+		writeVersionMismatch(w, r)
+		return false
+	}
+	return true
+}
+
+// versionMatches reports whether a list of entity tags from an If-Match
+// header contains "*" or a strong tag of the given version
+func versionMatches(header string, version int) bool {
+	want := strconv.Itoa(version)
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || (!strings.HasPrefix(v, "W/") && etagVersion(v) == want) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeVersionMismatch answers a request whose write lost against a
+// concurrent change: 412 if the client made it conditional with If-Match,
+// otherwise 409 so the client reads the link again
+func writeVersionMismatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		problem.Write(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "The link was changed since the version in If-Match")
+		return
+	}
+	problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "The link was changed by another request, read it again and retry")
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+)
+
+// GroupHandler handles requests for either tags or collections of links,
+// depending on its kind. Both work the same way.
+type GroupHandler struct {
+	kind          models.GroupKind
+	repo          repository.GroupRepository
+	shortURLs     repository.ShortURLRepository
+	workspaceRepo repository.WorkspaceRepository
+}
+
+// NewGroupHandler returns a new GroupHandler instance for tags or
+// collections.
+func NewGroupHandler(kind models.GroupKind, repo repository.GroupRepository, shortURLs repository.ShortURLRepository, workspaceRepo repository.WorkspaceRepository) *GroupHandler {
+	return &GroupHandler{
+		kind:          kind,
+		repo:          repo,
+		shortURLs:     shortURLs,
+		workspaceRepo: workspaceRepo,
+	}
+}
+
+// noun names the kind in messages
+func (h *GroupHandler) noun() string {
+	if h.kind == models.GroupTag {
+		return "Tag"
+	}
+	return "Collection"
+}
+
+// group loads the tag or collection of the path and checks the current user
+// has at least the given role for it. Groups of a workspace are governed by
+// the membership role, personal ones by ownership. It writes an error
+// response and returns false otherwise.
+func (h *GroupHandler) group(w http.ResponseWriter, r *http.Request, need models.WorkspaceRole) (*models.LinkGroup, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["groupID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+strings.ToLower(h.noun())+" ID")
+		return nil, false
+	}
+
+	group, err := h.repo.Get(h.kind, id)
+	if err == repository.ErrGroupNotFound || (err == nil && group.WorkspaceID == 0 && group.UserID != userID) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, h.noun()+" not found")
+		return nil, false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get "+strings.ToLower(h.noun()), err)
+		return nil, false
+	}
+
+	if group.WorkspaceID != 0 && !authorizeWorkspace(w, r, h.workspaceRepo, group.WorkspaceID, userID, need) {
+		return nil, false
+	}
+	return group, true
+}
+
+// ListGroups - GET /tags or /collections
+func (h *GroupHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var workspaceID int
+	if v := r.URL.Query().Get("workspaceId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid workspaceId")
+			return
+		}
+		if !authorizeWorkspace(w, r, h.workspaceRepo, n, userID, models.RoleViewer) {
+			return
+		}
+		workspaceID = n
+	}
+
+	groups, err := h.repo.List(h.kind, userID, workspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list "+strings.ToLower(h.noun())+"s", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(groups)
+}
+
+// CreateGroup - POST /tags or /collections
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.CreateGroupRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	group := &models.LinkGroup{
+		Kind:        h.kind,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+	}
+	if group.Name == "" {
+		problem.Field(w, r, "name", "is required")
+		return
+	}
+	if req.WorkspaceID != 0 {
+		if !authorizeWorkspace(w, r, h.workspaceRepo, req.WorkspaceID, userID, models.RoleEditor) {
+			return
+		}
+		group.WorkspaceID = req.WorkspaceID
+	} else {
+		group.UserID = userID
+	}
+
+	if err := h.repo.Create(group); err == repository.ErrGroupNameTaken {
+		problem.Write(w, r, http.StatusConflict, problem.CodeAlreadyExists, h.noun()+" name is already taken")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to create "+strings.ToLower(h.noun()), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+// GetGroup - GET /tags/{groupID} or /collections/{groupID}
+func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.group(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(group)
+}
+
+// UpdateGroup - PUT /tags/{groupID} or /collections/{groupID}
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateGroupRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		problem.Field(w, r, "name", "is required")
+		return
+	}
+
+	group, ok := h.group(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+	group.Name = name
+	group.Description = req.Description
+
+	if err := h.repo.Update(group); err == repository.ErrGroupNameTaken {
+		problem.Write(w, r, http.StatusConflict, problem.CodeAlreadyExists, h.noun()+" name is already taken")
+		return
+	} else if err == repository.ErrGroupNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, h.noun()+" not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to update "+strings.ToLower(h.noun()), err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(group)
+}
+
+// DeleteGroup - DELETE /tags/{groupID} or /collections/{groupID}
+//
+// The links of the tag or collection are kept.
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.group(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.Delete(h.kind, group.ID); err != nil && err != repository.ErrGroupNotFound {
+		problem.Internal(w, r, "Failed to delete "+strings.ToLower(h.noun()), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddLinks - POST /tags/{groupID}/links or /collections/{groupID}/links
+//
+// Adds links of the owner of the tag or collection to it. Links already in
+// it are left as they are.
+func (h *GroupHandler) AddLinks(w http.ResponseWriter, r *http.Request) {
+	var req models.GroupLinksRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	group, ok := h.group(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	existing, err := h.shortURLs.GetByShortCodes(req.ShortCodes)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get short URLs", err)
+		return
+	}
+
+	ids := make([]int, 0, len(req.ShortCodes))
+	var unknown []string
+	for _, code := range req.ShortCodes {
+		su := existing[strings.ToLower(code)]
+		if su == nil || !sameOwner(group, su) {
+			unknown = append(unknown, code)
+			continue
+		}
+		ids = append(ids, su.ID)
+	}
+	if len(unknown) > 0 {
+		if len(unknown) > 10 {
+			unknown = append(unknown[:10], "...")
+		}
+		problem.Field(w, r, "shortCodes", "contains links that don't exist or belong to someone else: "+strings.Join(unknown, ", "))
+		return
+	}
+
+	added, err := h.repo.AddLinks(group.ID, ids)
+	if err != nil {
+		problem.Internal(w, r, "Failed to add links", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Added int64 `json:"added"`
+	}{added})
+}
+
+// RemoveLink - DELETE /tags/{groupID}/links/{shortCode} or
+// /collections/{groupID}/links/{shortCode}
+func (h *GroupHandler) RemoveLink(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.group(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	su, err := h.shortURLs.GetByShortCode(mux.Vars(r)["shortCode"])
+	if err == nil {
+		err = h.repo.RemoveLink(group.ID, su.ID)
+	}
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found in the "+strings.ToLower(h.noun()))
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to remove link", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGroupStats - GET /tags/{groupID}/stats or /collections/{groupID}/stats
+//
+// Sums the clicks of the links of a tag or collection, in total and per day
+// for the last ?days= days (30 by default, at most 365).
+func (h *GroupHandler) GetGroupStats(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 365 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+
+	group, ok := h.group(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	stats, err := h.repo.Stats(group.ID, time.Now().AddDate(0, 0, 1-days))
+	if err != nil {
+		problem.Internal(w, r, "Failed to get statistics", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// sameOwner reports whether a link belongs to the owner of a group
+func sameOwner(group *models.LinkGroup, su *models.ShortURL) bool {
+	if group.WorkspaceID != 0 {
+		return su.WorkspaceID == group.WorkspaceID
+	}
+	return su.WorkspaceID == 0 && su.UserID == group.UserID
+}
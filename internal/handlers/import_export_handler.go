@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/importer"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// exportBatchSize is the number of links read from the database at a time
+// while exporting
+const exportBatchSize = 1000
+
+// exportWriteTimeout is the time the client has to receive each batch of an
+// export; it replaces the server's write timeout for exports
+const exportWriteTimeout = 30 * time.Second
+
+// exportColumns is the header of CSV exports. A CSV export can be imported
+// again with the csv format.
+var exportColumns = []string{
+	"short_code", "original_url", "fallback_url", "expires_at", "created_at", "updated_at",
+	"access_count", "health_status", "last_checked_at", "disabled_at", "flag_reason",
+}
+
+// ImportExportHandler moves links in and out of the service in bulk.
+type ImportExportHandler struct {
+	repo             repository.ShortURLRepository
+	importRepo       repository.ImportRepository
+	workspaceRepo    repository.WorkspaceRepository
+	importer         *importer.Importer
+	canonicalization config.CanonicalizationConfig
+	cfg              config.ImportConfig
+}
+
+// NewImportExportHandler returns a new ImportExportHandler instance.
+func NewImportExportHandler(repo repository.ShortURLRepository, importRepo repository.ImportRepository, workspaceRepo repository.WorkspaceRepository, importer *importer.Importer, canonicalization config.CanonicalizationConfig, cfg config.ImportConfig) *ImportExportHandler {
+	return &ImportExportHandler{
+		repo:             repo,
+		importRepo:       importRepo,
+		workspaceRepo:    workspaceRepo,
+		importer:         importer,
+		canonicalization: canonicalization,
+		cfg:              cfg,
+	}
+}
+
+// ExportLinks - GET /export
+//
+// Streams the caller's personal links, or the links of a workspace when the
+// workspaceId query parameter is given, as CSV (the default) or NDJSON with
+// format=ndjson. Links are read in batches, so exports of any size use little
+// memory.
+func (h *ImportExportHandler) ExportLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "format must be csv or ndjson")
+		return
+	}
+
+	filter := repository.ShortURLFilter{UserID: userID, Limit: exportBatchSize}
+	if v := query.Get("workspaceId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid workspaceId")
+			return
+		}
+		if !authorizeWorkspace(w, r, h.workspaceRepo, id, userID, models.RoleViewer) {
+			return
+		}
+		filter.WorkspaceID = id
+	}
+
+	// The first batch is read before anything is written so a failure can
+	// still be reported properly
+	batch, err := h.repo.ListForExport(filter, 0)
+	if err != nil {
+		problem.Internal(w, r, "Failed to export short URLs", err)
+		return
+	}
+
+	filename := "links-" + time.Now().UTC().Format("20060102")
+	contentType := "text/csv; charset=utf-8"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + "." + format}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	cw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	if format == "csv" {
+		cw.Write(exportColumns)
+	}
+
+	for {
+		rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+		for _, su := range batch {
+			if format == "csv" {
+				err = cw.Write(exportRecord(su))
+			} else {
+				err = enc.Encode(su)
+			}
+			if err != nil {
+				// The client went away
+				return
+			}
+		}
+		cw.Flush()
+		rc.Flush()
+
+		if len(batch) < exportBatchSize {
+			return
+		}
+		batch, err = h.repo.ListForExport(filter, batch[len(batch)-1].ID)
+		if err != nil {
+			// The status was sent already; aborting the connection keeps the
+			// client from taking a truncated export for a complete one
+			logger.GetLogger().Error("Failed to export short URLs",
+				zap.Error(err),
+				zap.String("request_id", middleware.RequestIDFromContext(r.Context())),
+			)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+func exportRecord(su *models.ShortURL) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		su.ShortCode,
+		su.OriginalURL,
+		su.FallbackURL,
+		formatTime(su.ExpiresAt),
+		formatTime(&su.CreatedAt),
+		formatTime(&su.UpdatedAt),
+		strconv.Itoa(su.AccessCount),
+		string(su.HealthStatus),
+		formatTime(su.LastCheckedAt),
+		formatTime(su.DisabledAt),
+		su.FlagReason,
+	}
+}
+
+// ImportLinks - POST /import
+//
+// Starts importing the links of the file in the request body. The format is
+// given with the format query parameter (csv, ndjson or bitly) or the
+// Content-Type. Links are created in the caller's workspace given with
+// workspaceId, or as personal links. Short codes of the file are kept when
+// they're free; onConflict=skip fails rows whose code is taken instead of
+// giving them a new one. The job runs in the background; its progress and
+// results are served by GetImportJob and ListImportResults.
+func (h *ImportExportHandler) ImportLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	query := r.URL.Query()
+	format := models.ImportFormat(query.Get("format"))
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = models.ImportCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = models.ImportNDJSON
+		}
+	}
+	if !format.Valid() {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "format must be csv, ndjson or bitly")
+		return
+	}
+
+	onConflict := models.ImportConflict(query.Get("onConflict"))
+	switch onConflict {
+	case "":
+		onConflict = models.ImportConflictGenerate
+	case models.ImportConflictGenerate, models.ImportConflictSkip:
+	default:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "onConflict must be generate or skip")
+		return
+	}
+
+	var workspaceID int
+	if v := query.Get("workspaceId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid workspaceId")
+			return
+		}
+		if !authorizeWorkspace(w, r, h.workspaceRepo, id, userID, models.RoleEditor) {
+			return
+		}
+		workspaceID = id
+	}
+
+	trackingParams, err := trackingParamsFor(h.workspaceRepo, h.canonicalization, workspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
+		return
+	}
+
+	// Large files take longer to upload than the server's read timeout allows
+	http.NewResponseController(w).SetReadDeadline(time.Now().Add(time.Duration(h.cfg.UploadTimeoutSeconds) * time.Second))
+
+	rows, err := importer.Parse(format, r.Body, h.cfg.MaxRows)
+	var maxBytesErr *http.MaxBytesError
+	var parseErr *importer.ParseError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, fmt.Sprintf("File must not be larger than %d bytes", maxBytesErr.Limit))
+		return
+	case errors.As(err, &parseErr):
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Invalid file: "+parseErr.Error())
+		return
+	case err == importer.ErrTooManyRows:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, fmt.Sprintf("File must not have more than %d rows", h.cfg.MaxRows))
+		return
+	case err != nil:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read file")
+		return
+	case len(rows) == 0:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "File has no rows")
+		return
+	}
+
+	job := &models.ImportJob{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Format:      format,
+		OnConflict:  onConflict,
+		TotalRows:   len(rows),
+	}
+	if err := h.importRepo.CreateJob(job); err != nil {
+		problem.Internal(w, r, "Failed to create import job", err)
+		return
+	}
+
+	h.importer.Start(importer.Job{
+		ImportJob:      job,
+		Rows:           rows,
+		TrackingParams: trackingParams,
+		Audit:          auditContext(r),
+	})
+
+	w.Header().Set("Location", "/api/import/"+strconv.Itoa(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetImportJob - GET /import/{jobID}
+func (h *ImportExportHandler) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListImportResults - GET /import/{jobID}/results
+//
+// Lists the results of the rows imported so far in file order. status
+// (created or failed) filters them; limit and cursor page through them.
+func (h *ImportExportHandler) ListImportResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownJob(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.ImportResultFilter{Limit: 100}
+
+	switch status := models.ImportRowStatus(query.Get("status")); status {
+	case "", models.ImportRowCreated, models.ImportRowFailed:
+		filter.Status = status
+	default:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "status must be created or failed")
+		return
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 1000 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 1000")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := strconv.Atoi(v)
+		if err != nil || cursor <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor")
+			return
+		}
+		filter.AfterLine = cursor
+	}
+
+	results, err := h.importRepo.ListResults(job.ID, filter)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list import results", err)
+		return
+	}
+
+	// The line of the last row is the cursor for the next page
+	var nextCursor int
+	if len(results) > 0 && len(results) == filter.Limit {
+		nextCursor = results[len(results)-1].Line
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Results    []*models.ImportRowResult `json:"results"`
+		NextCursor int                       `json:"nextCursor,omitempty"`
+	}{results, nextCursor})
+}
+
+// ownJob loads the job of the request. Jobs of other users are reported as
+// not found. It writes an error response and returns false on failure.
+func (h *ImportExportHandler) ownJob(w http.ResponseWriter, r *http.Request) (*models.ImportJob, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["jobID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid job ID")
+		return nil, false
+	}
+
+	job, err := h.importRepo.GetJob(id)
+	if err == repository.ErrImportJobNotFound || err == nil && job.UserID != userID {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Import job not found")
+		return nil, false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get import job", err)
+		return nil, false
+	}
+
+	return job, true
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: potentially dangerous link</title>
+</head>
+<body>
+<h1>Warning: this link may be dangerous</h1>
+<p>{{.Warning}}</p>
+<p>The short link <code>/{{.ShortCode}}</code> points to <strong>{{.Host}}</strong>:</p>
+<p><code>{{.Destination}}</code></p>
+<p>Visiting it may harm your device or expose your personal information.</p>
+<p><a href="/{{.ShortCode}}?proceed=1" rel="nofollow noreferrer">Continue anyway</a></p>
+</body>
+</html>
+`))
+
+var disabledTemplate = template.Must(template.New("disabled").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+</head>
+<body>
+<h1>This link has been disabled</h1>
+{{if .Legal}}<p>The short link <code>/{{.ShortCode}}</code> is unavailable for legal reasons.</p>
+{{else}}<p>The short link <code>/{{.ShortCode}}</code> was disabled because it violated our terms of use.</p>
+{{end}}</body>
+</html>
+`))
+
+var unfurlTemplate = template.Must(template.New("unfurl").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.Title}}">
+<meta name="twitter:title" content="{{.Title}}">
+{{if .Description}}<meta name="description" content="{{.Description}}">
+<meta property="og:description" content="{{.Description}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{end}}{{if .ImageURL}}<meta property="og:image" content="{{.ImageURL}}">
+<meta name="twitter:image" content="{{.ImageURL}}">
+<meta name="twitter:card" content="summary_large_image">
+{{else}}<meta name="twitter:card" content="summary">
+{{end}}{{if .SiteName}}<meta property="og:site_name" content="{{.SiteName}}">
+{{end}}<meta http-equiv="refresh" content="0; url={{.Destination}}">
+</head>
+<body>
+<p><a href="{{.Destination}}">{{.Destination}}</a></p>
+</body>
+</html>
+`))
+
+// writeDisabledPage serves the page shown instead of redirecting for a
+// disabled link
+func writeDisabledPage(w http.ResponseWriter, su *models.ShortURL, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := disabledTemplate.Execute(w, map[string]interface{}{
+		"ShortCode": su.ShortCode,
+		"Legal":     status == http.StatusUnavailableForLegalReasons,
+	})
+	if err != nil {
+		logger.GetLogger().Error("Failed to render disabled page", zap.Error(err))
+	}
+}
+
+// writeInterstitial serves the warning page shown instead of redirecting to a
+// flagged destination
+func writeInterstitial(w http.ResponseWriter, su *models.ShortURL, warning string) {
+	host := su.OriginalURL
+	if u, err := url.Parse(su.OriginalURL); err == nil {
+		host = u.Hostname()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err := interstitialTemplate.Execute(w, map[string]string{
+		"Warning":     warning,
+		"ShortCode":   su.ShortCode,
+		"Host":        host,
+		"Destination": su.OriginalURL,
+	})
+	if err != nil {
+		logger.GetLogger().Error("Failed to render interstitial", zap.Error(err))
+	}
+}
+
+// writeUnfurlPage serves the page shown to link unfurling bots instead of a
+// redirect: the social preview of su as OpenGraph and Twitter card tags, and
+// a refresh to destination for browsers that get it all the same
+func writeUnfurlPage(w http.ResponseWriter, su *models.ShortURL, destination string) {
+	preview := su.SocialPreview()
+	if preview.Title == "" {
+		preview.Title = destination
+		if u, err := url.Parse(destination); err == nil && u.Hostname() != "" {
+			preview.Title = u.Hostname()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err := unfurlTemplate.Execute(w, map[string]string{
+		"Title":       preview.Title,
+		"Description": preview.Description,
+		"ImageURL":    preview.ImageURL,
+		"SiteName":    preview.SiteName,
+		"Destination": destination,
+	})
+	if err != nil {
+		logger.GetLogger().Error("Failed to render unfurl page", zap.Error(err))
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"url_shortener/internal/logger"
+	"url_shortener/internal/metrics"
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+	"url_shortener/internal/utils"
+)
+
+const (
+	// mfaTokenTTL is how long the user has to enter the second factor
+	mfaTokenTTL = 5 * time.Minute
+
+	// mfaTokenType marks MFA challenge tokens so they can't be used as access tokens
+	mfaTokenType = "mfa"
+
+	// totpSkew is the number of 30 second steps of clock drift accepted
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+// writeMFAChallenge responds to a login that needs a second factor
+func (h *AuthHandler) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *models.User) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"typ": mfaTokenType,
+		"exp": time.Now().Add(mfaTokenTTL).Unix(),
+	})
+
+	mfaToken, err := token.SignedString([]byte(h.jwtSecret))
+	if err != nil {
+		problem.Internal(w, r, "Failed to generate MFA token", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int(mfaTokenTTL / time.Second),
+	})
+}
+
+// parseMFAToken returns the user ID of a valid MFA challenge token
+func (h *AuthHandler) parseMFAToken(tokenString string) (int, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(h.jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	if typ, _ := claims["typ"].(string); typ != mfaTokenType {
+		return 0, false
+	}
+	sub, ok := claims["sub"].(float64)
+	if !ok || sub <= 0 {
+		return 0, false
+	}
+	return int(sub), true
+}
+
+// LoginMFA - POST /auth/login/mfa
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, ok := h.parseMFAToken(req.MFAToken)
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	mfaKey := "mfa:" + strconv.Itoa(userID)
+	if !h.allowLogin(w, r, mfaKey, ip) {
+		return
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err == repository.ErrUserNotFound {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	} else if err != nil {
+		h.refundLogin(mfaKey, ip)
+		problem.Internal(w, r, "Failed to get user", err)
+		return
+	}
+	if !user.TOTPEnabled {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+
+	switch {
+	case req.Code != "":
+		err = h.verifyTOTP(user, req.Code)
+	case req.RecoveryCode != "":
+		err = h.userRepo.ConsumeRecoveryCode(user.ID, utils.HashToken(normalizeRecoveryCode(req.RecoveryCode)))
+		if err == nil {
+			logger.GetLogger().Info("Recovery code used", zap.Int("user_id", user.ID))
+		}
+	default:
+		h.refundLogin(mfaKey, ip)
+		problem.Field(w, r, "code", "code or recoveryCode is required")
+		return
+	}
+
+	factor := "totp"
+	if req.Code == "" {
+		factor = "recovery_code"
+	}
+
+	if err == repository.ErrInvalidMFACode {
+		h.recordLogin(r, models.ActionUserLoginFailed, user.ID, user.Username, factor)
+		h.loginFailed(w, r, mfaKey, ip)
+		return
+	} else if err != nil {
+		h.refundLogin(mfaKey, ip)
+		problem.Internal(w, r, "Failed to verify MFA code", err)
+		return
+	}
+
+	h.userThrottle.Reset(mfaKey)
+	h.userThrottle.Reset(strings.ToLower(user.Username))
+	h.ipThrottle.Refund(ip)
+	h.recordLogin(r, models.ActionUserLogin, user.ID, user.Username, factor)
+
+	token, err := h.generateToken(user)
+	if err != nil {
+		problem.Internal(w, r, "Failed to generate token", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+// verifyTOTP checks a TOTP code and records its time step so it can't be
+// replayed
+func (h *AuthHandler) verifyTOTP(user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return repository.ErrInvalidMFACode
+	}
+	return h.userRepo.UseTOTPStep(user.ID, step)
+}
+
+// EnrollTOTP - POST /api/account/2fa/enroll
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		problem.Internal(w, r, "Failed to generate TOTP secret", err)
+		return
+	}
+
+	if err := h.userRepo.SetTOTPSecret(user.ID, secret); err != nil {
+		problem.Internal(w, r, "Failed to store TOTP secret", err, zap.Int("user_id", user.ID))
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(h.totpIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP - POST /api/account/2fa/confirm
+//
+// Enables two-factor authentication once the user proves their authenticator
+// is set up, and returns a fresh set of recovery codes.
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if user.TOTPEnabled {
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeMFANotEnrolled, "No pending two-factor enrollment")
+		return
+	}
+
+	if err := h.verifyTOTP(user, req.Code); err == repository.ErrInvalidMFACode {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidMFACode, "Invalid code")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to verify TOTP code", err)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		problem.Internal(w, r, "Failed to generate recovery codes", err)
+		return
+	}
+
+	if err := h.userRepo.EnableTOTP(user.ID, hashes, auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to enable TOTP", err, zap.Int("user_id", user.ID))
+		return
+	}
+
+	logger.GetLogger().Info("Two-factor authentication enabled", zap.Int("user_id", user.ID))
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP - DELETE /api/account/2fa
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DisableTOTPRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+
+	if user.TOTPEnabled {
+		if err := h.verifyTOTP(user, req.Code); err == repository.ErrInvalidMFACode {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidMFACode, "Invalid code")
+			return
+		} else if err != nil {
+			problem.Internal(w, r, "Failed to verify TOTP code", err)
+			return
+		}
+	}
+
+	if err := h.userRepo.DisableTOTP(user.ID, auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to disable TOTP", err, zap.Int("user_id", user.ID))
+		return
+	}
+
+	logger.GetLogger().Info("Two-factor authentication disabled", zap.Int("user_id", user.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminResetTOTP - POST /api/admin/users/{userID}/2fa/reset
+//
+// Lets an admin remove two-factor authentication from an account whose owner
+// lost both their authenticator and recovery codes.
+func (h *AuthHandler) AdminResetTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+		return
+	}
+
+	if err := h.userRepo.DisableTOTP(userID, auditContext(r)); err == repository.ErrUserNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to reset TOTP", err, zap.Int("user_id", userID))
+		return
+	}
+
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	metrics.RecordMFAReset()
+	logger.GetLogger().Warn("Two-factor authentication reset by admin",
+		zap.Int("user_id", userID),
+		zap.Int("admin_id", adminID),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// generateRecoveryCodes returns n recovery codes and their hashes
+func generateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		raw, err := utils.GenerateSecureShortCode(10)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(raw)
+		codes[i] = fmt.Sprintf("%s-%s", code[:5], code[5:])
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes case and dash insensitive
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/metrics"
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// ReportHandler handles abuse reports and their moderation.
+type ReportHandler struct {
+	repo repository.ReportRepository
+	cfg  config.AbuseConfig
+}
+
+// NewReportHandler returns a new ReportHandler instance.
+func NewReportHandler(repo repository.ReportRepository, cfg config.AbuseConfig) *ReportHandler {
+	return &ReportHandler{repo: repo, cfg: cfg}
+}
+
+// ReportShortURL - POST /{shortCode}/report
+//
+// Lets anyone report a link as abusive. Repeated reports from the same
+// network are accepted but not stored, so the response doesn't reveal them.
+// The address is the proxy-verified one from middleware.ClientIP, never a
+// header chosen by the reporter, since it decides automatic suspensions.
+func (h *ReportHandler) ReportShortURL(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateReportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Details = strings.TrimSpace(req.Details)
+
+	ip := middleware.ClientIP(r)
+	report := models.LinkReport{
+		ShortCode:       mux.Vars(r)["shortCode"],
+		Reason:          req.Reason,
+		Details:         req.Details,
+		ReporterIP:      ip,
+		ReporterNetwork: middleware.ClientNetwork(ip),
+	}
+	suspended, err := h.repo.Create(&report, h.cfg.AutoSuspendThreshold, auditContext(r))
+	switch err {
+	case nil:
+		metrics.RecordLinkReport(string(report.Reason), suspended)
+		if suspended {
+			logger.GetLogger().Warn("Suspended short URL after abuse reports",
+				zap.String("short_code", report.ShortCode),
+				zap.String("reason", string(report.Reason)),
+			)
+		}
+	case repository.ErrDuplicateReport:
+	case repository.ErrShortURLNotFound:
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return
+	default:
+		problem.Internal(w, r, "Failed to store abuse report", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ListReports - GET /admin/reports
+//
+// Lists abuse reports oldest first, by default the open ones. Filters are
+// status and shortCode; limit and cursor page through the queue.
+func (h *ReportHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.ReportFilter{
+		Status:    models.ReportOpen,
+		ShortCode: query.Get("shortCode"),
+		Limit:     50,
+	}
+
+	switch status := models.ReportStatus(query.Get("status")); status {
+	case "":
+	case "all":
+		filter.Status = ""
+	case models.ReportOpen, models.ReportDismissed, models.ReportActioned:
+		filter.Status = status
+	default:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "status must be open, dismissed, actioned or all")
+		return
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 100 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 100")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := strconv.Atoi(v)
+		if err != nil || cursor <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor")
+			return
+		}
+		filter.AfterID = cursor
+	}
+
+	reports, err := h.repo.List(filter)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list abuse reports", err)
+		return
+	}
+
+	// The ID of the last report is the cursor for the next page
+	var nextCursor int
+	if len(reports) > 0 && len(reports) == filter.Limit {
+		nextCursor = reports[len(reports)-1].ID
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Reports    []*models.LinkReport `json:"reports"`
+		NextCursor int                  `json:"nextCursor,omitempty"`
+	}{reports, nextCursor})
+}
+
+// DismissReport - POST /admin/reports/{reportID}/dismiss
+//
+// Dismisses all open reports about the reported link. A link suspended
+// automatically is enabled again.
+func (h *ReportHandler) DismissReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := reportID(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeReviewResult(w, r, h.repo.Dismiss(id, auditContext(r)))
+}
+
+// DisableReportedLink - POST /admin/reports/{reportID}/disable
+//
+// Disables the reported link and closes all its open reports. The optional
+// reason defaults to the report's.
+func (h *ReportHandler) DisableReportedLink(w http.ResponseWriter, r *http.Request) {
+	id, ok := reportID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DisableShortURLRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	h.writeReviewResult(w, r, h.repo.Disable(id, req.Reason, auditContext(r)))
+}
+
+func (h *ReportHandler) writeReviewResult(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case repository.ErrReportNotFound:
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Report not found")
+	case repository.ErrReportClosed:
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Report was already reviewed")
+	default:
+		problem.Internal(w, r, "Failed to review abuse report", err)
+	}
+}
+
+func reportID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["reportID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid report ID")
+		return 0, false
+	}
+	return id, true
+}
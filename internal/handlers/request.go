@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/validation"
+)
+
+// decodeJSON decodes the request body into dst and validates it against its
+// `validate` tags. Unknown fields are rejected and an empty body is treated
+// as an empty object. It writes an error response listing all invalid
+// fields and returns false if the body is rejected.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		// Anything after the first value is a malformed body
+		if dec.Decode(&struct{}{}) != io.EOF {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Request body must contain a single JSON object")
+			return false
+		}
+	} else if err != io.EOF {
+		writeDecodeError(w, r, err)
+		return false
+	}
+
+	if errs := validation.Struct(dst); len(errs) > 0 {
+		problem.ValidationFailed(w, r, errs...)
+		return false
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "Request body is too large")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		problem.Field(w, r, typeErr.Field, "must be of type "+jsonType(typeErr.Type.Kind().String()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// The decoder has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		problem.ValidationFailed(w, r, &models.ValidationError{Field: field, Message: "is not a known field"})
+	default:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Invalid request body")
+	}
+}
+
+// jsonType names a Go kind the way JSON does
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "struct", kind == "map":
+		return "object"
+	}
+	return kind
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// linkFor loads the link of the shortCode path variable and checks that the
+// caller has the role need for it. It writes an error response and returns
+// false if not.
+func (h *ShortURLHandler) linkFor(w http.ResponseWriter, r *http.Request, need models.WorkspaceRole) (*models.ShortURL, bool) {
+	su, err := h.repo.GetByShortCode(mux.Vars(r)["shortCode"])
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return nil, false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return nil, false
+	}
+
+	if !h.authorize(w, r, su, need) {
+		return nil, false
+	}
+	return su, true
+}
+
+// pathID parses a numeric path variable; the routes only match digits
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || id <= 0 {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetShortURLHistory - GET /shorten/{shortCode}/history
+//
+// Lists the revisions of a link, newest first. limit and cursor page through
+// them.
+func (h *ShortURLHandler) GetShortURLHistory(w http.ResponseWriter, r *http.Request) {
+	su, ok := h.linkFor(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	var cursor int
+	if v := query.Get("cursor"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor")
+			return
+		}
+		cursor = n
+	}
+
+	revisions, err := h.revisions.ListRevisions(su.ID, cursor, limit)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list revisions", err)
+		return
+	}
+
+	// The ID of the oldest revision is the cursor for the next page
+	var nextCursor int
+	if len(revisions) > 0 && len(revisions) == limit {
+		nextCursor = revisions[len(revisions)-1].ID
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Revisions  []*models.Revision `json:"revisions"`
+		NextCursor int                `json:"nextCursor,omitempty"`
+	}{revisions, nextCursor})
+}
+
+// RollbackShortURL - POST /shorten/{shortCode}/rollback/{revision}
+//
+// Sets the destination, fallback and expiry of a link back to those of one of
+// its revisions. The URLs go through the same checks as an update, since a
+// destination that was fine then may not be now.
+func (h *ShortURLHandler) RollbackShortURL(w http.ResponseWriter, r *http.Request) {
+	revisionID, ok := pathID(w, r, "revision")
+	if !ok {
+		return
+	}
+	su, ok := h.linkFor(w, r, models.RoleEditor)
+	if !ok || !checkIfMatch(w, r, su) {
+		return
+	}
+
+	rev, err := h.revisions.GetRevision(su.ID, revisionID)
+	if err == repository.ErrRevisionNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Revision not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get revision", err)
+		return
+	}
+
+	if err := validateExpiry(rev.ExpiresAt); err != nil {
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "The expiry of the revision has passed")
+		return
+	}
+	dest, ok := h.prepareDestination(w, r, rev.OriginalURL, su.WorkspaceID)
+	if !ok {
+		return
+	}
+	fallbackURL, ok := h.prepareFallback(w, r, rev.FallbackURL)
+	if !ok {
+		return
+	}
+
+	dest.apply(su)
+	su.FallbackURL = fallbackURL
+	su.ExpiresAt = rev.ExpiresAt
+
+	if err := h.repo.Rollback(su, auditContext(r)); err != nil {
+		if err == repository.ErrShortURLNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+			return
+		} else if err == repository.ErrVersionMismatch {
+			writeVersionMismatch(w, r)
+			return
+		}
+		problem.Internal(w, r, "Failed to roll back short URL", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(su))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(su)
+}
+
+// ScheduleChange - POST /shorten/{shortCode}/scheduled
+//
+// Schedules a destination change that takes effect at activateAt. The URL is
+// checked now, like in an update.
+func (h *ShortURLHandler) ScheduleChange(w http.ResponseWriter, r *http.Request) {
+	var req models.ScheduleChangeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !req.ActivateAt.After(time.Now()) {
+		problem.Field(w, r, "activateAt", "must be in the future")
+		return
+	}
+
+	su, ok := h.linkFor(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+	dest, ok := h.prepareDestination(w, r, req.URL, su.WorkspaceID)
+	if !ok {
+		return
+	}
+
+	ac := auditContext(r)
+	change := &models.ScheduledChange{
+		ShortURLID:       su.ID,
+		ShortCode:        su.ShortCode,
+		URL:              dest.url,
+		CanonicalURLHash: dest.canonicalHash,
+		ResolvedURL:      dest.resolvedURL,
+		UnicodeHost:      dest.unicodeHost,
+		FlagReason:       dest.flagReason,
+		ActivateAt:       req.ActivateAt,
+		AuthorID:         ac.ActorID,
+	}
+	if err := h.revisions.ScheduleChange(change, ac); err != nil {
+		problem.Internal(w, r, "Failed to schedule change", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(change)
+}
+
+// ListScheduledChanges - GET /shorten/{shortCode}/scheduled
+func (h *ShortURLHandler) ListScheduledChanges(w http.ResponseWriter, r *http.Request) {
+	su, ok := h.linkFor(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	changes, err := h.revisions.ListScheduledChanges(su.ID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list scheduled changes", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Changes []*models.ScheduledChange `json:"changes"`
+	}{changes})
+}
+
+// CancelScheduledChange - DELETE /shorten/{shortCode}/scheduled/{changeID}
+func (h *ShortURLHandler) CancelScheduledChange(w http.ResponseWriter, r *http.Request) {
+	changeID, ok := pathID(w, r, "changeID")
+	if !ok {
+		return
+	}
+	su, ok := h.linkFor(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	err := h.revisions.CancelScheduledChange(su.ID, changeID, auditContext(r))
+	if err == repository.ErrScheduledChangeNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Scheduled change not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to cancel scheduled change", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+)
+
+// maxSearchQueryLength limits the length of search queries in bytes
+const maxSearchQueryLength = 200
+
+// SearchShortURLs - GET /search
+//
+// Searches the caller's links, or a workspace's with ?workspaceId=, by short
+// code, destination, title, description, notes, page title and tags. Results
+// are ranked by relevance and paged with limit and offset.
+func (h *ShortURLHandler) SearchShortURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" || len(q) > maxSearchQueryLength {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "q must be between 1 and 200 characters")
+		return
+	}
+
+	filter := repository.ShortURLFilter{UserID: userID, Limit: 20}
+	for name, dest := range map[string]*int{
+		"workspaceId": &filter.WorkspaceID,
+		"limit":       &filter.Limit,
+		"offset":      &filter.Offset,
+	} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+name)
+				return
+			}
+			*dest = n
+		}
+	}
+	if filter.Limit == 0 || filter.Limit > 100 {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 100")
+		return
+	}
+
+	if filter.WorkspaceID != 0 && !authorizeWorkspace(w, r, h.workspaceRepo, filter.WorkspaceID, userID, models.RoleViewer) {
+		return
+	}
+
+	results, err := h.repo.Search(filter, q)
+	if err != nil {
+		problem.Internal(w, r, "Failed to search short URLs", err)
+		return
+	}
+
+	// A full page may be followed by more
+	var nextOffset int
+	if len(results) == filter.Limit {
+		nextOffset = filter.Offset + len(results)
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Results    []*models.SearchResult `json:"results"`
+		NextOffset int                    `json:"nextOffset,omitempty"`
+	}{results, nextOffset})
+}
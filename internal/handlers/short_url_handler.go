@@ -3,73 +3,500 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"log"
 	"url_shortener/internal/cache"
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/metrics"
+	"url_shortener/internal/middleware"
 	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
 	"url_shortener/internal/repository"
+	"url_shortener/internal/threatlist"
+	"url_shortener/internal/unfurl"
+	"url_shortener/internal/urlcheck"
 	"url_shortener/internal/utils"
 
 	"github.com/gorilla/mux"
+	"go.uber.org/zap"
 )
 
 // ShortURLHandler handles all short URL related HTTP requests.
 type ShortURLHandler struct {
-	repo  repository.ShortURLRepository
-	cache *cache.RedisCache
+	repo          repository.ShortURLRepository
+	workspaceRepo repository.WorkspaceRepository
+	revisions     repository.RevisionRepository
+	cache         *cache.RedisCache
+	urlValidator  *urlcheck.Validator
+	redirects     *urlcheck.RedirectChecker
+	homographs    *urlcheck.HomographDetector
+	threats       *threatlist.List
+	unfurlers     *unfurl.Detector // nil when previews for bots are off
+
+	canonicalization config.CanonicalizationConfig
+	batch            config.BatchConfig
 }
 
 // NewShortURLHandler returns a new ShortURLHandler instance.
-func NewShortURLHandler(repo repository.ShortURLRepository, cache *cache.RedisCache) *ShortURLHandler {
+func NewShortURLHandler(repo repository.ShortURLRepository, workspaceRepo repository.WorkspaceRepository, revisions repository.RevisionRepository, cache *cache.RedisCache, urlValidator *urlcheck.Validator, redirects *urlcheck.RedirectChecker, homographs *urlcheck.HomographDetector, threats *threatlist.List, unfurlers *unfurl.Detector, canonicalization config.CanonicalizationConfig, batch config.BatchConfig) *ShortURLHandler {
 	return &ShortURLHandler{
-		repo:  repo,
-		cache: cache,
+		repo:          repo,
+		workspaceRepo: workspaceRepo,
+		revisions:     revisions,
+		cache:         cache,
+		urlValidator:  urlValidator,
+		redirects:     redirects,
+		homographs:    homographs,
+		threats:       threats,
+		unfurlers:     unfurlers,
+
+		canonicalization: canonicalization,
+		batch:            batch,
 	}
 }
 
+// destination is a validated destination URL with the values derived from it
+type destination struct {
+	url           string
+	canonicalHash string
+	resolvedURL   string // set when url is a link of another shortener
+	unicodeHost   string // set for internationalized hosts
+	flagReason    string // set when the host looks like a spoof
+}
+
+// apply sets the destination of su. An existing flag is kept unless the new
+// destination is suspicious itself.
+func (d destination) apply(su *models.ShortURL) {
+	su.OriginalURL = d.url
+	su.CanonicalURLHash = d.canonicalHash
+	su.ResolvedURL = d.resolvedURL
+	su.UnicodeHost = d.unicodeHost
+	if d.flagReason != "" {
+		su.FlagReason = d.flagReason
+	}
+}
+
+// prepareDestination resolves a submitted destination with resolveDestination.
+// It writes an error response and returns false if the URL is rejected.
+func (h *ShortURLHandler) prepareDestination(w http.ResponseWriter, r *http.Request, rawURL string, workspaceID int) (destination, bool) {
+	trackingParams, err := trackingParamsFor(h.workspaceRepo, h.canonicalization, workspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
+		return destination{}, false
+	}
+	d, err := h.resolveDestination(r, rawURL, trackingParams)
+	if err != nil {
+		writeURLError(w, r, err)
+		return destination{}, false
+	}
+	return d, true
+}
+
+// resolveDestination sanitizes a submitted destination, stripping the
+// tracking parameters of its owner (see trackingParamsFor), validates it,
+// computes its canonical hash and resolves links of other shorteners. A
+// rejected URL is reported as a *models.ValidationError, any other error is
+// internal.
+func (h *ShortURLHandler) resolveDestination(r *http.Request, rawURL string, trackingParams []string) (destination, error) {
+	d := destination{url: models.SanitizeURL(rawURL, trackingParams)}
+
+	if err := models.ValidateURL(d.url); err != nil {
+		return destination{}, urlRejection(err)
+	}
+
+	canonical, err := models.CanonicalizeURL(d.url)
+	if err != nil {
+		return destination{}, &models.ValidationError{Field: "url", Message: "Invalid URL format"}
+	}
+
+	if err := h.validateDestination(r, canonical); err != nil {
+		return destination{}, err
+	}
+	d.canonicalHash = models.CanonicalURLHash(canonical)
+
+	// Links of other shorteners could hide anything, so their final
+	// destination is checked as well
+	resolved, err := h.redirects.Resolve(r.Context(), canonical)
+	if err != nil {
+		return destination{}, urlRejection(err)
+	}
+	if resolved != canonical {
+		if err := models.ValidateURL(resolved); err != nil {
+			return destination{}, urlRejection(err)
+		}
+		if err := h.validateDestination(r, resolved); err != nil {
+			return destination{}, err
+		}
+		d.resolvedURL = resolved
+	}
+
+	// Look-alike hosts are rejected or flagged depending on configuration
+	var reason string
+	for i, u := range []string{canonical, d.resolvedURL} {
+		parsed, err := url.Parse(u)
+		if u == "" || err != nil {
+			continue
+		}
+		unicodeHost, suspicious := h.homographs.Check(parsed.Hostname())
+		if i == 0 {
+			d.unicodeHost = unicodeHost
+		}
+		if suspicious != "" {
+			reason = suspicious
+			break
+		}
+	}
+	if reason != "" {
+		if h.homographs.Rejects() {
+			return destination{}, &models.ValidationError{Field: "url", Message: reason}
+		}
+		d.flagReason = reason
+	}
+
+	return d, nil
+}
+
+// trackingParamsFor returns the tracking parameters to strip from the
+// destinations of the workspace, or of personal links when workspaceID is 0
+func trackingParamsFor(workspaceRepo repository.WorkspaceRepository, canonicalization config.CanonicalizationConfig, workspaceID int) ([]string, error) {
+	strip := canonicalization.StripTrackingParams
+	if workspaceID != 0 {
+		ws, err := workspaceRepo.GetByID(workspaceID)
+		if err != nil {
+			return nil, err
+		}
+		strip = ws.StripTrackingParams
+	}
+
+	if !strip {
+		return nil, nil
+	}
+	return canonicalization.TrackingParams, nil
+}
+
+// validateDestination runs the network checks of the URL validator and the
+// threat feeds on a canonical URL. It returns a *models.ValidationError if the
+// URL is rejected.
+func (h *ShortURLHandler) validateDestination(r *http.Request, rawURL string) error {
+	err := h.urlValidator.Validate(r.Context(), rawURL)
+	if err == nil {
+		if match, ok := h.threats.Check(rawURL); ok {
+			metrics.RecordThreatListHit(match.Feed, "submit")
+			userID, _ := middleware.UserIDFromContext(r.Context())
+			logger.GetLogger().Warn("Rejected destination on threat list",
+				zap.String("feed", match.Feed),
+				zap.String("entry", match.Entry),
+				zap.Int("user_id", userID),
+			)
+			err = &models.ValidationError{Field: "url", Message: "URL is listed as a " + match.Feed + " threat"}
+		}
+	}
+	if err != nil {
+		return urlRejection(err)
+	}
+	return nil
+}
+
+// prepareFallback resolves a fallback URL with resolveFallback. It writes an
+// error response and returns false if the URL is rejected.
+func (h *ShortURLHandler) prepareFallback(w http.ResponseWriter, r *http.Request, rawURL string) (string, bool) {
+	fallbackURL, err := h.resolveFallback(r, rawURL)
+	if err != nil {
+		writeURLError(w, r, err)
+		return "", false
+	}
+	return fallbackURL, true
+}
+
+// resolveFallback validates a fallback URL the same way as a destination,
+// except that a suspicious host is always rejected since nobody reviews
+// fallbacks. An empty URL clears the fallback.
+func (h *ShortURLHandler) resolveFallback(r *http.Request, rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", nil
+	}
+
+	fail := func(message string) (string, error) {
+		return "", &models.ValidationError{Field: "fallbackUrl", Message: message}
+	}
+
+	if err := models.ValidateURL(rawURL); err != nil {
+		return fail(fallbackMessage(err))
+	}
+	canonical, err := models.CanonicalizeURL(rawURL)
+	if err != nil {
+		return fail("Invalid URL format")
+	}
+
+	err = h.urlValidator.Validate(r.Context(), canonical)
+	if err == nil {
+		if match, ok := h.threats.Check(canonical); ok {
+			metrics.RecordThreatListHit(match.Feed, "submit")
+			return fail("URL is listed as a " + match.Feed + " threat")
+		}
+		_, err = h.redirects.Resolve(r.Context(), canonical)
+	}
+	if err != nil {
+		return fail(fallbackMessage(err))
+	}
+
+	if parsed, err := url.Parse(canonical); err == nil {
+		if _, suspicious := h.homographs.Check(parsed.Hostname()); suspicious != "" {
+			return fail(suspicious)
+		}
+	}
+
+	return rawURL, nil
+}
+
+func fallbackMessage(err error) string {
+	if validationErr, ok := err.(*models.ValidationError); ok {
+		return validationErr.Message
+	}
+	return "Invalid URL"
+}
+
+// urlRejection turns an error of the URL checks into a validation error
+func urlRejection(err error) error {
+	if _, ok := err.(*models.ValidationError); ok {
+		return err
+	}
+	return &models.ValidationError{Field: "url", Message: "Invalid URL"}
+}
+
+// writeURLError writes the response for an error of resolveDestination or
+// resolveFallback
+func writeURLError(w http.ResponseWriter, r *http.Request, err error) {
+	if validationErr, ok := err.(*models.ValidationError); ok {
+		problem.ValidationFailed(w, r, validationErr)
+		return
+	}
+	problem.Internal(w, r, "Failed to check URL", err)
+}
+
+// accessError is a denied access check along with the response it results in
+type accessError struct {
+	status int
+	code   problem.Code
+	detail string
+}
+
+func (e *accessError) Error() string {
+	return e.detail
+}
+
+var (
+	errLinkNotVisible   = &accessError{http.StatusNotFound, problem.CodeNotFound, "Short URL not found"}
+	errInsufficientRole = &accessError{http.StatusForbidden, problem.CodeInsufficientRole, "Insufficient workspace role"}
+	errLinkHasNoOwner   = &accessError{http.StatusForbidden, problem.CodeForbidden, "Short URL has no owner and can't be modified"}
+)
+
+// authorize checks that the current user has at least the given role on the
+// short URL with checkAccess. It writes an error response and returns false if
+// access is denied.
+func (h *ShortURLHandler) authorize(w http.ResponseWriter, r *http.Request, su *models.ShortURL, need models.WorkspaceRole) bool {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return false
+	}
+
+	if err := h.checkAccess(userID, su, need); err != nil {
+		if accessErr, ok := err.(*accessError); ok {
+			problem.Write(w, r, accessErr.status, accessErr.code, accessErr.detail)
+		} else {
+			problem.Internal(w, r, "Failed to get workspace role", err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// checkAccess checks that the user has at least the given role on the short
+// URL. Links in a workspace are governed by the membership role, personal
+// links by ownership. Links created before ownership was tracked are readable
+// by everyone but can't be changed; links kept after their owner deleted
+// their account are readable by nobody. A denial is returned as an *accessError;
+// links the user can't see are reported as not found.
+func (h *ShortURLHandler) checkAccess(userID int, su *models.ShortURL, need models.WorkspaceRole) error {
+	switch {
+	case su.WorkspaceID != 0:
+		role, err := h.workspaceRepo.GetMemberRole(su.WorkspaceID, userID)
+		if err == repository.ErrNotWorkspaceMember {
+			return errLinkNotVisible
+		} else if err != nil {
+			return err
+		}
+		if !role.Includes(need) {
+			return errInsufficientRole
+		}
+	case su.UserID != 0:
+		if su.UserID != userID {
+			return errLinkNotVisible
+		}
+	default:
+		if !su.ReadableByAnyone() {
+			return errLinkNotVisible
+		}
+		if need != models.RoleViewer {
+			return errLinkHasNoOwner
+		}
+	}
+
+	return nil
+}
+
+// authorizeWorkspace checks that the current user has at least the given role
+// in the workspace
+func authorizeWorkspace(w http.ResponseWriter, r *http.Request, workspaceRepo repository.WorkspaceRepository, workspaceID, userID int, need models.WorkspaceRole) bool {
+	role, err := workspaceRepo.GetMemberRole(workspaceID, userID)
+	if err == repository.ErrNotWorkspaceMember {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Workspace not found")
+		return false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get workspace role", err)
+		return false
+	}
+	if !role.Includes(need) {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeInsufficientRole, "Insufficient workspace role")
+		return false
+	}
+	return true
+}
+
+// maxCodeAttempts is how many short codes are generated for a link before
+// giving up because they were all taken
+const maxCodeAttempts = 3
+
+// newShortURL validates a link to create and builds it, with a generated short
+// code unless an alias is given. Errors are reported like resolveDestination.
+func (h *ShortURLHandler) newShortURL(r *http.Request, userID, workspaceID int, trackingParams []string, item models.BatchCreateItem) (*models.ShortURL, error) {
+	if models.ReservedShortCode(item.Alias) {
+		return nil, &models.ValidationError{Field: "alias", Message: "is reserved"}
+	}
+	if err := validateExpiry(item.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	dest, err := h.resolveDestination(r, item.URL, trackingParams)
+	if err != nil {
+		return nil, err
+	}
+	fallbackURL, err := h.resolveFallback(r, item.FallbackURL)
+	if err != nil {
+		return nil, err
+	}
+
+	shortCode := item.Alias
+	if shortCode == "" {
+		if shortCode, err = utils.GenerateSecureShortCode(6); err != nil {
+			return nil, err
+		}
+	}
+
+	su := &models.ShortURL{
+		ShortCode:   shortCode,
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		FallbackURL: fallbackURL,
+		ExpiresAt:   item.ExpiresAt,
+		Title:       item.Title,
+		Description: item.Description,
+		Notes:       item.Notes,
+
+		OGTitle:       item.OGTitle,
+		OGDescription: item.OGDescription,
+		OGImageURL:    strings.TrimSpace(item.OGImageURL),
+	}
+	dest.apply(su)
+	return su, nil
+}
+
+// validateExpiry checks that an expiry time, if any, is in the future
+func validateExpiry(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return &models.ValidationError{Field: "expiresAt", Message: "must be in the future"}
+	}
+	return nil
+}
+
 // CreateShortURL - POST /shorten
 func (h *ShortURLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		URL string `json:"url"`
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req models.CreateShortURLRequest
+
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Validate the URL
-	if strings.TrimSpace(req.URL) == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
+	if req.WorkspaceID != 0 && !authorizeWorkspace(w, r, h.workspaceRepo, req.WorkspaceID, userID, models.RoleEditor) {
 		return
 	}
 
-	// Validate URL using the ValidateURL function
-	if err := models.ValidateURL(req.URL); err != nil {
-		if validationErr, ok := err.(*models.ValidationError); ok {
-			http.Error(w, validationErr.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+	trackingParams, err := trackingParamsFor(h.workspaceRepo, h.canonicalization, req.WorkspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
 		return
 	}
 
-	// Generate a secure random short code
-	shortCode, err := utils.GenerateSecureShortCode(6)
+	su, err := h.newShortURL(r, userID, req.WorkspaceID, trackingParams, models.BatchCreateItem{
+		URL:         req.URL,
+		FallbackURL: req.FallbackURL,
+		Alias:       req.Alias,
+		ExpiresAt:   req.ExpiresAt,
+		Title:       req.Title,
+		Description: req.Description,
+		Notes:       req.Notes,
+
+		OGTitle:       req.OGTitle,
+		OGDescription: req.OGDescription,
+		OGImageURL:    req.OGImageURL,
+	})
 	if err != nil {
-		http.Error(w, "Failed to generate short code", http.StatusInternalServerError)
+		writeURLError(w, r, err)
 		return
 	}
 
-	su := models.ShortURL{
-		ShortCode:   shortCode,
-		OriginalURL: req.URL,
+	// In dedupe mode an existing link of the same owner is returned as is
+	if req.Dedupe {
+		existing, err := h.repo.FindByCanonicalURL(userID, req.WorkspaceID, su.CanonicalURLHash)
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(existing)
+			return
+		} else if err != repository.ErrShortURLNotFound {
+			problem.Internal(w, r, "Failed to look up duplicate short URL", err)
+			return
+		}
 	}
 
-	// Create in repository
-	if err := h.repo.Create(&su); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// A generated code that happens to be taken is replaced by a new one
+	for attempt := 1; ; attempt++ {
+		err = h.repo.Create(su, auditContext(r))
+		if err != repository.ErrShortCodeTaken || req.Alias != "" || attempt == maxCodeAttempts {
+			break
+		}
+		if su.ShortCode, err = utils.GenerateSecureShortCode(6); err != nil {
+			break
+		}
+	}
+	if err == repository.ErrShortCodeTaken && req.Alias != "" {
+		problem.Write(w, r, http.StatusConflict, problem.CodeAlreadyExists, "Alias is already taken")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to create short URL", err)
 		return
 	}
 
@@ -84,21 +511,34 @@ func (h *ShortURLHandler) GetShortURL(w http.ResponseWriter, r *http.Request) {
 
 	su, err := h.repo.GetByShortCode(shortCode)
 	if err == repository.ErrShortURLNotFound {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return
+	}
+
+	if !h.authorize(w, r, su, models.RoleViewer) {
+		return
+	}
+
+	// The tag of the previous response was made after its click was counted,
+	// so it matches the stored link
+	if tag := etag(su); etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	// Optionally, increment access count if this is an actual "use" of the short URL
 	// In many services, we do this in a redirect handler. For demonstration:
 	if err := h.repo.IncrementAccessCount(shortCode); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to increment access count", err)
 		return
 	}
 	su.AccessCount++ // reflect the increment in the current object
 
+	w.Header().Set("ETag", etag(su))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(su)
 }
@@ -108,57 +548,182 @@ func (h *ShortURLHandler) UpdateShortURL(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	shortCode := vars["shortCode"]
 
-	var req struct {
-		URL string `json:"url"`
+	var req models.UpdateShortURLRequest
+
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// First, check if the short code exists
+	su, err := h.repo.GetByShortCode(shortCode)
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !h.authorize(w, r, su, models.RoleEditor) || !checkIfMatch(w, r, su) {
 		return
 	}
 
-	if strings.TrimSpace(req.URL) == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		writeURLError(w, r, err)
+		return
+	}
+	dest, ok := h.prepareDestination(w, r, req.URL, su.WorkspaceID)
+	if !ok {
+		return
+	}
+	fallbackURL, ok := h.prepareFallback(w, r, req.FallbackURL)
+	if !ok {
+		return
+	}
+
+	// Update original URL
+	dest.apply(su)
+	su.FallbackURL = fallbackURL
+	su.ExpiresAt = req.ExpiresAt
+	su.Title = req.Title
+	su.Description = req.Description
+	su.Notes = req.Notes
+	su.OGTitle = req.OGTitle
+	su.OGDescription = req.OGDescription
+	su.OGImageURL = strings.TrimSpace(req.OGImageURL)
+
+	if err := h.repo.Update(su, auditContext(r)); err != nil {
+		if err == repository.ErrShortURLNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+			return
+		} else if err == repository.ErrVersionMismatch {
+			writeVersionMismatch(w, r)
+			return
+		}
+		problem.Internal(w, r, "Failed to update short URL", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(su))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(su)
+}
+
+// PatchShortURL - PATCH /shorten/{shortCode}
+//
+// Applies a JSON Merge Patch (RFC 7396): fields left out stay as they are and
+// fallbackUrl, expiresAt or any of the texts set to null are cleared. Only
+// the changed columns are written.
+func (h *ShortURLHandler) PatchShortURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var req models.PatchShortURLRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Null["url"] {
+		problem.Field(w, r, "url", "cannot be null")
 		return
 	}
 
-	// First, check if the short code exists
 	su, err := h.repo.GetByShortCode(shortCode)
 	if err == repository.ErrShortURLNotFound {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to get short URL", err)
 		return
 	}
 
-	// Update original URL
-	su.OriginalURL = req.URL
+	if !h.authorize(w, r, su, models.RoleEditor) || !checkIfMatch(w, r, su) {
+		return
+	}
 
-	if err := h.repo.Update(su); err != nil {
+	if req.URL != nil {
+		dest, ok := h.prepareDestination(w, r, *req.URL, su.WorkspaceID)
+		if !ok {
+			return
+		}
+		dest.apply(su)
+	}
+	if req.FallbackURL != nil {
+		fallbackURL, ok := h.prepareFallback(w, r, *req.FallbackURL)
+		if !ok {
+			return
+		}
+		su.FallbackURL = fallbackURL
+	} else if req.Null["fallbackUrl"] {
+		su.FallbackURL = ""
+	}
+	if req.ExpiresAt != nil {
+		if err := validateExpiry(req.ExpiresAt); err != nil {
+			writeURLError(w, r, err)
+			return
+		}
+		su.ExpiresAt = req.ExpiresAt
+	} else if req.Null["expiresAt"] {
+		su.ExpiresAt = nil
+	}
+	patchString(&su.Title, req.Title, req.Null["title"])
+	patchString(&su.Description, req.Description, req.Null["description"])
+	patchString(&su.Notes, req.Notes, req.Null["notes"])
+	patchString(&su.OGTitle, req.OGTitle, req.Null["ogTitle"])
+	patchString(&su.OGDescription, req.OGDescription, req.Null["ogDescription"])
+	patchString(&su.OGImageURL, req.OGImageURL, req.Null["ogImageUrl"])
+	su.OGImageURL = strings.TrimSpace(su.OGImageURL)
+
+	if err := h.repo.Patch(su, auditContext(r)); err != nil {
 		if err == repository.ErrShortURLNotFound {
-			http.Error(w, "Short URL not found", http.StatusNotFound)
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+			return
+		} else if err == repository.ErrVersionMismatch {
+			writeVersionMismatch(w, r)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to update short URL", err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(su))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(su)
 }
 
+// patchString applies the patch of an optional text field to dest: a value
+// replaces it and null clears it.
+func patchString(dest, value *string, null bool) {
+	if value != nil {
+		*dest = *value
+	} else if null {
+		*dest = ""
+	}
+}
+
 // DeleteShortURL - DELETE /shorten/{shortCode}
 func (h *ShortURLHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	shortCode := vars["shortCode"]
 
-	err := h.repo.DeleteByShortCode(shortCode)
+	su, err := h.repo.GetByShortCode(shortCode)
 	if err == repository.ErrShortURLNotFound {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return
+	}
+
+	if !h.authorize(w, r, su, models.RoleEditor) {
+		return
+	}
+
+	err = h.repo.DeleteByShortCode(shortCode, auditContext(r))
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to delete short URL", err)
 		return
 	}
 
@@ -172,10 +737,14 @@ func (h *ShortURLHandler) GetShortURLStats(w http.ResponseWriter, r *http.Reques
 
 	su, err := h.repo.GetByShortCode(shortCode)
 	if err == repository.ErrShortURLNotFound {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return
+	}
+
+	if !h.authorize(w, r, su, models.RoleViewer) {
 		return
 	}
 
@@ -183,20 +752,120 @@ func (h *ShortURLHandler) GetShortURLStats(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(su)
 }
 
+// ListShortURLs - GET /shorten
+//
+// Lists the caller's personal links, or the links of a workspace when the
+// workspaceId query parameter is given.
+func (h *ShortURLHandler) ListShortURLs(w http.ResponseWriter, r *http.Request) {
+	h.listShortURLs(w, r, false)
+}
+
+// listShortURLs lists the caller's or a workspace's links, or those in the
+// trash when deleted is set
+func (h *ShortURLHandler) listShortURLs(w http.ResponseWriter, r *http.Request, deleted bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.ShortURLFilter{UserID: userID, Deleted: deleted, Tags: query["tag"]}
+	for name, dest := range map[string]*int{
+		"workspaceId":  &filter.WorkspaceID,
+		"collectionId": &filter.CollectionID,
+		"limit":        &filter.Limit,
+		"offset":       &filter.Offset,
+	} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+name)
+				return
+			}
+			*dest = n
+		}
+	}
+
+	if filter.WorkspaceID != 0 && !authorizeWorkspace(w, r, h.workspaceRepo, filter.WorkspaceID, userID, models.RoleViewer) {
+		return
+	}
+
+	shortURLs, err := h.repo.List(filter)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list short URLs", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(shortURLs)
+}
+
 // RedirectToOriginalURL - GET /{shortCode}
+//
+// Link unfurling bots, recognized by their User-Agent, get an HTML page with
+// the link's social preview instead of the redirect.
 func (h *ShortURLHandler) RedirectToOriginalURL(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	shortCode := vars["shortCode"]
 
 	su, err := h.repo.GetByShortCode(shortCode)
 	if err == repository.ErrShortURLNotFound {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, "Failed to get short URL", err)
 		return
 	}
 
+	// Disabled links are gone for good, or unavailable for legal reasons
+	if su.DisabledAt != nil {
+		status := http.StatusGone
+		if su.DisabledReason == models.ReportIllegal {
+			status = http.StatusUnavailableForLegalReasons
+		}
+		writeDisabledPage(w, su, status)
+		return
+	}
+
+	if su.Expired(time.Now()) {
+		problem.Write(w, r, http.StatusGone, problem.CodeExpired, "Short URL has expired")
+		return
+	}
+
+	// Flagged links and destinations that appeared on a threat feed after the
+	// link was created get a warning page. The visitor may continue from it.
+	if r.URL.Query().Get("proceed") != "1" {
+		warning := su.FlagReason
+		for _, dest := range []string{su.OriginalURL, su.ResolvedURL} {
+			if match, ok := h.threats.Check(dest); dest != "" && ok {
+				metrics.RecordThreatListHit(match.Feed, "redirect")
+				warning = "This link leads to a site listed as a " + match.Feed + " threat."
+				break
+			}
+		}
+		if warning != "" {
+			writeInterstitial(w, su, warning)
+			return
+		}
+	}
+
+	// While the destination is down visitors are sent to the fallback
+	destination := su.OriginalURL
+	if su.HealthStatus == models.HealthBroken && su.FallbackURL != "" {
+		destination = su.FallbackURL
+	}
+
+	// Chat and social network bots get a page with the link's preview. Their
+	// fetches aren't clicks.
+	if h.unfurlers != nil {
+		w.Header().Set("Vary", "User-Agent")
+		if h.unfurlers.IsUnfurler(r.UserAgent()) {
+			writeUnfurlPage(w, su, destination)
+			return
+		}
+	}
+
 	// Increment access count asynchronously to not block the redirect
 	go func() {
 		if err := h.repo.IncrementAccessCount(shortCode); err != nil {
@@ -205,5 +874,83 @@ func (h *ShortURLHandler) RedirectToOriginalURL(w http.ResponseWriter, r *http.R
 		}
 	}()
 
-	http.Redirect(w, r, su.OriginalURL, http.StatusMovedPermanently)
+	// The redirect is temporary and not cached, so that changes of the link,
+	// warnings and disabling reach every visitor and every click is counted
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, destination, http.StatusFound)
+}
+
+// FlagShortURL - PUT /admin/shorten/{shortCode}/flag
+//
+// Flags a link as dangerous so visitors see a warning page before being
+// redirected.
+func (h *ShortURLHandler) FlagShortURL(w http.ResponseWriter, r *http.Request) {
+	var req models.FlagShortURLRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 255 {
+		problem.Field(w, r, "reason", "is required and must be at most 255 characters")
+		return
+	}
+
+	h.setFlag(w, r, req.Reason)
+}
+
+// UnflagShortURL - DELETE /admin/shorten/{shortCode}/flag
+func (h *ShortURLHandler) UnflagShortURL(w http.ResponseWriter, r *http.Request) {
+	h.setFlag(w, r, "")
+}
+
+func (h *ShortURLHandler) setFlag(w http.ResponseWriter, r *http.Request, reason string) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	err := h.repo.SetFlag(shortCode, reason, auditContext(r))
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to flag short URL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableShortURL - PUT /admin/shorten/{shortCode}/disabled
+//
+// Disables a link so it no longer redirects.
+func (h *ShortURLHandler) DisableShortURL(w http.ResponseWriter, r *http.Request) {
+	var req models.DisableShortURLRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Reason == "" {
+		problem.Field(w, r, "reason", "is required")
+		return
+	}
+
+	h.setDisabled(w, r, req.Reason)
+}
+
+// EnableShortURL - DELETE /admin/shorten/{shortCode}/disabled
+func (h *ShortURLHandler) EnableShortURL(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, "")
+}
+
+func (h *ShortURLHandler) setDisabled(w http.ResponseWriter, r *http.Request, reason models.ReportReason) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	err := h.repo.SetDisabled(shortCode, reason, auditContext(r))
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to disable short URL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// ListTrash - GET /trash
+//
+// Lists the deleted links of the caller, or of a workspace with
+// ?workspaceId=, most recently deleted first.
+func (h *ShortURLHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	h.listShortURLs(w, r, true)
+}
+
+// RestoreShortURL - POST /trash/{shortCode}/restore
+func (h *ShortURLHandler) RestoreShortURL(w http.ResponseWriter, r *http.Request) {
+	su, err := h.repo.GetDeletedByShortCode(mux.Vars(r)["shortCode"])
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found in the trash")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get short URL", err)
+		return
+	}
+
+	if !h.authorize(w, r, su, models.RoleEditor) {
+		return
+	}
+
+	err = h.repo.Restore(su, auditContext(r))
+	if err == repository.ErrShortURLNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Short URL not found in the trash")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to restore short URL", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(su))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(su)
+}
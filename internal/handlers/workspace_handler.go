@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/middleware"
+	"url_shortener/internal/models"
+	"url_shortener/internal/notify"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
+	"url_shortener/internal/utils"
+)
+
+// WorkspaceHandler handles workspace, membership and invitation requests.
+type WorkspaceHandler struct {
+	repo          repository.WorkspaceRepository
+	notifier      notify.Notifier
+	invitationTTL time.Duration
+	invitationURL string
+}
+
+// NewWorkspaceHandler returns a new WorkspaceHandler instance.
+func NewWorkspaceHandler(repo repository.WorkspaceRepository, notifier notify.Notifier, cfg config.WorkspaceConfig) *WorkspaceHandler {
+	invitationTTL := time.Duration(cfg.InvitationTTLHours) * time.Hour
+	if invitationTTL <= 0 {
+		invitationTTL = 72 * time.Hour
+	}
+
+	return &WorkspaceHandler{
+		repo:          repo,
+		notifier:      notifier,
+		invitationTTL: invitationTTL,
+		invitationURL: cfg.InvitationURL,
+	}
+}
+
+// memberRole resolves the workspace in the path and checks the current user
+// has at least the given role in it. It writes an error response and returns
+// false otherwise.
+func (h *WorkspaceHandler) memberRole(w http.ResponseWriter, r *http.Request, need models.WorkspaceRole) (workspaceID, userID int, ok bool) {
+	userID, ok = middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return 0, 0, false
+	}
+
+	workspaceID, err := strconv.Atoi(mux.Vars(r)["workspaceID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid workspace ID")
+		return 0, 0, false
+	}
+
+	role, err := h.repo.GetMemberRole(workspaceID, userID)
+	if err == repository.ErrNotWorkspaceMember {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Workspace not found")
+		return 0, 0, false
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get workspace role", err)
+		return 0, 0, false
+	}
+
+	if !role.Includes(need) {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeInsufficientRole, "Insufficient workspace role")
+		return 0, 0, false
+	}
+
+	return workspaceID, userID, true
+}
+
+// CreateWorkspace - POST /workspaces
+func (h *WorkspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.CreateWorkspaceRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		problem.Field(w, r, "name", "must be between 1 and 100 characters")
+		return
+	}
+
+	ws := models.Workspace{
+		Name:      name,
+		CreatedBy: userID,
+	}
+	if err := h.repo.Create(&ws, auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to create workspace", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ws)
+}
+
+// ListWorkspaces - GET /workspaces
+func (h *WorkspaceHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	workspaces, err := h.repo.ListForUser(userID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list workspaces", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// UpdateSettings - PUT /workspaces/{workspaceID}/settings
+func (h *WorkspaceHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceID, _, ok := h.memberRole(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWorkspaceSettingsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ws, err := h.repo.GetByID(workspaceID)
+	if err == repository.ErrWorkspaceNotFound {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Workspace not found")
+		return
+	} else if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
+		return
+	}
+
+	if req.StripTrackingParams != nil {
+		ws.StripTrackingParams = *req.StripTrackingParams
+	}
+
+	if err := h.repo.UpdateSettings(ws, auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to update workspace settings", err)
+		return
+	}
+
+	ws.Role = models.RoleOwner
+	json.NewEncoder(w).Encode(ws)
+}
+
+// ListMembers - GET /workspaces/{workspaceID}/members
+func (h *WorkspaceHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	workspaceID, _, ok := h.memberRole(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := h.repo.ListMembers(workspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list workspace members", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+// UpdateMember - PUT /workspaces/{workspaceID}/members/{userID}
+func (h *WorkspaceHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID, _, ok := h.memberRole(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if !h.writeMembershipError(w, r, h.repo.SetMemberRole(workspaceID, memberID, req.Role, auditContext(r))) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveMember - DELETE /workspaces/{workspaceID}/members/{userID}
+//
+// Owners can remove anyone; other members can only leave.
+func (h *WorkspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+		return
+	}
+
+	need := models.RoleOwner
+	if userID, _ := middleware.UserIDFromContext(r.Context()); userID == memberID {
+		need = models.RoleViewer
+	}
+
+	workspaceID, _, ok := h.memberRole(w, r, need)
+	if !ok {
+		return
+	}
+
+	if !h.writeMembershipError(w, r, h.repo.RemoveMember(workspaceID, memberID, auditContext(r))) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMembershipError maps membership repository errors to responses. It
+// returns true if err is nil.
+func (h *WorkspaceHandler) writeMembershipError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case repository.ErrNotWorkspaceMember:
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Member not found")
+	case repository.ErrLastWorkspaceOwner:
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, err.Error())
+	default:
+		problem.Internal(w, r, "Failed to update workspace membership", err)
+	}
+	return false
+}
+
+// InviteMember - POST /workspaces/{workspaceID}/invitations
+func (h *WorkspaceHandler) InviteMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID, userID, ok := h.memberRole(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req models.InviteMemberRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ws, err := h.repo.GetByID(workspaceID)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get workspace", err)
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(utils.DefaultTokenBytes)
+	if err != nil {
+		problem.Internal(w, r, "Failed to generate invitation token", err)
+		return
+	}
+
+	invitation := models.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       req.Email,
+		Role:        req.Role,
+		InvitedBy:   userID,
+		ExpiresAt:   time.Now().Add(h.invitationTTL),
+	}
+	if err := h.repo.CreateInvitation(&invitation, utils.HashToken(token), auditContext(r)); err != nil {
+		problem.Internal(w, r, "Failed to create invitation", err)
+		return
+	}
+
+	body := fmt.Sprintf("You have been invited to join the workspace %q as %s.\n\n", ws.Name, invitation.Role)
+	if h.invitationURL != "" {
+		body += fmt.Sprintf("Accept the invitation here: %s?token=%s\n\n", h.invitationURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("Your invitation token is: %s\n\n", token)
+	}
+	body += fmt.Sprintf("The invitation expires at %s.\n", invitation.ExpiresAt.UTC().Format(time.RFC1123))
+
+	// The invitation is already stored, so a delivery failure must not make
+	// the client retry and invite twice; the email is sent in the background.
+	go func(msg notify.Message, invitationID int) {
+		if err := h.notifier.Send(msg); err != nil {
+			logger.GetLogger().Error("Failed to send invitation", zap.Int("invitation_id", invitationID), zap.Error(err))
+		}
+	}(notify.Message{
+		To:      invitation.Email,
+		Subject: "Workspace invitation",
+		Body:    body,
+	}, invitation.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// AcceptInvitation - POST /invitations/accept
+func (h *WorkspaceHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization required")
+		return
+	}
+
+	var req models.AcceptInvitationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	member, err := h.repo.AcceptInvitation(utils.HashToken(req.Token), userID, auditContext(r))
+	switch err {
+	case nil:
+	case repository.ErrInvalidInvitation:
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired invitation")
+		return
+	case repository.ErrAlreadyWorkspaceMember:
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Already a member of this workspace")
+		return
+	default:
+		problem.Internal(w, r, "Failed to accept invitation", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(member)
+}
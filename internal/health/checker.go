@@ -0,0 +1,261 @@
+// Package health periodically checks that the destinations of short URLs
+// still respond.
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/metrics"
+	"url_shortener/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Store is the part of the short URL repository used by the checker
+type Store interface {
+	ListForHealthCheck(afterID, limit int) ([]*models.ShortURL, error)
+	UpdateHealth(id int, result models.HealthCheckResult) error
+}
+
+// Checker checks every link's destination with a limited number of
+// concurrent requests and a minimum delay between requests to the same host
+type Checker struct {
+	store            Store
+	client           *http.Client
+	interval         time.Duration
+	concurrency      int
+	batchSize        int
+	failureThreshold int
+	politeness       *politeness
+	now              func() time.Time
+}
+
+// NewChecker creates a Checker. client should not follow redirects, a
+// redirect counts as a healthy response.
+func NewChecker(store Store, client *http.Client, cfg config.HealthCheckConfig) *Checker {
+	c := &Checker{
+		store:            store,
+		client:           client,
+		interval:         time.Duration(cfg.IntervalMinutes) * time.Minute,
+		concurrency:      cfg.Concurrency,
+		batchSize:        cfg.BatchSize,
+		failureThreshold: cfg.FailureThreshold,
+		politeness:       newPoliteness(time.Duration(cfg.HostDelayMillis) * time.Millisecond),
+		now:              time.Now,
+	}
+	if c.interval <= 0 {
+		c.interval = time.Hour
+	}
+	if c.concurrency <= 0 {
+		c.concurrency = 4
+	}
+	if c.batchSize <= 0 {
+		c.batchSize = 500
+	}
+	if c.failureThreshold <= 0 {
+		c.failureThreshold = 2
+	}
+	return c
+}
+
+// Run checks all links every interval until ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		broken, err := c.CheckAll(ctx)
+		if err != nil {
+			logger.GetLogger().Error("Health check run failed", zap.Error(err))
+		} else {
+			metrics.SetBrokenLinks(broken)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every link once and returns the number of broken links
+func (c *Checker) CheckAll(ctx context.Context) (int, error) {
+	jobs := make(chan *models.ShortURL)
+	var broken int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for su := range jobs {
+				result := c.Check(ctx, su)
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := c.store.UpdateHealth(su.ID, result); err != nil {
+					logger.GetLogger().Error("Failed to store health check result", zap.String("short_code", su.ShortCode), zap.Error(err))
+				}
+				if result.Status == models.HealthBroken {
+					mu.Lock()
+					broken++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err := c.feed(ctx, jobs)
+	close(jobs)
+	wg.Wait()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return broken, err
+}
+
+func (c *Checker) feed(ctx context.Context, jobs chan<- *models.ShortURL) error {
+	afterID := 0
+	for {
+		batch, err := c.store.ListForHealthCheck(afterID, c.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, su := range batch {
+			select {
+			case jobs <- su:
+			case <-ctx.Done():
+				return nil
+			}
+			afterID = su.ID
+		}
+		if len(batch) < c.batchSize {
+			return nil
+		}
+	}
+}
+
+// Check requests the destination of su with HEAD, or GET when HEAD isn't
+// supported, and returns the new health of the link
+func (c *Checker) Check(ctx context.Context, su *models.ShortURL) models.HealthCheckResult {
+	u, err := url.Parse(su.OriginalURL)
+	if err == nil {
+		err = c.politeness.wait(ctx, strings.ToLower(u.Host))
+	}
+
+	start := c.now()
+	statusCode := 0
+	if err == nil {
+		statusCode, err = c.request(ctx, su.OriginalURL)
+	}
+
+	result := models.HealthCheckResult{
+		StatusCode: statusCode,
+		Latency:    c.now().Sub(start),
+		CheckedAt:  c.now(),
+	}
+
+	if err == nil && !failed(statusCode) {
+		result.Status = models.HealthHealthy
+		return result
+	}
+
+	result.Failures = su.HealthFailures + 1
+	switch {
+	case result.Failures >= c.failureThreshold:
+		result.Status = models.HealthBroken
+	case su.HealthStatus == "":
+		result.Status = models.HealthUnknown
+	default:
+		result.Status = su.HealthStatus
+	}
+	return result
+}
+
+func (c *Checker) request(ctx context.Context, rawURL string) (int, error) {
+	var statusCode int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("User-Agent", "url-shortener-health-check/1.0")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		statusCode = resp.StatusCode
+		if statusCode != http.StatusMethodNotAllowed && statusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	return statusCode, nil
+}
+
+// failed reports whether a status code means the destination is down. Access
+// restrictions and rate limits only show the server is up.
+func failed(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return statusCode >= 400
+}
+
+// politeness spaces out requests to the same host
+type politeness struct {
+	delay time.Duration
+	mu    sync.Mutex
+	next  map[string]time.Time
+}
+
+func newPoliteness(delay time.Duration) *politeness {
+	return &politeness{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait blocks until a request to host may be made and reserves the next slot
+func (p *politeness) wait(ctx context.Context, host string) error {
+	if p.delay <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	p.next[host] = at.Add(p.delay)
+	// Forget hosts whose slots are long past so the map doesn't grow forever
+	if len(p.next) > 10000 {
+		for h, t := range p.next {
+			if t.Before(now) {
+				delete(p.next, h)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	links   []*models.ShortURL
+	results map[int]models.HealthCheckResult
+}
+
+func (s *fakeStore) ListForHealthCheck(afterID, limit int) ([]*models.ShortURL, error) {
+	var batch []*models.ShortURL
+	for _, su := range s.links {
+		if su.ID > afterID && len(batch) < limit {
+			batch = append(batch, su)
+		}
+	}
+	return batch, nil
+}
+
+func (s *fakeStore) UpdateHealth(id int, result models.HealthCheckResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = result
+	return nil
+}
+
+func TestCheckAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	store := &fakeStore{results: make(map[int]models.HealthCheckResult)}
+	for i, tc := range []struct {
+		path     string
+		failures int
+		status   models.HealthStatus
+	}{
+		{"/ok", 3, models.HealthBroken},
+		{"/get-only", 0, models.HealthUnknown},
+		{"/forbidden", 0, models.HealthUnknown},
+		{"/moved", 0, models.HealthUnknown},
+		{"/gone", 0, models.HealthHealthy},
+		{"/error", 1, models.HealthHealthy},
+	} {
+		store.links = append(store.links, &models.ShortURL{
+			ID:             i + 1,
+			OriginalURL:    server.URL + tc.path,
+			HealthFailures: tc.failures,
+			HealthStatus:   tc.status,
+		})
+	}
+
+	checker := NewChecker(store, client, config.HealthCheckConfig{
+		Concurrency:      3,
+		BatchSize:        2,
+		FailureThreshold: 2,
+	})
+	broken, err := checker.CheckAll(context.Background())
+	if err != nil {
+		t.Fatalf("CheckAll() error = %v", err)
+	}
+
+	want := map[int]struct {
+		status   models.HealthStatus
+		failures int
+	}{
+		1: {models.HealthHealthy, 0},
+		2: {models.HealthHealthy, 0},
+		3: {models.HealthHealthy, 0},
+		4: {models.HealthHealthy, 0},
+		5: {models.HealthHealthy, 1}, // below the threshold the status is kept
+		6: {models.HealthBroken, 2},
+	}
+	if len(store.results) != len(want) {
+		t.Fatalf("checked %d links, want %d", len(store.results), len(want))
+	}
+	for id, w := range want {
+		got := store.results[id]
+		if got.Status != w.status || got.Failures != w.failures {
+			t.Errorf("link %d: got status %q with %d failures, want %q with %d", id, got.Status, got.Failures, w.status, w.failures)
+		}
+	}
+	if broken != 1 {
+		t.Errorf("broken = %d, want 1", broken)
+	}
+}
+
+func TestPolitenessSpacesRequestsPerHost(t *testing.T) {
+	p := newPoliteness(50 * time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.wait(ctx, "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("three requests to one host took %v, want at least 100ms", elapsed)
+	}
+
+	start = time.Now()
+	if err := p.wait(ctx, "example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("request to another host waited %v", elapsed)
+	}
+}
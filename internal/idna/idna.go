@@ -0,0 +1,61 @@
+// Package idna converts internationalized domain names between their Unicode
+// and ASCII (Punycode) forms.
+package idna
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// acePrefix marks a label encoded with Punycode
+const acePrefix = "xn--"
+
+// labelSeparators are the dots IDNA treats as label separators
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII returns the ASCII form of a domain name: labels are lowercased,
+// NFKC normalized, which folds fullwidth and compatibility characters as
+// browsers do, and Punycode encoded when they contain non-ASCII characters.
+func ToASCII(host string) (string, error) {
+	labels := strings.Split(labelSeparators.Replace(host), ".")
+	for i, label := range labels {
+		label = norm.NFKC.String(strings.ToLower(label))
+		if isASCII(label) {
+			labels[i] = label
+			continue
+		}
+		encoded, err := encodePunycode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = acePrefix + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode returns the Unicode form of a domain name by decoding its
+// Punycode labels
+func ToUnicode(host string) (string, error) {
+	labels := strings.Split(strings.ToLower(host), ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, acePrefix) {
+			continue
+		}
+		decoded, err := decodePunycode(label[len(acePrefix):])
+		if err != nil {
+			return "", err
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package idna
+
+import "testing"
+
+func TestPunycode(t *testing.T) {
+	tests := []struct {
+		unicode string
+		encoded string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"пример", "e1afmkfd"},
+		{"中国", "fiqs8s"},
+		{"ñ", "ida"},
+		// RFC 3492 section 7.1 (B) Chinese (simplified)
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+		// RFC 3492 section 7.1 (L) 3<nen>B<gumi><kinpachi><sensei>
+		{"3年b組金八先生", "3b-ww4c5e180e575a65lsy2b"},
+	}
+
+	for _, tt := range tests {
+		got, err := encodePunycode(tt.unicode)
+		if err != nil || got != tt.encoded {
+			t.Errorf("encodePunycode(%q) = %q, %v, want %q", tt.unicode, got, err, tt.encoded)
+		}
+		back, err := decodePunycode(tt.encoded)
+		if err != nil || back != tt.unicode {
+			t.Errorf("decodePunycode(%q) = %q, %v, want %q", tt.encoded, back, err, tt.unicode)
+		}
+	}
+
+	for _, bad := range []string{"a-é", "99999999999", "-!"} {
+		if _, err := decodePunycode(bad); err == nil {
+			t.Errorf("decodePunycode(%q) accepted invalid input", bad)
+		}
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Example.COM", "example.com"},
+		{"Bücher.example", "xn--bcher-kva.example"},
+		{"bu\u0308cher.example", "xn--bcher-kva.example"}, // decomposed ü
+		{"пример。рф", "xn--e1afmkfd.xn--p1ai"},
+		{"ｅｘａｍｐｌｅ.com", "example.com"},
+	}
+
+	for _, tt := range tests {
+		got, err := ToASCII(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ToASCII(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	got, err := ToUnicode("www.XN--e1afmkfd.xn--p1ai")
+	if err != nil || got != "www.пример.рф" {
+		t.Errorf("ToUnicode() = %q, %v", got, err)
+	}
+}
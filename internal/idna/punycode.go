@@ -0,0 +1,186 @@
+package idna
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bootstring parameters for Punycode, RFC 3492 section 5
+const (
+	base        = 36
+	tMin        = 1
+	tMax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+	maxRune     = utf8.MaxRune
+)
+
+var errPunycode = errors.New("idna: invalid punycode")
+
+// encodePunycode encodes a Unicode label to Punycode without the "xn--" prefix
+func encodePunycode(label string) (string, error) {
+	runes := []rune(label)
+	var out strings.Builder
+
+	basic := 0
+	for _, r := range runes {
+		if r < 0x80 {
+			out.WriteRune(r)
+			basic++
+		}
+	}
+	handled := basic
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := rune(initialN), 0, initialBias
+	for handled < len(runes) {
+		m := rune(maxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (maxInt-delta)/(handled+1) {
+			return "", errPunycode
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+				if delta < 0 {
+					return "", errPunycode
+				}
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := threshold(k, bias)
+				if q < t {
+					break
+				}
+				out.WriteByte(digit(t + (q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out.WriteByte(digit(q))
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+
+	return out.String(), nil
+}
+
+// decodePunycode decodes a Punycode label without the "xn--" prefix
+func decodePunycode(encoded string) (string, error) {
+	var output []rune
+	pos := 0
+	if i := strings.LastIndexByte(encoded, '-'); i >= 0 {
+		for _, r := range encoded[:i] {
+			if r >= 0x80 {
+				return "", errPunycode
+			}
+			output = append(output, r)
+		}
+		pos = i + 1
+	}
+
+	n, i, bias := rune(initialN), 0, initialBias
+	for pos < len(encoded) {
+		oldI, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(encoded) {
+				return "", errPunycode
+			}
+			d, ok := value(encoded[pos])
+			pos++
+			if !ok || d > (maxInt-i)/w {
+				return "", errPunycode
+			}
+			i += d * w
+			t := threshold(k, bias)
+			if d < t {
+				break
+			}
+			if w > maxInt/(base-t) {
+				return "", errPunycode
+			}
+			w *= base - t
+		}
+
+		length := len(output) + 1
+		bias = adapt(i-oldI, length, oldI == 0)
+		if i/length > int(maxRune-n) {
+			return "", errPunycode
+		}
+		n += rune(i / length)
+		i %= length
+		if n < 0x80 || (n >= 0xD800 && n <= 0xDFFF) {
+			return "", errPunycode
+		}
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+
+	return string(output), nil
+}
+
+const maxInt = int(^uint32(0) >> 1)
+
+func threshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return tMin
+	case k >= bias+tMax:
+		return tMax
+	}
+	return k - bias
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((base-tMin)*tMax)/2 {
+		delta /= base - tMin
+		k += base
+	}
+	return k + (base-tMin+1)*delta/(delta+skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func value(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	}
+	return 0, false
+}
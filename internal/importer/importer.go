@@ -0,0 +1,292 @@
+// Package importer imports links from CSV and NDJSON files in the background
+// and records the outcome of every row.
+package importer
+
+import (
+	"net/url"
+	"strconv"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+	"url_shortener/internal/threatlist"
+	"url_shortener/internal/urlcheck"
+	"url_shortener/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// LinkStore is the part of the short URL repository used by the importer
+type LinkStore interface {
+	CreateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error)
+}
+
+// JobStore keeps the progress and row results of import jobs
+type JobStore interface {
+	StartJob(id int) error
+	RecordResults(id int, results []*models.ImportRowResult) error
+	FinishJob(id int, status models.ImportStatus, errMsg string) error
+}
+
+// maxCodeAttempts is how many short codes are generated for a row before
+// giving up because they were all taken
+const maxCodeAttempts = 3
+
+// Importer runs import jobs, at most a configured number at a time. Rows are
+// checked with the local destination checks (ValidateURL, the URL validator's
+// checks that don't need DNS, the own domains, the threat feeds and the
+// homograph detector); DNS and shortener lookups are skipped since a file can
+// hold hundreds of thousands of rows, so links of known shorteners are
+// rejected instead of resolved.
+type Importer struct {
+	links      LinkStore
+	jobs       JobStore
+	validator  *urlcheck.Validator
+	redirects  *urlcheck.RedirectChecker
+	threats    *threatlist.List
+	homographs *urlcheck.HomographDetector
+	chunkSize  int
+	slots      chan struct{}
+}
+
+// New creates an Importer
+func New(links LinkStore, jobs JobStore, validator *urlcheck.Validator, redirects *urlcheck.RedirectChecker, threats *threatlist.List, homographs *urlcheck.HomographDetector, cfg config.ImportConfig) *Importer {
+	i := &Importer{
+		links:      links,
+		jobs:       jobs,
+		validator:  validator,
+		redirects:  redirects,
+		threats:    threats,
+		homographs: homographs,
+		chunkSize:  cfg.ChunkSize,
+	}
+	if i.chunkSize <= 0 {
+		i.chunkSize = 500
+	}
+	concurrency := cfg.MaxConcurrentJobs
+	if concurrency <= 0 {
+		concurrency = 2
+	}
+	i.slots = make(chan struct{}, concurrency)
+	return i
+}
+
+// Job is an import job along with what's needed to run it
+type Job struct {
+	*models.ImportJob
+	Rows           []Row
+	TrackingParams []string // stripped from destinations
+	Audit          models.AuditContext
+}
+
+// Start runs the job in the background once a slot is free
+func (i *Importer) Start(job Job) {
+	go func() {
+		i.slots <- struct{}{}
+		defer func() { <-i.slots }()
+		i.run(job)
+	}()
+}
+
+func (i *Importer) run(job Job) {
+	log := logger.GetLogger().With(zap.Int("import_job_id", job.ID))
+
+	status, errMsg := models.ImportCompleted, ""
+	if err := i.jobs.StartJob(job.ID); err != nil {
+		log.Error("Failed to start import job", zap.Error(err))
+		status, errMsg = models.ImportFailed, "Internal error, no rows were imported"
+		job.Rows = nil
+	}
+
+	for start := 0; start < len(job.Rows); start += i.chunkSize {
+		end := start + i.chunkSize
+		if end > len(job.Rows) {
+			end = len(job.Rows)
+		}
+
+		results, err := i.importChunk(job, job.Rows[start:end])
+		if err == nil {
+			err = i.jobs.RecordResults(job.ID, results)
+		}
+		if err != nil {
+			log.Error("Import job failed", zap.Error(err), zap.Int("line", job.Rows[start].Line))
+			status, errMsg = models.ImportFailed, "Internal error, rows from line "+strconv.Itoa(job.Rows[start].Line)+" on were not imported"
+			break
+		}
+	}
+
+	if err := i.jobs.FinishJob(job.ID, status, errMsg); err != nil {
+		log.Error("Failed to finish import job", zap.Error(err))
+	}
+}
+
+// importChunk imports rows with one multi-row insert per attempt and returns
+// their results in order
+func (i *Importer) importChunk(job Job, rows []Row) ([]*models.ImportRowResult, error) {
+	results := make([]*models.ImportRowResult, len(rows))
+	shortURLs := make([]*models.ShortURL, len(rows))
+	var pending []int
+	for n, row := range rows {
+		results[n] = &models.ImportRowResult{Line: row.Line, RequestedCode: row.ShortCode}
+		su, msg := i.prepare(job, row)
+		if msg != "" {
+			results[n].Status = models.ImportRowFailed
+			results[n].Error = msg
+			continue
+		}
+		shortURLs[n] = su
+		pending = append(pending, n)
+	}
+
+	// Rows whose code is taken get a new one and another try, or fail
+	for attempt := 1; len(pending) > 0; attempt++ {
+		chunk := make([]*models.ShortURL, len(pending))
+		for j, n := range pending {
+			chunk[j] = shortURLs[n]
+		}
+		errs, err := i.links.CreateBatch(chunk, job.Audit)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for j, n := range pending {
+			result := results[n]
+			switch {
+			case errs[j] == nil:
+				result.Status = models.ImportRowCreated
+				result.ShortCode = shortURLs[n].ShortCode
+			case job.OnConflict == models.ImportConflictSkip || attempt == maxCodeAttempts:
+				result.Status = models.ImportRowFailed
+				result.Error = "short code already taken"
+			default:
+				code, err := utils.GenerateSecureShortCode(6)
+				if err != nil {
+					return nil, err
+				}
+				shortURLs[n].ShortCode = code
+				retry = append(retry, n)
+			}
+		}
+		pending = retry
+	}
+
+	return results, nil
+}
+
+// prepare builds the link of a row. It returns the reason if the row can't
+// be imported.
+func (i *Importer) prepare(job Job, row Row) (*models.ShortURL, string) {
+	if row.Err != "" {
+		return nil, row.Err
+	}
+	if row.URL == "" {
+		return nil, "url is required"
+	}
+
+	su := &models.ShortURL{
+		UserID:      job.UserID,
+		WorkspaceID: job.WorkspaceID,
+		OriginalURL: models.SanitizeURL(row.URL, job.TrackingParams),
+		ExpiresAt:   row.ExpiresAt,
+	}
+
+	dest, msg := i.check(su.OriginalURL)
+	if msg != "" {
+		return nil, msg
+	}
+	if dest.suspicious != "" {
+		if i.homographs.Rejects() {
+			return nil, dest.suspicious
+		}
+		su.FlagReason = dest.suspicious
+	}
+	su.CanonicalURLHash = models.CanonicalURLHash(dest.canonical)
+	su.UnicodeHost = dest.unicodeHost
+
+	if row.FallbackURL != "" {
+		fallback, msg := i.check(row.FallbackURL)
+		// Nobody reviews fallbacks, so a suspicious host is rejected
+		if msg == "" {
+			msg = fallback.suspicious
+		}
+		if msg != "" {
+			return nil, "fallback_url: " + msg
+		}
+		su.FallbackURL = row.FallbackURL
+	}
+
+	switch code := row.ShortCode; {
+	case code == "":
+	case !validShortCode(code):
+		if job.OnConflict == models.ImportConflictSkip {
+			return nil, "short code must be 3 to 10 letters, digits, '-' or '_' and not reserved"
+		}
+	default:
+		su.ShortCode = code
+	}
+	if su.ShortCode == "" {
+		code, err := utils.GenerateSecureShortCode(6)
+		if err != nil {
+			return nil, "failed to generate short code"
+		}
+		su.ShortCode = code
+	}
+
+	return su, ""
+}
+
+// checkedURL is a URL that passed the local checks
+type checkedURL struct {
+	canonical   string
+	unicodeHost string
+	suspicious  string // why the host looks like a spoof, if it does
+}
+
+// check runs the local destination checks on rawURL. It returns the reason
+// if the URL is rejected.
+func (i *Importer) check(rawURL string) (checkedURL, string) {
+	if err := models.ValidateURL(rawURL); err != nil {
+		return checkedURL{}, rejection(err)
+	}
+	canonical, err := models.CanonicalizeURL(rawURL)
+	if err != nil {
+		return checkedURL{}, "Invalid URL format"
+	}
+	if err := i.validator.ValidateStatic(canonical); err != nil {
+		return checkedURL{}, rejection(err)
+	}
+	if err := i.redirects.CheckHost(canonical); err != nil {
+		return checkedURL{}, rejection(err)
+	}
+	if match, ok := i.threats.Check(canonical); ok {
+		return checkedURL{}, "URL is listed as a " + match.Feed + " threat"
+	}
+
+	c := checkedURL{canonical: canonical}
+	if parsed, err := url.Parse(canonical); err == nil {
+		c.unicodeHost, c.suspicious = i.homographs.Check(parsed.Hostname())
+	}
+	return c, ""
+}
+
+// rejection returns the message of a *models.ValidationError
+func rejection(err error) string {
+	if validationErr, ok := err.(*models.ValidationError); ok {
+		return validationErr.Message
+	}
+	return "Invalid URL"
+}
+
+// validShortCode reports whether a short code from a file can be kept
+func validShortCode(code string) bool {
+	if len(code) < 3 || len(code) > 10 || models.ReservedShortCode(code) {
+		return false
+	}
+	for _, c := range code {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
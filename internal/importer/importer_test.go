@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+	"url_shortener/internal/threatlist"
+	"url_shortener/internal/urlcheck"
+)
+
+func TestParseCSV(t *testing.T) {
+	file := "\ufeffShort_Code,Original_URL,Fallback_URL,Expires_At,Access_Count\n" +
+		"abc123,https://example.com/a,,2030-01-02T03:04:05Z,7\n" +
+		"\n" +
+		",\"https://example.com/b,c\",https://example.com/fallback,,\n" +
+		"def,https://example.com/d,,tomorrow,\n"
+
+	rows, err := Parse(models.ImportCSV, strings.NewReader(file), 10)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	if r := rows[0]; r.Line != 2 || r.ShortCode != "abc123" || r.URL != "https://example.com/a" || r.ExpiresAt == nil || r.ExpiresAt.Year() != 2030 {
+		t.Errorf("row 0 = %+v", r)
+	}
+	if r := rows[1]; r.Line != 4 || r.ShortCode != "" || r.URL != "https://example.com/b,c" || r.FallbackURL != "https://example.com/fallback" {
+		t.Errorf("row 1 = %+v", r)
+	}
+	if r := rows[2]; r.Err == "" {
+		t.Errorf("row 2 with an invalid expiry has no error: %+v", r)
+	}
+}
+
+func TestParseBitly(t *testing.T) {
+	file := "Title,Long URL,Bitlink,Created\n" +
+		"Home,https://example.com/,https://bit.ly/3xYz9Ab,2020-01-01\n"
+
+	rows, err := Parse(models.ImportBitly, strings.NewReader(file), 10)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(rows) != 1 || rows[0].URL != "https://example.com/" || rows[0].ShortCode != "3xYz9Ab" {
+		t.Errorf("rows = %+v", rows)
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	file := `{"shortCode":"abc123","originalUrl":"https://example.com/a","accessCount":3}` + "\n" +
+		"\n" +
+		`{"url":"https://example.com/b"}` + "\n" +
+		"not json\n"
+
+	rows, err := Parse(models.ImportNDJSON, strings.NewReader(file), 10)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if r := rows[0]; r.Line != 1 || r.ShortCode != "abc123" || r.URL != "https://example.com/a" {
+		t.Errorf("row 0 = %+v", r)
+	}
+	if r := rows[1]; r.Line != 3 || r.URL != "https://example.com/b" {
+		t.Errorf("row 1 = %+v", r)
+	}
+	if r := rows[2]; r.Line != 4 || r.Err != "invalid JSON" {
+		t.Errorf("row 2 = %+v", r)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format models.ImportFormat
+		file   string
+		want   error
+	}{
+		{"missing url column", models.ImportCSV, "short_code\nabc\n", &ParseError{}},
+		{"bad quoting", models.ImportCSV, "url\n\"https://example.com\n", &ParseError{}},
+		{"empty", models.ImportCSV, "", &ParseError{}},
+		{"too many rows", models.ImportCSV, "url\nhttps://a.example\nhttps://b.example\nhttps://c.example\n", ErrTooManyRows},
+		{"too many ndjson rows", models.ImportNDJSON, "{}\n{}\n{}\n", ErrTooManyRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.format, strings.NewReader(tt.file), 2)
+			var parseErr *ParseError
+			if _, ok := tt.want.(*ParseError); ok {
+				if !errors.As(err, &parseErr) {
+					t.Errorf("err = %v, want a *ParseError", err)
+				}
+			} else if err != tt.want {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+type fakeLinks struct {
+	taken map[string]bool
+}
+
+func (l *fakeLinks) CreateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error) {
+	errs := make([]error, len(shortURLs))
+	for i, su := range shortURLs {
+		if l.taken[su.ShortCode] {
+			errs[i] = errors.New("taken")
+			continue
+		}
+		l.taken[su.ShortCode] = true
+	}
+	return errs, nil
+}
+
+type fakeJobs struct {
+	results []*models.ImportRowResult
+	status  models.ImportStatus
+}
+
+func (j *fakeJobs) StartJob(id int) error { return nil }
+
+func (j *fakeJobs) RecordResults(id int, results []*models.ImportRowResult) error {
+	j.results = append(j.results, results...)
+	return nil
+}
+
+func (j *fakeJobs) FinishJob(id int, status models.ImportStatus, errMsg string) error {
+	j.status = status
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	threats, err := threatlist.New(config.ThreatListConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	homographs := urlcheck.NewHomographDetector(config.HomographConfig{Action: "flag"})
+	validator := urlcheck.New(config.URLValidationConfig{DeniedDomains: []string{"evil.example.com"}}, nil)
+	redirects := urlcheck.NewRedirectChecker(config.RedirectCheckConfig{OwnDomains: []string{"sho.rt"}, KnownShorteners: []string{"bit.ly"}}, nil, validator)
+
+	rows := []Row{
+		{Line: 2, URL: "https://example.com/a", ShortCode: "free1"},
+		{Line: 3, URL: "https://example.com/b", ShortCode: "taken"},
+		{Line: 4, URL: "ftp://example.com/c"},
+		{Line: 5, URL: "https://example.com/d", ShortCode: "no/slashes"},
+		{Line: 6, URL: "https://example.com/e", FallbackURL: "javascript:alert(1)"},
+		{Line: 7, URL: "https://example.com/f", ShortCode: "free1"},
+		{Line: 8, URL: "http://10.0.0.1/admin"},
+		{Line: 9, URL: "http://0x7f000001/"},
+		{Line: 10, URL: "https://www.evil.example.com/"},
+		{Line: 11, URL: "https://sho.rt/abc"},
+		{Line: 12, URL: "https://example.com/g", FallbackURL: "http://localhost/"},
+		{Line: 13, URL: "https://bit.ly/3xYz9Ab"},
+		{Line: 14, URL: "https://example.com/h", FallbackURL: "https://BIT.LY./abc"},
+	}
+
+	for _, tt := range []struct {
+		onConflict models.ImportConflict
+		want       []models.ImportRowStatus
+	}{
+		{models.ImportConflictGenerate, []models.ImportRowStatus{"created", "created", "failed", "created", "failed", "created", "failed", "failed", "failed", "failed", "failed", "failed", "failed"}},
+		{models.ImportConflictSkip, []models.ImportRowStatus{"created", "failed", "failed", "failed", "failed", "failed", "failed", "failed", "failed", "failed", "failed", "failed", "failed"}},
+	} {
+		t.Run(string(tt.onConflict), func(t *testing.T) {
+			links := &fakeLinks{taken: map[string]bool{"taken": true}}
+			jobs := &fakeJobs{}
+			i := New(links, jobs, validator, redirects, threats, homographs, config.ImportConfig{ChunkSize: 4})
+
+			i.run(Job{
+				ImportJob: &models.ImportJob{ID: 1, UserID: 1, OnConflict: tt.onConflict},
+				Rows:      rows,
+			})
+
+			if jobs.status != models.ImportCompleted {
+				t.Errorf("status = %q", jobs.status)
+			}
+			if len(jobs.results) != len(rows) {
+				t.Fatalf("got %d results, want %d", len(jobs.results), len(rows))
+			}
+			for n, res := range jobs.results {
+				if res.Line != rows[n].Line || res.Status != tt.want[n] {
+					t.Errorf("result %d = %+v, want status %q", n, res, tt.want[n])
+				}
+			}
+
+			first := jobs.results[0]
+			if first.ShortCode != "free1" || first.RequestedCode != "free1" {
+				t.Errorf("free code not kept: %+v", first)
+			}
+			if res := jobs.results[11]; !strings.Contains(res.Error, "another URL shortener") {
+				t.Errorf("shortener not rejected: %+v", res)
+			}
+			if tt.onConflict == models.ImportConflictGenerate {
+				if res := jobs.results[1]; res.ShortCode == "" || res.ShortCode == "taken" {
+					t.Errorf("taken code not replaced: %+v", res)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+// ErrTooManyRows is returned by Parse for files with more rows than allowed
+var ErrTooManyRows = errors.New("too many rows")
+
+// ParseError is a problem with the structure of a file, as opposed to a row
+// that can't be imported
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Row is a link read from an import file. Err is set when the row can't be
+// imported no matter what, e.g. an unreadable NDJSON line.
+type Row struct {
+	Line        int
+	URL         string
+	ShortCode   string
+	FallbackURL string
+	ExpiresAt   *time.Time
+	Err         string
+}
+
+// csvColumns maps the normalized header names of each CSV format to the
+// fields of a row. The first matching column of a field is used.
+var csvColumns = map[models.ImportFormat]map[string][]string{
+	models.ImportCSV: {
+		"url":          {"original_url", "url"},
+		"short_code":   {"short_code"},
+		"fallback_url": {"fallback_url"},
+		"expires_at":   {"expires_at"},
+	},
+	// Bitly exports the full short link, e.g. bit.ly/abc123, of which the
+	// last path segment is kept
+	models.ImportBitly: {
+		"url":        {"long_url", "long_link", "destination_url"},
+		"short_code": {"bitlink", "link", "short_url", "short_link"},
+	},
+}
+
+// Parse reads the rows of an import file. It fails with ErrTooManyRows if the
+// file has more than maxRows rows, and with a *ParseError if it isn't a file
+// of the format.
+func Parse(format models.ImportFormat, r io.Reader, maxRows int) ([]Row, error) {
+	if format == models.ImportNDJSON {
+		return parseNDJSON(r, maxRows)
+	}
+	return parseCSV(r, csvColumns[format], maxRows)
+}
+
+func parseCSV(r io.Reader, columns map[string][]string, maxRows int) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, &ParseError{Line: 1, Msg: "missing header"}
+	} else if err != nil {
+		return nil, csvError(err)
+	}
+
+	// Column names are compared case-insensitively with spaces as underscores
+	position := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // byte order mark
+		}
+		name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+		if _, ok := position[name]; !ok {
+			position[name] = i
+		}
+	}
+	index := map[string]int{}
+	for field, names := range columns {
+		index[field] = -1
+		for _, name := range names {
+			if i, ok := position[name]; ok {
+				index[field] = i
+				break
+			}
+		}
+	}
+	if index["url"] < 0 {
+		return nil, &ParseError{Line: 1, Msg: "missing column " + columns["url"][0]}
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, csvError(err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, ErrTooManyRows
+		}
+
+		line, _ := cr.FieldPos(0)
+		value := func(field string) string {
+			if i, ok := index[field]; ok && i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := Row{
+			Line:        line,
+			URL:         value("url"),
+			ShortCode:   value("short_code"),
+			FallbackURL: value("fallback_url"),
+		}
+		if i := strings.LastIndex(row.ShortCode, "/"); i >= 0 {
+			row.ShortCode = row.ShortCode[i+1:]
+		}
+		if v := value("expires_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				row.Err = "expires_at must be an RFC 3339 time"
+			} else {
+				row.ExpiresAt = &t
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &ParseError{Line: parseErr.Line, Msg: parseErr.Err.Error()}
+	}
+	return err
+}
+
+// ndjsonRow is a line of an NDJSON file, a short URL as exported. url is
+// accepted in place of originalUrl.
+type ndjsonRow struct {
+	OriginalURL string     `json:"originalUrl"`
+	URL         string     `json:"url"`
+	ShortCode   string     `json:"shortCode"`
+	FallbackURL string     `json:"fallbackUrl"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// maxLineBytes limits the length of an NDJSON line
+const maxLineBytes = 64 * 1024
+
+func parseNDJSON(r io.Reader, maxRows int) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineBytes)
+
+	var rows []Row
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, ErrTooManyRows
+		}
+
+		row := Row{Line: line}
+		var v ndjsonRow
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			row.Err = "invalid JSON"
+		} else {
+			row.URL = strings.TrimSpace(v.OriginalURL)
+			if row.URL == "" {
+				row.URL = strings.TrimSpace(v.URL)
+			}
+			row.ShortCode = strings.TrimSpace(v.ShortCode)
+			row.FallbackURL = strings.TrimSpace(v.FallbackURL)
+			row.ExpiresAt = v.ExpiresAt
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, &ParseError{Line: line + 1, Msg: "line too long"}
+	} else if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -38,6 +39,48 @@ var (
 		Name: "url_shortener_rate_limit_exceeded_total",
 		Help: "Total number of rate limit exceeded events",
 	}, []string{"ip"})
+
+	// LoginFailures tracks rejected login attempts by reason
+	LoginFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "url_shortener_login_failures_total",
+		Help: "Total number of rejected login attempts",
+	}, []string{"reason"})
+
+	// LoginLockouts tracks temporary lockouts triggered by repeated login failures
+	LoginLockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "url_shortener_login_lockouts_total",
+		Help: "Total number of login lockouts",
+	}, []string{"scope"})
+
+	// ThreatListHits tracks destinations matched by a threat feed
+	ThreatListHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "url_shortener_threat_list_hits_total",
+		Help: "Total number of destinations matched by a threat feed",
+	}, []string{"feed", "stage"})
+
+	// LinkReports tracks abuse reports by reason
+	LinkReports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "url_shortener_link_reports_total",
+		Help: "Total number of abuse reports received",
+	}, []string{"reason"})
+
+	// LinkSuspensions tracks links suspended automatically after abuse reports
+	LinkSuspensions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "url_shortener_link_suspensions_total",
+		Help: "Total number of links suspended automatically after abuse reports",
+	})
+
+	// BrokenLinks tracks the number of links whose destination is down
+	BrokenLinks = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "url_shortener_broken_links",
+		Help: "Number of links whose destination failed its latest health checks",
+	})
+
+	// MFAResets tracks two-factor authentication resets performed by admins
+	MFAResets = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "url_shortener_mfa_resets_total",
+		Help: "Total number of two-factor authentication resets by admins",
+	})
 )
 
 // URLAccess represents a URL access event
@@ -66,7 +109,7 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 		RequestDuration.WithLabelValues(
 			r.URL.Path,
 			r.Method,
-			string(rw.statusCode),
+			strconv.Itoa(rw.statusCode),
 		).Observe(duration.Seconds())
 	})
 }
@@ -90,6 +133,12 @@ func (rw *ResponseWriter) StatusCode() int {
 	return rw.statusCode
 }
 
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can
+// flush and set deadlines
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // RecordURLAccess records metrics for a URL access
 func RecordURLAccess(access *URLAccess) {
 	URLAccessCount.WithLabelValues(access.ShortCode).Inc()
@@ -109,3 +158,37 @@ func RecordCacheMiss() {
 func RecordRateLimitExceeded(ip string) {
 	RateLimitExceeded.WithLabelValues(ip).Inc()
 }
+
+// RecordLoginFailure records a rejected login attempt
+func RecordLoginFailure(reason string) {
+	LoginFailures.WithLabelValues(reason).Inc()
+}
+
+// RecordLoginLockout records a lockout of a username or an IP
+func RecordLoginLockout(scope string) {
+	LoginLockouts.WithLabelValues(scope).Inc()
+}
+
+// RecordMFAReset records an admin reset of a user's two-factor authentication
+func RecordMFAReset() {
+	MFAResets.Inc()
+}
+
+// RecordThreatListHit records a destination matched by a threat feed when it
+// was submitted or when it was redirected to
+func RecordThreatListHit(feed, stage string) {
+	ThreatListHits.WithLabelValues(feed, stage).Inc()
+}
+
+// SetBrokenLinks records the number of broken links found by a health check run
+func SetBrokenLinks(n int) {
+	BrokenLinks.Set(float64(n))
+}
+
+// RecordLinkReport records an abuse report and whether it suspended the link
+func RecordLinkReport(reason string, suspended bool) {
+	LinkReports.WithLabelValues(reason).Inc()
+	if suspended {
+		LinkSuspensions.Inc()
+	}
+}
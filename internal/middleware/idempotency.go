@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+	"url_shortener/internal/problem"
+)
+
+const (
+	// IdempotencyKeyHeader makes a POST safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a retry
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyStore keeps the requests and responses of Idempotency-Keys.
+// ReserveIdempotencyKey must be atomic: of several concurrent calls for a key
+// only one may return a nil record.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, error)
+	SaveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) error
+	ReleaseIdempotencyKey(key string) error
+}
+
+// IdempotencyMiddleware replays the stored response when a request is retried
+// with the same Idempotency-Key, so a retry doesn't create a second link. A
+// key used for a different request is answered with 422 and a key whose
+// request is still running with 409. Keys are per user, so the middleware
+// must run after AuthMiddleware. Requests without the header, and responses
+// with a 5xx status, are not stored. Of responses larger than
+// MaxResponseBytes only the status is stored, and retries are answered with
+// 409 since they can't be replayed.
+//
+// Responses are held back until they are stored, so that a response that
+// can't be stored is replaced by a 500 rather than leaving the next retry to
+// run the request again. Large and flushed responses are passed through as
+// they are written.
+func IdempotencyMiddleware(store IdempotencyStore, cfg config.IdempotencyConfig) func(http.Handler) http.Handler {
+	ttl := time.Duration(cfg.TTLHours) * time.Hour
+	lockTTL := time.Duration(cfg.LockSeconds) * time.Second
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Idempotency-Key must be 1 to 255 printable ASCII characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "Request body is too large")
+				} else {
+					problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+				}
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			userID, _ := UserIDFromContext(r.Context())
+			storeKey := strconv.Itoa(userID) + ":" + key
+			fingerprint := requestFingerprint(r, body)
+
+			existing, err := store.ReserveIdempotencyKey(storeKey, &models.IdempotencyRecord{Fingerprint: fingerprint}, lockTTL)
+			if err != nil {
+				problem.Internal(w, r, "Failed to reserve idempotency key", err)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyUsed, "Idempotency-Key was already used for a different request")
+				case !existing.Completed():
+					w.Header().Set("Retry-After", "1")
+					problem.Write(w, r, http.StatusConflict, problem.CodeRequestInProgress, "A request with this Idempotency-Key is still in progress")
+				case existing.Truncated:
+					problem.Write(w, r, http.StatusConflict, problem.CodeConflict, fmt.Sprintf("A request with this Idempotency-Key already completed with status %d, its response was too large to replay", existing.Status))
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := &recordingWriter{ResponseWriter: w, max: cfg.MaxResponseBytes}
+			defer func() {
+				// A panicking handler must not leave the key reserved
+				if p := recover(); p != nil {
+					store.ReleaseIdempotencyKey(storeKey)
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.WriteHeader(http.StatusOK)
+			}
+
+			log := logger.GetLogger().With(zap.String("request_id", RequestIDFromContext(r.Context())))
+			if rec.status >= 500 {
+				if err := store.ReleaseIdempotencyKey(storeKey); err != nil {
+					log.Error("Failed to release idempotency key", zap.Error(err))
+				}
+				rec.finish()
+				return
+			}
+
+			stored := &models.IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Header:      rec.header,
+			}
+			if rec.streaming {
+				stored.Truncated = true
+			} else {
+				stored.Body = rec.body.Bytes()
+			}
+			if err := store.SaveIdempotencyKey(storeKey, stored, ttl); err != nil {
+				if rec.streaming {
+					log.Error("Failed to store idempotent response", zap.Error(err))
+					return
+				}
+				// The key stays reserved until lockTTL, so a retry before
+				// then isn't run again either
+				for name := range w.Header() {
+					if name != RequestIDHeader {
+						w.Header().Del(name)
+					}
+				}
+				problem.Internal(w, r, "Failed to store idempotent response", err)
+				return
+			}
+			rec.finish()
+		})
+	}
+}
+
+// validIdempotencyKey accepts up to 255 printable ASCII characters, enough
+// for UUIDs and most client generated keys
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint identifies a request by its method, path, query and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes a stored response
+func replay(w http.ResponseWriter, rec *models.IdempotencyRecord) {
+	for name, values := range rec.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recordingWriter holds a response back until finish is called, keeping up
+// to max bytes of body. Once the body grows larger or the response is
+// flushed, it is passed through as it is written instead.
+type recordingWriter struct {
+	http.ResponseWriter
+	max       int
+	status    int
+	header    http.Header
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status != 0 {
+		return
+	}
+	rw.status = status
+	// Every response keeps its own request ID
+	rw.header = rw.Header().Clone()
+	rw.header.Del(RequestIDHeader)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.streaming && rw.body.Len()+len(b) > rw.max {
+		if err := rw.stream(); err != nil {
+			return 0, err
+		}
+	}
+	if rw.streaming {
+		return rw.ResponseWriter.Write(b)
+	}
+	return rw.body.Write(b)
+}
+
+// Flush sends the response so far and passes the rest through
+func (rw *recordingWriter) Flush() {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.streaming {
+		rw.stream()
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// finish sends the response if it was held back
+func (rw *recordingWriter) finish() {
+	if !rw.streaming {
+		rw.stream()
+	}
+}
+
+// stream sends the status and the body held back and switches to passing
+// the response through
+func (rw *recordingWriter) stream() error {
+	rw.streaming = true
+	rw.ResponseWriter.WriteHeader(rw.status)
+	_, err := rw.ResponseWriter.Write(rw.body.Bytes())
+	rw.body.Reset()
+	return err
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can
+// flush and set deadlines
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
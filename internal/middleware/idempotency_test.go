@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) ReserveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[key]; ok {
+		return &existing, nil
+	}
+	s.records[key] = *rec
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) SaveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = *rec
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseIdempotencyKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]models.IdempotencyRecord{}}
+	var calls int32
+	status := http.StatusCreated
+	handler := IdempotencyMiddleware(store, config.IdempotencyConfig{TTLHours: 1, LockSeconds: 60, MaxResponseBytes: 1024})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"call":` + string(rune('0'+n)) + `}`))
+		}),
+	)
+
+	do := func(userID int, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), UserIDKey, userID))
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := do(1, "key-1", `{"url":"https://example.com"}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"call":1}` {
+		t.Fatalf("first response = %d %s", first.Code, first.Body)
+	}
+
+	// A retry gets the stored response without running the handler
+	retry := do(1, "key-1", `{"url":"https://example.com"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != `{"call":1}` || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry = %d %s %v", retry.Code, retry.Body, retry.Header())
+	}
+	if retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replayed Content-Type = %q", retry.Header().Get("Content-Type"))
+	}
+
+	// A different body with the same key is rejected
+	if w := do(1, "key-1", `{"url":"https://example.org"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: status = %d, want 422", w.Code)
+	}
+
+	// Keys are per user, and requests without a key always run
+	if w := do(2, "key-1", `{"url":"https://example.com"}`); w.Body.String() != `{"call":2}` {
+		t.Errorf("other user = %s", w.Body)
+	}
+	if w := do(1, "", `{"url":"https://example.com"}`); w.Body.String() != `{"call":3}` {
+		t.Errorf("no key = %s", w.Body)
+	}
+
+	// Server errors aren't stored, so the retry runs again
+	status = http.StatusInternalServerError
+	do(1, "key-2", `{}`)
+	status = http.StatusCreated
+	if w := do(1, "key-2", `{}`); w.Code != http.StatusCreated || w.Body.String() != `{"call":5}` {
+		t.Errorf("retry after 500 = %d %s", w.Code, w.Body)
+	}
+
+	if w := do(1, "bad\nkey", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid key: status = %d, want 400", w.Code)
+	}
+}
+
+func TestIdempotencyMiddlewareConcurrent(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]models.IdempotencyRecord{}}
+	var calls int32
+	release := make(chan struct{})
+	handler := IdempotencyMiddleware(store, config.IdempotencyConfig{TTLHours: 1, LockSeconds: 60, MaxResponseBytes: 1024})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}),
+	)
+
+	const n = 8
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{}`))
+			r.Header.Set(IdempotencyKeyHeader, "same")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+
+	// Every request but the one running the handler is turned away
+	var conflicts int
+	for i := 0; i < n-1; i++ {
+		if code := <-codes; code == http.StatusConflict {
+			conflicts++
+		}
+	}
+	close(release)
+	wg.Wait()
+	if code := <-codes; code != http.StatusCreated {
+		t.Errorf("running request: status = %d, want 201", code)
+	}
+	if conflicts != n-1 || calls != 1 {
+		t.Errorf("conflicts = %d, calls = %d, want %d and 1", conflicts, calls, n-1)
+	}
+}
+
+type failingSaveStore struct {
+	memoryIdempotencyStore
+}
+
+func (s *failingSaveStore) SaveIdempotencyKey(key string, rec *models.IdempotencyRecord, ttl time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func TestIdempotencyMiddlewareUnstoredResponses(t *testing.T) {
+	var calls int32
+	handler := func(store IdempotencyStore) http.Handler {
+		return IdempotencyMiddleware(store, config.IdempotencyConfig{TTLHours: 1, LockSeconds: 60, MaxResponseBytes: 8})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.Header().Set("Location", "/api/shorten/abc")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(r.URL.Query().Get("body")))
+			}),
+		)
+	}
+	do := func(h http.Handler, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{}`))
+		r.Header.Set(IdempotencyKeyHeader, "key")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// A response too large to keep is sent, and its retry is turned away
+	// rather than run again
+	large := handler(&memoryIdempotencyStore{records: map[string]models.IdempotencyRecord{}})
+	if w := do(large, "/?body=0123456789"); w.Code != http.StatusCreated || w.Body.String() != "0123456789" {
+		t.Fatalf("large response = %d %s", w.Code, w.Body)
+	}
+	if w := do(large, "/?body=0123456789"); w.Code != http.StatusConflict {
+		t.Errorf("retry of large response: status = %d, want 409", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	// A response that can't be stored is replaced by an error
+	failing := handler(&failingSaveStore{memoryIdempotencyStore{records: map[string]models.IdempotencyRecord{}}})
+	w := do(failing, "/?body=ok")
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Location") != "" || strings.Contains(w.Body.String(), "ok") {
+		t.Errorf("unstored response = %d %v %s, want a 500 problem", w.Code, w.Header(), w.Body)
+	}
+}
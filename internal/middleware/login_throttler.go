@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginThrottlePolicy configures how failed logins are slowed down and locked out
+type LoginThrottlePolicy struct {
+	FreeAttempts     int           // failures allowed before backoff starts
+	BaseDelay        time.Duration // delay after the first throttled failure, doubled on each further failure
+	MaxDelay         time.Duration
+	LockoutThreshold int // failures that trigger a lockout
+	LockoutDuration  time.Duration
+	Window           time.Duration // failures older than this are forgotten
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginThrottler tracks failed login attempts per key (a username or an IP)
+// and applies exponential backoff followed by a temporary lockout
+type LoginThrottler struct {
+	policy    LoginThrottlePolicy
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewLoginThrottler creates a new login throttler
+func NewLoginThrottler(policy LoginThrottlePolicy) *LoginThrottler {
+	if policy.Window <= 0 {
+		policy.Window = time.Hour
+	}
+	return &LoginThrottler{
+		policy:    policy,
+		attempts:  make(map[string]*loginAttempts),
+		lastPrune: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a login attempt for key may proceed. When it may not,
+// the time until the next attempt is allowed is returned along with whether
+// the key is locked out rather than just backing off.
+//
+// An allowed attempt is counted as a failure right away, so that concurrent
+// attempts can't all pass before the first failure is recorded. Call Refund
+// when it succeeds.
+func (t *LoginThrottler) Allow(key string) (retryAfter time.Duration, locked bool, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	a := t.attempts[key]
+	if a != nil && !a.lockedUntil.IsZero() && !now.Before(a.lockedUntil) {
+		// The lockout is over, start afresh
+		a = nil
+	}
+	if a != nil && now.Sub(a.lastFailure) > t.policy.Window {
+		a = nil
+	}
+
+	if a != nil {
+		if now.Before(a.lockedUntil) {
+			return a.lockedUntil.Sub(now), true, false
+		}
+		if delay := t.delay(a.failures); delay > 0 {
+			if next := a.lastFailure.Add(delay); now.Before(next) {
+				return next.Sub(now), false, false
+			}
+		}
+	} else {
+		a = &loginAttempts{}
+		t.attempts[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+	if t.policy.LockoutThreshold > 0 && a.failures >= t.policy.LockoutThreshold {
+		a.lockedUntil = now.Add(t.policy.LockoutDuration)
+	}
+	return 0, false, true
+}
+
+// Fail confirms that the attempt allowed for key failed and reports whether
+// key is now locked out. The failure was already counted by Allow.
+func (t *LoginThrottler) Fail(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := t.attempts[key]
+	return a != nil && t.now().Before(a.lockedUntil)
+}
+
+// Refund takes back the failure counted by Allow for an attempt that
+// succeeded, lifting the lockout it started if any
+func (t *LoginThrottler) Refund(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := t.attempts[key]
+	if a == nil || a.failures == 0 {
+		return
+	}
+	a.failures--
+	if t.policy.LockoutThreshold > 0 && a.failures < t.policy.LockoutThreshold {
+		a.lockedUntil = time.Time{}
+	}
+}
+
+// Reset forgets all failures recorded for key, e.g. after a successful login
+func (t *LoginThrottler) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
+
+// delay returns the backoff required after the given number of failures
+func (t *LoginThrottler) delay(failures int) time.Duration {
+	excess := failures - t.policy.FreeAttempts
+	if excess <= 0 || t.policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := t.policy.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if t.policy.MaxDelay > 0 && delay >= t.policy.MaxDelay {
+			return t.policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+// prune drops entries that are neither locked nor within the failure window.
+// Must be called with t.mu held.
+func (t *LoginThrottler) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.policy.Window {
+		return
+	}
+	t.lastPrune = now
+
+	for key, a := range t.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > t.policy.Window {
+			delete(t.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottler(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttler := NewLoginThrottler(LoginThrottlePolicy{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Minute,
+		Window:           time.Hour,
+	})
+	throttler.now = func() time.Time { return now }
+
+	// Free attempts are not delayed
+	for i := 0; i < 2; i++ {
+		if _, _, ok := throttler.Allow("alice"); !ok {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+		throttler.Fail("alice")
+	}
+	if _, _, ok := throttler.Allow("alice"); !ok {
+		t.Fatal("attempt after free failures should be allowed")
+	}
+
+	// Backoff doubles after each further failure and is capped
+	wantDelays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for _, want := range wantDelays {
+		if locked := throttler.Fail("alice"); locked {
+			t.Fatal("unexpected lockout")
+		}
+		retryAfter, locked, ok := throttler.Allow("alice")
+		if ok || locked {
+			t.Fatalf("Allow() = ok %v, locked %v, want backoff", ok, locked)
+		}
+		if retryAfter != want {
+			t.Errorf("retryAfter = %v, want %v", retryAfter, want)
+		}
+		now = now.Add(retryAfter)
+		if _, _, ok := throttler.Allow("alice"); !ok {
+			t.Fatal("attempt after backoff should be allowed")
+		}
+	}
+
+	// Other keys are unaffected
+	if _, _, ok := throttler.Allow("bob"); !ok {
+		t.Error("unrelated key should be allowed")
+	}
+
+	// Reaching the threshold locks the key out
+	if locked := throttler.Fail("alice"); !locked {
+		t.Fatal("expected lockout at threshold")
+	}
+	retryAfter, locked, ok := throttler.Allow("alice")
+	if ok || !locked || retryAfter != time.Minute {
+		t.Fatalf("Allow() = %v, %v, %v, want locked for 1m", retryAfter, locked, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, ok := throttler.Allow("alice"); !ok {
+		t.Error("attempt after lockout should be allowed")
+	}
+
+	// A successful login clears the failures
+	throttler.Fail("alice")
+	throttler.Fail("alice")
+	throttler.Fail("alice")
+	throttler.Reset("alice")
+	if _, _, ok := throttler.Allow("alice"); !ok {
+		t.Error("attempt after reset should be allowed")
+	}
+}
+
+func TestLoginThrottlerReservesAttempts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttler := NewLoginThrottler(LoginThrottlePolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 3,
+		LockoutDuration:  time.Minute,
+		Window:           time.Hour,
+	})
+	throttler.now = func() time.Time { return now }
+
+	// A burst of attempts made before any of them fails is still limited
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if _, _, ok := throttler.Allow("alice"); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("allowed %d attempts of a burst, want 3", allowed)
+	}
+
+	// Refunding a successful attempt lifts the lockout it started
+	throttler.Refund("alice")
+	if _, _, ok := throttler.Allow("alice"); !ok {
+		t.Fatal("attempt after refund should be allowed")
+	}
+	if locked := throttler.Fail("alice"); !locked {
+		t.Fatal("expected lockout after failed attempt")
+	}
+
+	// Successful attempts don't add up
+	for i := 0; i < 10; i++ {
+		if _, _, ok := throttler.Allow("bob"); !ok {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+		throttler.Refund("bob")
+	}
+}
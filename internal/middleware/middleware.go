@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"strings"
 	"time"
@@ -10,14 +12,77 @@ import (
 	"go.uber.org/zap"
 
 	"url_shortener/internal/logger"
+	"url_shortener/internal/problem"
+	"url_shortener/internal/repository"
 )
 
 type contextKey string
 
 const (
-	UserIDKey contextKey = "userID"
+	UserIDKey    contextKey = "userID"
+	RequestIDKey contextKey = "requestID"
 )
 
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// UserIDFromContext returns the ID of the authenticated user, if any
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(UserIDKey).(int)
+	return id, ok
+}
+
+// RequestIDFromContext returns the ID assigned to the request by RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// RequestIDMiddleware assigns every request an ID, reusing a well-formed
+// X-Request-ID from the client or proxy, and echoes it in the response
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			b := make([]byte, 12)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), RequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxBodyBytesMiddleware limits request bodies to n bytes, or to the limit of
+// the request path in limits. Reading past the limit fails with
+// *http.MaxBytesError.
+func MaxBodyBytesMiddleware(n int64, limits map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := n
+			if l, ok := limits[r.URL.Path]; ok {
+				limit = l
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -27,6 +92,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the request details
 		logger.GetLogger().Info("request completed",
+			zap.String("request_id", RequestIDFromContext(r.Context())),
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("remote_addr", r.RemoteAddr),
@@ -38,16 +104,10 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip auth for the redirect endpoint
-			if r.Method == "GET" && !strings.HasPrefix(r.URL.Path, "/shorten") {
-				next.ServeHTTP(w, r)
-				return
-			}
-
 			// Get token from header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header required")
 				return
 			}
 
@@ -60,18 +120,63 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 			})
 
 			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
 				return
 			}
 
 			// Extract claims
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				// Add user ID to context
-				ctx := context.WithValue(r.Context(), UserIDKey, claims["sub"])
-				next.ServeHTTP(w, r.WithContext(ctx))
-			} else {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token claims")
+				return
 			}
+
+			// MFA challenge tokens only authorize the second login step
+			if typ, _ := claims["typ"].(string); typ != "" {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+				return
+			}
+
+			// JSON numbers are decoded as float64
+			sub, ok := claims["sub"].(float64)
+			if !ok || sub <= 0 {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token claims")
+				return
+			}
+
+			// Add user ID to context
+			ctx := context.WithValue(r.Context(), UserIDKey, int(sub))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AdminMiddleware only lets users flagged as admin through. It must run after
+// AuthMiddleware.
+func AdminMiddleware(userRepo repository.UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header required")
+				return
+			}
+
+			user, err := userRepo.GetByID(userID)
+			if err == repository.ErrUserNotFound {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+				return
+			} else if err != nil {
+				problem.Internal(w, r, "Failed to get user", err)
+				return
+			}
+
+			if !user.IsAdmin {
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Admin access required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
 		})
 	}
-} 
\ No newline at end of file
+}
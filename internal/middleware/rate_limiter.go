@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"url_shortener/internal/problem"
 )
 
 // RateLimiter implements a simple token bucket algorithm
@@ -76,16 +78,13 @@ func RateLimitMiddleware(store *RateLimiterStore) func(http.Handler) http.Handle
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get IP address from request
-			ip := r.RemoteAddr
-			if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
-				ip = forwardedFor
-			}
+			ip := ClientNetwork(ClientIP(r))
 
 			// Get rate limiter for this IP
 			limiter := store.getLimiter(ip)
 
 			if !limiter.allow() {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "Rate limit exceeded")
 				return
 			}
 
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditAction identifies the kind of change recorded in an audit event
+type AuditAction string
+
+const (
+	ActionShortURLCreate   AuditAction = "short_url.create"
+	ActionShortURLUpdate   AuditAction = "short_url.update"
+	ActionShortURLDelete   AuditAction = "short_url.delete"
+	ActionShortURLFlag     AuditAction = "short_url.flag"
+	ActionShortURLUnflag   AuditAction = "short_url.unflag"
+	ActionShortURLDisable  AuditAction = "short_url.disable"
+	ActionShortURLEnable   AuditAction = "short_url.enable"
+	ActionShortURLRollback AuditAction = "short_url.rollback" // set back to a revision
+	ActionShortURLRestore  AuditAction = "short_url.restore"  // taken out of the trash
+	ActionShortURLPurge    AuditAction = "short_url.purge"    // removed from the trash for good
+	ActionChangeSchedule   AuditAction = "scheduled_change.create"
+	ActionChangeCancel     AuditAction = "scheduled_change.cancel"
+	ActionChangeApply      AuditAction = "scheduled_change.apply"
+	ActionReportsDismiss   AuditAction = "link_report.dismiss"
+
+	ActionUserSignup         AuditAction = "user.signup"
+	ActionUserLogin          AuditAction = "user.login"
+	ActionUserLoginFailed    AuditAction = "user.login_failed"
+	ActionUserPasswordChange AuditAction = "user.password_change"
+	ActionUserPasswordReset  AuditAction = "user.password_reset"
+	ActionUserDelete         AuditAction = "user.delete"
+	ActionUserMFAEnable      AuditAction = "user.mfa_enable"
+	ActionUserMFADisable     AuditAction = "user.mfa_disable"
+
+	ActionWorkspaceCreate       AuditAction = "workspace.create"
+	ActionWorkspaceSettings     AuditAction = "workspace.settings_update"
+	ActionWorkspaceMemberRole   AuditAction = "workspace.member_role"
+	ActionWorkspaceMemberRemove AuditAction = "workspace.member_remove"
+	ActionWorkspaceInvite       AuditAction = "workspace.invite"
+	ActionWorkspaceJoin         AuditAction = "workspace.invitation_accept"
+)
+
+// Audit target types
+const (
+	TargetShortURL  = "short_url"
+	TargetUser      = "user"
+	TargetWorkspace = "workspace"
+)
+
+// AuditContext carries who performed a change and from where. The zero value
+// describes a change made by the system itself.
+type AuditContext struct {
+	ActorID   int
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// AuditEvent is an append-only record of a mutation or security event
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    int             `json:"actorId,omitempty"`
+	Action     AuditAction     `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"userAgent,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// NewEvent builds an audit event for the context. before and after are
+// stored as JSON; nil values are omitted.
+func (ac AuditContext) NewEvent(action AuditAction, targetType, targetID string, before, after interface{}) (*AuditEvent, error) {
+	event := &AuditEvent{
+		ActorID:    ac.ActorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         ac.IP,
+		UserAgent:  ac.UserAgent,
+		RequestID:  ac.RequestID,
+		CreatedAt:  time.Now(),
+	}
+
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+)
+
+// BatchCreateItem is one link of a batch create. All items of a batch belong
+// to the workspace of the batch.
+type BatchCreateItem struct {
+	URL           string     `json:"url" validate:"required,url"`
+	FallbackURL   string     `json:"fallbackUrl,omitempty" validate:"omitempty,url"`
+	Alias         string     `json:"alias,omitempty" validate:"omitempty,min=3,max=10,slug"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Title         string     `json:"title,omitempty" validate:"max=255"`
+	Description   string     `json:"description,omitempty" validate:"max=1000"`
+	Notes         string     `json:"notes,omitempty" validate:"max=10000"`
+	OGTitle       string     `json:"ogTitle,omitempty" validate:"max=255"`
+	OGDescription string     `json:"ogDescription,omitempty" validate:"max=1000"`
+	OGImageURL    string     `json:"ogImageUrl,omitempty" validate:"omitempty,url"`
+}
+
+// BatchCreateRequest creates many short URLs at once. Items are validated
+// one by one so that invalid items don't fail the whole batch.
+type BatchCreateRequest struct {
+	WorkspaceID int               `json:"workspaceId,omitempty"`
+	Items       []BatchCreateItem `json:"items" validate:"required,min=1"`
+}
+
+// BatchUpdateItem replaces the destination, fallback, expiry, texts and
+// social preview overrides of one short URL, like PUT /api/shorten/{shortCode}
+type BatchUpdateItem struct {
+	ShortCode     string     `json:"shortCode" validate:"required"`
+	URL           string     `json:"url" validate:"required,url"`
+	FallbackURL   string     `json:"fallbackUrl,omitempty" validate:"omitempty,url"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Title         string     `json:"title,omitempty" validate:"max=255"`
+	Description   string     `json:"description,omitempty" validate:"max=1000"`
+	Notes         string     `json:"notes,omitempty" validate:"max=10000"`
+	OGTitle       string     `json:"ogTitle,omitempty" validate:"max=255"`
+	OGDescription string     `json:"ogDescription,omitempty" validate:"max=1000"`
+	OGImageURL    string     `json:"ogImageUrl,omitempty" validate:"omitempty,url"`
+}
+
+// BatchUpdateRequest updates many short URLs at once
+type BatchUpdateRequest struct {
+	Items []BatchUpdateItem `json:"items" validate:"required,min=1"`
+}
+
+// BatchDeleteRequest deletes many short URLs at once
+type BatchDeleteRequest struct {
+	ShortCodes []string `json:"shortCodes" validate:"required,min=1"`
+}
+
+// BatchItemError describes why a batch item failed. Code is one of the
+// problem codes of error responses.
+type BatchItemError struct {
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Errors  []*ValidationError `json:"errors,omitempty"`
+}
+
+// BatchItemResult is the outcome of one item of a batch, in request order
+type BatchItemResult struct {
+	Index     int             `json:"index"`
+	ShortCode string          `json:"shortCode,omitempty"`
+	Status    int             `json:"status"` // HTTP status the item would have had on its own
+	ShortURL  *ShortURL       `json:"shortUrl,omitempty"`
+	Error     *BatchItemError `json:"error,omitempty"`
+}
+
+// BatchResponse reports the results of a batch
+type BatchResponse struct {
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []*BatchItemResult `json:"results"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// GroupKind tells tags and collections apart. Both group links many-to-many;
+// tags are short labels used for filtering, collections named sets of links
+// with a description.
+type GroupKind string
+
+const (
+	GroupTag        GroupKind = "tag"
+	GroupCollection GroupKind = "collection"
+)
+
+// LinkGroup is a tag or collection of links. Like links, it belongs to a
+// workspace or, when WorkspaceID is 0, to a user, and holds only links of
+// its owner.
+type LinkGroup struct {
+	ID          int       `json:"id"`
+	Kind        GroupKind `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	UserID      int       `json:"userId,omitempty"`
+	WorkspaceID int       `json:"workspaceId,omitempty"`
+	LinkCount   int       `json:"linkCount"` // links not in the trash
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// CreateGroupRequest represents the request body for creating a tag or
+// collection
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description,omitempty" validate:"max=500"`
+	WorkspaceID int    `json:"workspaceId,omitempty"`
+}
+
+// UpdateGroupRequest represents the request body for renaming a tag or
+// collection
+type UpdateGroupRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description,omitempty" validate:"max=500"`
+}
+
+// GroupLinksRequest lists the links to add to a tag or collection
+type GroupLinksRequest struct {
+	ShortCodes []string `json:"shortCodes" validate:"required,min=1,max=1000,dive,required"`
+}
+
+// GroupStats aggregates the clicks of the links of a tag or collection
+type GroupStats struct {
+	LinkCount   int           `json:"linkCount"`
+	TotalClicks int64         `json:"totalClicks"` // all-time access counts
+	Daily       []DailyClicks `json:"daily"`
+}
+
+// DailyClicks is the number of clicks on a day (UTC)
+type DailyClicks struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Clicks int64  `json:"clicks"`
+}
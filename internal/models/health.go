@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// HealthStatus is the result of the latest destination health checks of a link
+type HealthStatus string
+
+const (
+	HealthUnknown HealthStatus = "unknown" // not checked yet
+	HealthHealthy HealthStatus = "healthy"
+	HealthBroken  HealthStatus = "broken" // failed several checks in a row
+)
+
+// HealthCheckResult is the outcome of one check of a link's destination
+type HealthCheckResult struct {
+	Status     HealthStatus
+	StatusCode int // 0 when the destination couldn't be reached
+	Latency    time.Duration
+	CheckedAt  time.Time
+	Failures   int // consecutive failed checks
+}
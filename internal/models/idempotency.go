@@ -0,0 +1,21 @@
+package models
+
+import (
+	"net/http"
+)
+
+// IdempotencyRecord is what's kept for an Idempotency-Key: the fingerprint of
+// the request that first used it and, once that request completed, its
+// response
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"` // 0 while the request is in progress
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"` // the body was too large to keep
+}
+
+// Completed reports whether the response of the request is stored
+func (rec *IdempotencyRecord) Completed() bool {
+	return rec.Status != 0
+}
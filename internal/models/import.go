@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportFormat is the file format of an import
+type ImportFormat string
+
+const (
+	ImportCSV    ImportFormat = "csv"    // the columns of the CSV export
+	ImportNDJSON ImportFormat = "ndjson" // one short URL object per line, as exported
+	ImportBitly  ImportFormat = "bitly"  // a CSV export of Bitly links
+)
+
+// Valid reports whether f is a known format
+func (f ImportFormat) Valid() bool {
+	switch f {
+	case ImportCSV, ImportNDJSON, ImportBitly:
+		return true
+	}
+	return false
+}
+
+// ImportStatus is the state of an import job
+type ImportStatus string
+
+const (
+	ImportQueued    ImportStatus = "queued"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed" // stopped early, see Error
+)
+
+// ImportConflict decides what happens to a row whose short code can't be kept
+type ImportConflict string
+
+const (
+	ImportConflictGenerate ImportConflict = "generate" // the link gets a new code
+	ImportConflictSkip     ImportConflict = "skip"     // the row fails
+)
+
+// ImportJob is an asynchronous import of links from a file
+type ImportJob struct {
+	ID            int            `json:"id"`
+	UserID        int            `json:"userId"`
+	WorkspaceID   int            `json:"workspaceId,omitempty"`
+	Format        ImportFormat   `json:"format"`
+	OnConflict    ImportConflict `json:"onConflict"`
+	Status        ImportStatus   `json:"status"`
+	TotalRows     int            `json:"totalRows"`
+	ProcessedRows int            `json:"processedRows"`
+	CreatedRows   int            `json:"createdRows"`
+	FailedRows    int            `json:"failedRows"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	FinishedAt    *time.Time     `json:"finishedAt,omitempty"`
+}
+
+// ImportRowStatus is the outcome of one row of an import
+type ImportRowStatus string
+
+const (
+	ImportRowCreated ImportRowStatus = "created"
+	ImportRowFailed  ImportRowStatus = "failed"
+)
+
+// ImportRowResult is the outcome of one row of an import. Line is the line
+// of the row in the file. RequestedCode is the short code given in the file,
+// if any; ShortCode differs from it when the link got a new code.
+type ImportRowResult struct {
+	Line          int             `json:"line"`
+	Status        ImportRowStatus `json:"status"`
+	ShortCode     string          `json:"shortCode,omitempty"`
+	RequestedCode string          `json:"requestedCode,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// MaxPasswordLength is the longest password accepted. bcrypt ignores
+// everything past 72 bytes, so longer passwords would be silently truncated.
+const MaxPasswordLength = 72
+
+// PasswordPolicy describes the rules a new password has to satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireDigit  bool
+	RequireLetter bool
+}
+
+// DefaultPasswordPolicy is used when no policy is configured
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	RequireDigit:  true,
+	RequireLetter: true,
+}
+
+// Validate checks password against the policy. field is reported in the
+// returned ValidationError.
+func (p PasswordPolicy) Validate(field, password string) error {
+	minLength := p.MinLength
+	if minLength <= 0 {
+		minLength = DefaultPasswordPolicy.MinLength
+	}
+
+	if len(password) < minLength {
+		return &ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("Password must be at least %d characters long", minLength),
+		}
+	}
+	if len(password) > MaxPasswordLength {
+		return &ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("Password must be at most %d characters long", MaxPasswordLength),
+		}
+	}
+
+	var hasDigit, hasLetter bool
+	for _, c := range password {
+		switch {
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsLetter(c):
+			hasLetter = true
+		}
+	}
+
+	if p.RequireDigit && !hasDigit {
+		return &ValidationError{
+			Field:   field,
+			Message: "Password must contain at least one digit",
+		}
+	}
+	if p.RequireLetter && !hasLetter {
+		return &ValidationError{
+			Field:   field,
+			Message: "Password must contain at least one letter",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 10, RequireDigit: true, RequireLetter: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		want     string // substring of the message, "" for valid
+	}{
+		{"valid", strict, "correct horse 9", ""},
+		{"too short", strict, "abc123", "at least 10"},
+		{"default length", PasswordPolicy{}, "abc1234", "at least 8"},
+		{"too long", strict, strings.Repeat("a1", 37), "at most 72"},
+		{"no digit", strict, "onlyletters", "digit"},
+		{"no letter", strict, "1234567890", "letter"},
+		{"digit not required", PasswordPolicy{MinLength: 4, RequireLetter: true}, "letters", ""},
+		{"unicode letters", PasswordPolicy{RequireLetter: true}, "пароль12", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate("password", tt.password)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok || verr.Field != "password" || !strings.Contains(verr.Message, tt.want) {
+				t.Errorf("Validate() = %v, want a password error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignupRequestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   SignupRequest
+		field string // "" for valid
+	}{
+		{"valid", SignupRequest{Username: "alice", Password: "secret123"}, ""},
+		{"valid with email", SignupRequest{Username: "alice", Email: "alice@example.com", Password: "secret123"}, ""},
+		{"short username", SignupRequest{Username: " al ", Password: "secret123"}, "username"},
+		{"long username", SignupRequest{Username: strings.Repeat("a", 51), Password: "secret123"}, "username"},
+		{"bad email", SignupRequest{Username: "alice", Email: "alice", Password: "secret123"}, "email"},
+		{"weak password", SignupRequest{Username: "alice", Password: "secret"}, "password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate(DefaultPasswordPolicy)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok || verr.Field != tt.field {
+				t.Errorf("Validate() = %v, want an error for %s", err, tt.field)
+			}
+		})
+	}
+}
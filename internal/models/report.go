@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// ReportReason is the category of an abuse report
+type ReportReason string
+
+const (
+	ReportMalware  ReportReason = "malware"
+	ReportPhishing ReportReason = "phishing"
+	ReportSpam     ReportReason = "spam"
+	ReportIllegal  ReportReason = "illegal" // unlawful content, disabled links answer 451
+	ReportOther    ReportReason = "other"
+)
+
+// Valid reports whether r is a known reason
+func (r ReportReason) Valid() bool {
+	switch r {
+	case ReportMalware, ReportPhishing, ReportSpam, ReportIllegal, ReportOther:
+		return true
+	}
+	return false
+}
+
+// ReportStatus is the moderation state of an abuse report
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportDismissed ReportStatus = "dismissed"
+	ReportActioned  ReportStatus = "actioned" // the link was disabled
+)
+
+// LinkReport is an abuse report about a short URL
+type LinkReport struct {
+	ID              int          `json:"id"`
+	ShortURLID      int          `json:"-"`
+	ShortCode       string       `json:"shortCode"`
+	Reason          ReportReason `json:"reason"`
+	Details         string       `json:"details,omitempty"`
+	ReporterIP      string       `json:"reporterIp"`
+	ReporterNetwork string       `json:"-"` // what reporters are told apart by, see middleware.ClientNetwork
+	Status          ReportStatus `json:"status"`
+	ReviewedBy      int          `json:"reviewedBy,omitempty"`
+	ReviewedAt      *time.Time   `json:"reviewedAt,omitempty"`
+	CreatedAt       time.Time    `json:"createdAt"`
+}
+
+// CreateReportRequest represents the request body for reporting a short URL
+type CreateReportRequest struct {
+	Reason  ReportReason `json:"reason" validate:"required,oneof=malware phishing spam illegal other"`
+	Details string       `json:"details,omitempty" validate:"max=1000"`
+}
+
+// DisableShortURLRequest represents the request body for disabling a short
+// URL after reviewing its reports. Reason defaults to the reviewed report's.
+type DisableShortURLRequest struct {
+	Reason ReportReason `json:"reason,omitempty" validate:"omitempty,oneof=malware phishing spam illegal other"`
+}
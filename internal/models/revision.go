@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// RevisionSource tells what kind of change produced a revision
+type RevisionSource string
+
+const (
+	RevisionInitial   RevisionSource = "initial" // state of a link from before revisions were kept
+	RevisionCreate    RevisionSource = "create"
+	RevisionUpdate    RevisionSource = "update"
+	RevisionRollback  RevisionSource = "rollback"
+	RevisionScheduled RevisionSource = "scheduled" // a scheduled destination change was applied
+)
+
+// Revision is the destination and attributes of a link after a change
+type Revision struct {
+	ID          int            `json:"id"`
+	ShortURLID  int            `json:"-"`
+	Version     int            `json:"version"` // of the link after the change
+	Source      RevisionSource `json:"source"`
+	OriginalURL string         `json:"originalUrl"`
+	FallbackURL string         `json:"fallbackUrl,omitempty"`
+	ExpiresAt   *time.Time     `json:"expiresAt,omitempty"`
+	AuthorID    int            `json:"authorId,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// RevisionOf returns the revision describing the current state of su
+func RevisionOf(su *ShortURL, source RevisionSource, authorID int) *Revision {
+	return &Revision{
+		ShortURLID:  su.ID,
+		Version:     su.Version,
+		Source:      source,
+		OriginalURL: su.OriginalURL,
+		FallbackURL: su.FallbackURL,
+		ExpiresAt:   su.ExpiresAt,
+		AuthorID:    authorID,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// ScheduledChange is a destination change that takes effect at ActivateAt.
+// The values derived from the URL are computed when the change is scheduled.
+type ScheduledChange struct {
+	ID               int       `json:"id"`
+	ShortURLID       int       `json:"-"`
+	ShortCode        string    `json:"shortCode"`
+	URL              string    `json:"url"`
+	CanonicalURLHash string    `json:"-"`
+	ResolvedURL      string    `json:"resolvedUrl,omitempty"`
+	UnicodeHost      string    `json:"unicodeHost,omitempty"`
+	FlagReason       string    `json:"flagReason,omitempty"`
+	ActivateAt       time.Time `json:"activateAt"`
+	AuthorID         int       `json:"authorId,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// ScheduleChangeRequest represents the request body for scheduling a
+// destination change
+type ScheduleChangeRequest struct {
+	URL        string    `json:"url" validate:"required,url"`
+	ActivateAt time.Time `json:"activateAt" validate:"required"`
+}
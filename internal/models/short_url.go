@@ -1,6 +1,9 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -12,15 +15,197 @@ type ShortURL struct {
 	AccessCount int       `json:"accessCount"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
-	UserID      string    `json:"userId,omitempty"`
+	UserID      int       `json:"userId,omitempty"`
+	WorkspaceID int       `json:"workspaceId,omitempty"`
+	// FlagReason is set when an admin flagged the link as dangerous. Flagged
+	// links show a warning page instead of redirecting.
+	FlagReason string `json:"flagReason,omitempty"`
+	// ResolvedURL is where OriginalURL finally leads when it is a link of
+	// another URL shortener
+	ResolvedURL string `json:"resolvedUrl,omitempty"`
+	// UnicodeHost is the decoded form of an internationalized destination
+	// host, so reviewers can see what a Punycode host really reads as
+	UnicodeHost string `json:"unicodeHost,omitempty"`
+	// FallbackURL is used by the redirect while the destination is broken
+	FallbackURL string `json:"fallbackUrl,omitempty"`
+	// DisabledAt is set when the link was disabled by a moderator or
+	// suspended automatically after abuse reports. Disabled links don't
+	// redirect.
+	DisabledAt     *time.Time   `json:"disabledAt,omitempty"`
+	DisabledReason ReportReason `json:"disabledReason,omitempty"`
+	// ExpiresAt is when the link stops redirecting, if set
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Version counts the changes made to the link's settings, starting at 1.
+	// It is the link's ETag; clicks and health checks don't change it.
+	Version int `json:"version"`
+	// DeletedAt is set while the link is in the trash. Deleted links don't
+	// redirect and are purged after the retention period.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Title, Description and Notes are set by the owner. Notes are private
+	// to the people who can see the link.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+	// Preview is what was read from the destination page, once it was
+	// fetched. It is fetched again when the destination changes.
+	Preview *LinkPreview `json:"preview,omitempty"`
+	// OGTitle, OGDescription and OGImageURL override what link unfurling
+	// bots are shown, see SocialPreview
+	OGTitle       string `json:"ogTitle,omitempty"`
+	OGDescription string `json:"ogDescription,omitempty"`
+	OGImageURL    string `json:"ogImageUrl,omitempty"`
+
+	HealthStatus   HealthStatus `json:"healthStatus"`
+	LastStatusCode int          `json:"lastStatusCode,omitempty"`
+	LastLatencyMs  int          `json:"lastLatencyMs,omitempty"`
+	LastCheckedAt  *time.Time   `json:"lastCheckedAt,omitempty"`
+	HealthFailures int          `json:"-"` // consecutive failed health checks
+	// CanonicalURLHash identifies the canonical form of OriginalURL, see
+	// CanonicalizeURL
+	CanonicalURLHash string `json:"-"`
+	// OwnerDeletedAt is set when the owner deleted their account and the
+	// link was kept without an owner. Such links still redirect but nobody
+	// can see them.
+	OwnerDeletedAt *time.Time `json:"-"`
+}
+
+// LinkPreview is the title, OpenGraph data and favicon of a destination page
+type LinkPreview struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+	FaviconURL  string `json:"faviconUrl,omitempty"`
+	// FetchedAt is when the page was fetched. The other fields are empty
+	// if that failed.
+	FetchedAt time.Time `json:"fetchedAt"`
 }
 
 // CreateShortURLRequest represents the request body for creating a short URL
 type CreateShortURLRequest struct {
-	URL string `json:"url" validate:"required,url"`
+	URL         string `json:"url" validate:"required,url"`
+	WorkspaceID int    `json:"workspaceId,omitempty"`
+	FallbackURL string `json:"fallbackUrl,omitempty" validate:"omitempty,url"`
+	// Alias is used as the short code instead of a generated one
+	Alias         string     `json:"alias,omitempty" validate:"omitempty,min=3,max=10,slug"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Title         string     `json:"title,omitempty" validate:"max=255"`
+	Description   string     `json:"description,omitempty" validate:"max=1000"`
+	Notes         string     `json:"notes,omitempty" validate:"max=10000"`
+	OGTitle       string     `json:"ogTitle,omitempty" validate:"max=255"`
+	OGDescription string     `json:"ogDescription,omitempty" validate:"max=1000"`
+	OGImageURL    string     `json:"ogImageUrl,omitempty" validate:"omitempty,url"`
+	// Dedupe returns the owner's existing link for the same canonical URL
+	// instead of creating a new one
+	Dedupe bool `json:"dedupe,omitempty"`
 }
 
 // UpdateShortURLRequest represents the request body for updating a short URL
 type UpdateShortURLRequest struct {
-	URL string `json:"url" validate:"required,url"`
+	URL           string     `json:"url" validate:"required,url"`
+	FallbackURL   string     `json:"fallbackUrl,omitempty" validate:"omitempty,url"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Title         string     `json:"title,omitempty" validate:"max=255"`
+	Description   string     `json:"description,omitempty" validate:"max=1000"`
+	Notes         string     `json:"notes,omitempty" validate:"max=10000"`
+	OGTitle       string     `json:"ogTitle,omitempty" validate:"max=255"`
+	OGDescription string     `json:"ogDescription,omitempty" validate:"max=1000"`
+	OGImageURL    string     `json:"ogImageUrl,omitempty" validate:"omitempty,url"`
+}
+
+// PatchShortURLRequest is a JSON Merge Patch (RFC 7396) of a short URL.
+// Fields left out stay as they are; fields set to null are listed in Null
+// and cleared.
+type PatchShortURLRequest struct {
+	URL           *string    `json:"url" validate:"url"`
+	FallbackURL   *string    `json:"fallbackUrl" validate:"url"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+	Title         *string    `json:"title" validate:"max=255"`
+	Description   *string    `json:"description" validate:"max=1000"`
+	Notes         *string    `json:"notes" validate:"max=10000"`
+	OGTitle       *string    `json:"ogTitle" validate:"max=255"`
+	OGDescription *string    `json:"ogDescription" validate:"max=1000"`
+	OGImageURL    *string    `json:"ogImageUrl" validate:"url"`
+
+	Null map[string]bool `json:"-"`
+}
+
+// UnmarshalJSON decodes a patch, rejecting unknown fields and recording the
+// fields set to null, which a plain decode can't tell from missing ones
+func (p *PatchShortURLRequest) UnmarshalJSON(data []byte) error {
+	type fields PatchShortURLRequest // without this method
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode((*fields)(p)); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Null = map[string]bool{}
+	for name, value := range raw {
+		if string(value) == "null" {
+			p.Null[name] = true
+		}
+	}
+	return nil
+}
+
+// SearchResult is a link found by a search with its relevance
+type SearchResult struct {
+	*ShortURL
+	Score float64 `json:"score"`
+}
+
+// SocialPreview returns the title, description and image shown by chats and
+// social networks that unfurl the link. Each is the override if set, else the
+// link's own title or description, else what was read from the destination.
+func (su *ShortURL) SocialPreview() LinkPreview {
+	var fetched LinkPreview
+	if su.Preview != nil {
+		fetched = *su.Preview
+	}
+	return LinkPreview{
+		Title:       firstNonEmpty(su.OGTitle, su.Title, fetched.Title),
+		Description: firstNonEmpty(su.OGDescription, su.Description, fetched.Description),
+		ImageURL:    firstNonEmpty(su.OGImageURL, fetched.ImageURL),
+		SiteName:    fetched.SiteName,
+		FaviconURL:  fetched.FaviconURL,
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Expired reports whether the link has passed its expiry time
+func (su *ShortURL) Expired(now time.Time) bool {
+	return su.ExpiresAt != nil && !now.Before(*su.ExpiresAt)
+}
+
+// ReadableByAnyone reports whether every user may read the link. That is
+// the case for links created before ownership was tracked, but not for links
+// kept after their owner deleted their account.
+func (su *ShortURL) ReadableByAnyone() bool {
+	return su.UserID == 0 && su.WorkspaceID == 0 && su.OwnerDeletedAt == nil
+}
+
+// FlagShortURLRequest represents the request body for flagging a short URL
+type FlagShortURLRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+// reservedShortCodes are the first path segments the router serves itself
+var reservedShortCodes = map[string]bool{"api": true, "auth": true, "docs": true, "metrics": true}
+
+// ReservedShortCode reports whether code can't be used as a short code
+func ReservedShortCode(code string) bool {
+	return reservedShortCodes[strings.ToLower(code)]
 }
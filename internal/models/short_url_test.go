@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPatchShortURLRequestUnmarshal(t *testing.T) {
+	var p PatchShortURLRequest
+	if err := json.Unmarshal([]byte(`{"url":"https://example.com","fallbackUrl":null}`), &p); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if p.URL == nil || *p.URL != "https://example.com" {
+		t.Errorf("URL = %v", p.URL)
+	}
+	if p.FallbackURL != nil || !p.Null["fallbackUrl"] {
+		t.Errorf("fallbackUrl not recorded as null: %v, %v", p.FallbackURL, p.Null)
+	}
+	if p.ExpiresAt != nil || p.Null["expiresAt"] {
+		t.Errorf("missing expiresAt was changed: %v, %v", p.ExpiresAt, p.Null)
+	}
+
+	err := json.Unmarshal([]byte(`{"shortCode":"abc"}`), &p)
+	if err == nil || !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		t.Errorf("unknown field: err = %v", err)
+	}
+}
+
+func TestSocialPreview(t *testing.T) {
+	su := &ShortURL{
+		Title: "Spring sale",
+		Preview: &LinkPreview{
+			Title:       "Shop - Home",
+			Description: "Everything you need",
+			ImageURL:    "https://shop.example.com/og.png",
+			SiteName:    "Shop",
+		},
+	}
+
+	got := su.SocialPreview()
+	want := LinkPreview{Title: "Spring sale", Description: "Everything you need", ImageURL: "https://shop.example.com/og.png", SiteName: "Shop"}
+	if got != want {
+		t.Errorf("SocialPreview() = %+v, want %+v", got, want)
+	}
+
+	su.OGTitle = "50% off"
+	su.OGImageURL = "https://cdn.example.com/sale.png"
+	got = su.SocialPreview()
+	if got.Title != "50% off" || got.ImageURL != "https://cdn.example.com/sale.png" {
+		t.Errorf("overrides not used: %+v", got)
+	}
+
+	if got := (&ShortURL{}).SocialPreview(); got != (LinkPreview{}) {
+		t.Errorf("SocialPreview() without preview = %+v", got)
+	}
+}
+
+func TestReadableByAnyone(t *testing.T) {
+	deleted := time.Now()
+	tests := []struct {
+		name string
+		su   ShortURL
+		want bool
+	}{
+		{"created before ownership", ShortURL{}, true},
+		{"personal", ShortURL{UserID: 1}, false},
+		{"workspace", ShortURL{WorkspaceID: 2}, false},
+		{"retained after account deletion", ShortURL{OwnerDeletedAt: &deleted}, false},
+		{"workspace link of deleted user", ShortURL{WorkspaceID: 2, OwnerDeletedAt: &deleted}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.su.ReadableByAnyone(); got != tt.want {
+				t.Errorf("ReadableByAnyone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+
+	"url_shortener/internal/idna"
+)
+
+// defaultPorts are dropped from canonical URLs
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// CanonicalizeURL returns the canonical form of a URL used to detect
+// duplicates: lowercase scheme and host, ASCII (Punycode) host, no default
+// port, dot segments resolved, percent-encoding normalized and query
+// parameters sorted by name. Two URLs with the same canonical form address
+// the same resource.
+func CanonicalizeURL(urlStr string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(urlStr))
+	if err != nil {
+		return "", err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + strings.ToLower(host) + "]"
+	} else if host, err = idna.ToASCII(host); err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host += ":" + port
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(host)
+
+	path := removeDotSegments(normalizeEscapes(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if u.RawQuery != "" {
+		var pairs []string
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			if pair != "" {
+				pairs = append(pairs, normalizeEscapes(pair))
+			}
+		}
+		// Sort by name only so repeated parameters keep their order
+		sort.SliceStable(pairs, func(i, j int) bool {
+			ki, _, _ := strings.Cut(pairs[i], "=")
+			kj, _, _ := strings.Cut(pairs[j], "=")
+			return ki < kj
+		})
+		if len(pairs) > 0 {
+			b.WriteByte('?')
+			b.WriteString(strings.Join(pairs, "&"))
+		}
+	}
+
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+
+	return b.String(), nil
+}
+
+// CanonicalURLHash returns the hex encoded SHA-256 of a canonical URL
+func CanonicalURLHash(canonicalURL string) string {
+	sum := sha256.Sum256([]byte(canonicalURL))
+	return hex.EncodeToString(sum[:])
+}
+
+// StripTrackingParams removes the given query parameters from a URL, keeping
+// the order of the others. Names are matched case-insensitively and a name
+// ending in "*" matches every parameter with that prefix.
+func StripTrackingParams(urlStr string, trackingParams []string) string {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || parsedURL.RawQuery == "" || len(trackingParams) == 0 {
+		return urlStr
+	}
+
+	pairs := strings.Split(parsedURL.RawQuery, "&")
+	kept := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(name); err == nil && isTrackingParam(name, trackingParams) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	if len(kept) == len(pairs) {
+		return urlStr
+	}
+
+	parsedURL.RawQuery = strings.Join(kept, "&")
+	return parsedURL.String()
+}
+
+func isTrackingParam(name string, trackingParams []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range trackingParams {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters and
+// uppercases the hex digits of all other escapes
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves "." and ".." path segments as described in
+// RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	var out []string
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,52 @@
+package models
+
+import "testing"
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"HTTP://Example.COM", "http://example.com/"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com./a/./b/../c", "https://example.com/a/c"},
+		{"https://example.com/a/b/..", "https://example.com/a/"},
+		{"https://example.com/../a", "https://example.com/a"},
+		{"https://example.com/%7euser/%2fx", "https://example.com/~user/%2Fx"},
+		{"https://example.com/?b=2&a=1&b=1&&c", "https://example.com/?a=1&b=2&b=1&c"},
+		{"https://Bücher.example/", "https://xn--bcher-kva.example/"},
+		{"http://[2001:DB8::1]:80/", "http://[2001:db8::1]/"},
+		{"https://example.com/page#Section", "https://example.com/page#Section"},
+	}
+
+	for _, tt := range tests {
+		got, err := CanonicalizeURL(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("CanonicalizeURL(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestSanitizeURL(t *testing.T) {
+	params := []string{"utm_*", "fbclid", "gclid"}
+
+	tests := []struct {
+		in, want string
+	}{
+		{" https://example.com/a?z=1&utm_source=x&UTM_Medium=y&b=2 ", "https://example.com/a?z=1&b=2"},
+		{"https://example.com/?fbclid=abc", "https://example.com/"},
+		{"https://example.com/?q=utm_source", "https://example.com/?q=utm_source"},
+		{"https://example.com/?gclid", "https://example.com/"},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeURL(tt.in, params); got != tt.want {
+			t.Errorf("SanitizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got := SanitizeURL("https://example.com/?utm_source=x", nil); got != "https://example.com/?utm_source=x" {
+		t.Errorf("SanitizeURL without params = %q", got)
+	}
+}
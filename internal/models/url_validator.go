@@ -39,7 +39,7 @@ func ValidateURL(urlStr string) error {
 	}
 
 	// Check scheme
-	if !strings.HasPrefix(parsedURL.Scheme, "http") {
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
 		return &ValidationError{
 			Field:   "url",
 			Message: "URL must use HTTP or HTTPS scheme",
@@ -78,21 +78,8 @@ func ValidateURL(urlStr string) error {
 	return nil
 }
 
-// SanitizeURL cleans the URL while preserving its functionality
-func SanitizeURL(urlStr string) string {
-	// Trim whitespace
-	urlStr = strings.TrimSpace(urlStr)
-
-	// Remove common tracking parameters (expand as needed)
-	if parsedURL, err := url.Parse(urlStr); err == nil {
-		q := parsedURL.Query()
-		trackingParams := []string{"utm_source", "utm_medium", "utm_campaign", "fbclid", "gclid"}
-		for _, param := range trackingParams {
-			q.Del(param)
-		}
-		parsedURL.RawQuery = q.Encode()
-		return parsedURL.String()
-	}
-
-	return urlStr
+// SanitizeURL cleans the URL while preserving its functionality: surrounding
+// whitespace and the given tracking parameters are removed
+func SanitizeURL(urlStr string, trackingParams []string) string {
+	return StripTrackingParams(strings.TrimSpace(urlStr), trackingParams)
 }
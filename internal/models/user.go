@@ -1,20 +1,58 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
 type User struct {
 	ID           int       `json:"id"`
 	Username     string    `json:"username" validate:"required,min=3,max=50"`
+	Email        string    `json:"email,omitempty"`
 	PasswordHash string    `json:"-"`
+	IsAdmin      bool      `json:"isAdmin,omitempty"`
+	TOTPEnabled  bool      `json:"totpEnabled"`
+	TOTPSecret   string    `json:"-"`
+	TOTPLastStep int64     `json:"-"`
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
+// ContactAddress returns the address account notifications are delivered to.
+// Accounts created without an email fall back to an email-style username.
+func (u *User) ContactAddress() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	if strings.Contains(u.Username, "@") {
+		return u.Username
+	}
+	return ""
+}
+
 type SignupRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=50"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email    string `json:"email,omitempty" validate:"omitempty,email"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// Validate checks the signup request against the username rules and the
+// given password policy.
+func (r *SignupRequest) Validate(policy PasswordPolicy) error {
+	username := strings.TrimSpace(r.Username)
+	if len(username) < 3 || len(username) > 50 {
+		return &ValidationError{
+			Field:   "username",
+			Message: "Username must be between 3 and 50 characters",
+		}
+	}
+	if r.Email != "" && !strings.Contains(r.Email, "@") {
+		return &ValidationError{
+			Field:   "email",
+			Message: "Invalid email address",
+		}
+	}
+	return policy.Validate("password", r.Password)
 }
 
 type LoginRequest struct {
@@ -25,4 +63,67 @@ type LoginRequest struct {
 type AuthResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
-} 
\ No newline at end of file
+}
+
+// MFAChallengeResponse is returned by login when the account has two-factor
+// authentication enabled. The MFA token is exchanged for a real token at
+// /auth/login/mfa together with a TOTP or recovery code.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int    `json:"expiresIn"`
+}
+
+// MFALoginRequest completes a login that requires a second factor. Either
+// Code or RecoveryCode must be set.
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfaToken" validate:"required"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+// TOTPEnrollmentResponse contains the pending secret of a TOTP enrollment
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// TOTPCodeRequest carries a TOTP code, e.g. to confirm an enrollment
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// RecoveryCodesResponse returns newly generated recovery codes. They are
+// only shown once; just their hashes are stored.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// DisableTOTPRequest turns off two-factor authentication for the current user
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// ChangePasswordRequest represents the request body for changing the password
+// of the authenticated user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+// PasswordResetRequest starts the password reset flow for an account
+type PasswordResetRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// PasswordResetConfirmRequest completes the password reset flow
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required"`
+}
+
+// DeleteAccountRequest confirms account deletion with the current password
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
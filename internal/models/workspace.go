@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+)
+
+// WorkspaceRole is the role of a member within a workspace
+type WorkspaceRole string
+
+const (
+	RoleOwner  WorkspaceRole = "owner"
+	RoleEditor WorkspaceRole = "editor"
+	RoleViewer WorkspaceRole = "viewer"
+)
+
+var roleRank = map[WorkspaceRole]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Valid reports whether r is a known role
+func (r WorkspaceRole) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of other
+func (r WorkspaceRole) Includes(other WorkspaceRole) bool {
+	return r.Valid() && roleRank[r] >= roleRank[other]
+}
+
+// Workspace groups short URLs shared by its members
+type Workspace struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name" validate:"required,min=1,max=100"`
+	CreatedBy int           `json:"createdBy"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Role      WorkspaceRole `json:"role,omitempty"` // role of the requesting user
+
+	// StripTrackingParams removes tracking query parameters from the
+	// destinations of the workspace's links
+	StripTrackingParams bool `json:"stripTrackingParams"`
+}
+
+// WorkspaceMember is a user's membership in a workspace
+type WorkspaceMember struct {
+	WorkspaceID int           `json:"workspaceId"`
+	UserID      int           `json:"userId"`
+	Username    string        `json:"username"`
+	Role        WorkspaceRole `json:"role"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// WorkspaceInvitation is a pending invitation to join a workspace
+type WorkspaceInvitation struct {
+	ID          int           `json:"id"`
+	WorkspaceID int           `json:"workspaceId"`
+	Email       string        `json:"email"`
+	Role        WorkspaceRole `json:"role"`
+	InvitedBy   int           `json:"invitedBy"`
+	ExpiresAt   time.Time     `json:"expiresAt"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// CreateWorkspaceRequest represents the request body for creating a workspace
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=100"`
+}
+
+// UpdateWorkspaceSettingsRequest changes the settings of a workspace. Omitted
+// fields are left unchanged.
+type UpdateWorkspaceSettingsRequest struct {
+	StripTrackingParams *bool `json:"stripTrackingParams,omitempty"`
+}
+
+// InviteMemberRequest represents the request body for inviting a user
+type InviteMemberRequest struct {
+	Email string        `json:"email" validate:"required,email"`
+	Role  WorkspaceRole `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// UpdateMemberRequest changes the role of a member
+type UpdateMemberRequest struct {
+	Role WorkspaceRole `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// AcceptInvitationRequest joins a workspace using an invitation token
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"fmt"
+
+	"url_shortener/internal/config"
+)
+
+// Message is a notification addressed to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to users, e.g. password reset links
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// New returns the Notifier selected by the configuration
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "", "log":
+		return NewLogNotifier(), nil
+	case "file":
+		return NewFileNotifier(cfg.FilePath), nil
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("notifier: smtp host is required")
+		}
+		return NewSMTPNotifier(cfg.SMTP), nil
+	default:
+		return nil, fmt.Errorf("notifier: unknown type %q", cfg.Type)
+	}
+}
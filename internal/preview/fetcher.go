@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+var (
+	errTooManyRedirects = errors.New("preview: too many redirects")
+	errNotHTML          = errors.New("preview: not an HTML page")
+)
+
+// Fetcher loads destination pages and parses their previews
+type Fetcher struct {
+	client       *http.Client
+	maxBytes     int64
+	maxRedirects int
+	userAgent    string
+}
+
+// NewFetcher creates a Fetcher. client should not follow redirects, the
+// Fetcher follows them itself so that each hop is checked; use
+// urlcheck.NewHTTPClient to keep requests away from private addresses.
+func NewFetcher(client *http.Client, cfg config.PreviewConfig) *Fetcher {
+	f := &Fetcher{
+		client:       client,
+		maxBytes:     cfg.MaxBytes,
+		maxRedirects: cfg.MaxRedirects,
+		userAgent:    cfg.UserAgent,
+	}
+	if f.maxBytes <= 0 {
+		f.maxBytes = 512 << 10
+	}
+	if f.maxRedirects < 0 {
+		f.maxRedirects = 0
+	}
+	if f.userAgent == "" {
+		f.userAgent = "url-shortener-preview/1.0"
+	}
+	return f
+}
+
+// Fetch requests the page at rawURL, following up to maxRedirects http and
+// https redirects, and parses the start of it. It fails unless the final
+// response is a successful HTML page.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+	var preview models.LinkPreview
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return preview, err
+	}
+
+	for redirects := 0; ; redirects++ {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return preview, fmt.Errorf("preview: unsupported scheme %q", u.Scheme)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return preview, err
+		}
+		req.Header.Set("User-Agent", f.userAgent)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return preview, err
+		}
+
+		if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			resp.Body.Close()
+			if redirects == f.maxRedirects {
+				return preview, errTooManyRedirects
+			}
+			if u, err = u.Parse(location); err != nil {
+				return preview, err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return preview, fmt.Errorf("preview: status %d", resp.StatusCode)
+		}
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+			return preview, errNotHTML
+		}
+
+		return Parse(io.LimitReader(resp.Body, f.maxBytes), u), nil
+	}
+}
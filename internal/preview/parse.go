@@ -0,0 +1,233 @@
+// Package preview fetches the destination pages of short URLs and reads
+// their title, OpenGraph data and favicon for link previews.
+package preview
+
+import (
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"url_shortener/internal/models"
+)
+
+// Longest values kept, matching the columns they are stored in
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 1000
+	maxURLLength         = 2048
+)
+
+// Parse reads the head of an HTML page and returns its preview. OpenGraph
+// values win over Twitter card values, which win over the <title> and the
+// description meta tag. URLs are resolved against base, the address the page
+// was loaded from; the favicon defaults to /favicon.ico. The page is read as
+// UTF-8 and parsing stops at <body>, so r should already be limited.
+func Parse(r io.Reader, base *url.URL) models.LinkPreview {
+	data, _ := io.ReadAll(r)
+	doc := string(data)
+
+	found := map[string]string{}
+	keep := func(key, value string) {
+		if _, ok := found[key]; !ok && strings.TrimSpace(value) != "" {
+			found[key] = value
+		}
+	}
+
+	for i := 0; i < len(doc); {
+		lt := strings.IndexByte(doc[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		if strings.HasPrefix(doc[i:], "<!--") {
+			end := strings.Index(doc[i+4:], "-->")
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		name, attrs, n := parseTag(doc[i:])
+		if name == "" {
+			i++
+			continue
+		}
+		i += n
+
+		switch name {
+		case "title", "script", "style", "noscript", "template":
+			// Their content is text, not tags
+			end := indexFold(doc[i:], "</"+name)
+			if end < 0 {
+				end = len(doc) - i
+			}
+			if name == "title" {
+				keep("title", html.UnescapeString(doc[i:i+end]))
+			}
+			i += end
+		case "meta":
+			key := strings.ToLower(attrs["property"])
+			if key == "" {
+				key = strings.ToLower(attrs["name"])
+			}
+			switch key {
+			case "og:title", "og:description", "og:site_name", "twitter:title", "twitter:description", "description":
+				keep(key, attrs["content"])
+			case "og:image", "og:image:url", "og:image:secure_url":
+				keep("og:image", attrs["content"])
+			case "twitter:image", "twitter:image:src":
+				keep("twitter:image", attrs["content"])
+			}
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				if rel == "icon" || rel == "apple-touch-icon" {
+					keep(rel, attrs["href"])
+				}
+			}
+		case "body", "/head":
+			i = len(doc)
+		}
+	}
+
+	favicon := resolve(base, first(found["icon"], found["apple-touch-icon"]))
+	if favicon == "" {
+		favicon = resolve(base, "/favicon.ico")
+	}
+	return models.LinkPreview{
+		Title:       clean(first(found["og:title"], found["twitter:title"], found["title"]), maxTitleLength),
+		Description: clean(first(found["og:description"], found["twitter:description"], found["description"]), maxDescriptionLength),
+		ImageURL:    resolve(base, first(found["og:image"], found["twitter:image"])),
+		SiteName:    clean(found["og:site_name"], maxTitleLength),
+		FaviconURL:  favicon,
+	}
+}
+
+// parseTag parses the start or end tag at the beginning of s and returns its
+// lowercase name, its attributes with lowercase names and unescaped values,
+// and its length. The name is empty if s doesn't start with a tag.
+func parseTag(s string) (string, map[string]string, int) {
+	i := 1
+	for i < len(s) && (isNameByte(s[i]) || (i == 1 && s[i] == '/')) {
+		i++
+	}
+	name := strings.ToLower(s[1:i])
+	if name == "" || name == "/" {
+		return "", nil, 0
+	}
+
+	attrs := map[string]string{}
+	for i < len(s) {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+		if s[i] == '>' {
+			return name, attrs, i + 1
+		}
+		if s[i] == '/' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i == len(s) || s[i] != '=' {
+			if _, ok := attrs[key]; !ok {
+				attrs[key] = ""
+			}
+			continue
+		}
+		i++
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				end = len(s) - i - 1
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start := i
+			for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+				i++
+			}
+			value = s[start:i]
+		}
+		// The first of repeated attributes counts
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+	return name, attrs, len(s)
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == ':'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// indexFold returns the index of the first instance of the ASCII string sub
+// in s, ignoring case, or -1
+func indexFold(s, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(sub)], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace, drops invalid UTF-8 and cuts s to at most max
+// characters
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:max]))
+}
+
+// resolve returns ref resolved against base if the result is a usable http
+// or https URL, or ""
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	s := u.String()
+	if len(s) > maxURLLength || !utf8.ValidString(s) {
+		return ""
+	}
+	return s
+}
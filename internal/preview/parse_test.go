@@ -0,0 +1,94 @@
+package preview
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"url_shortener/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+
+	tests := []struct {
+		name string
+		page string
+		want models.LinkPreview
+	}{
+		{
+			name: "opengraph",
+			page: `<!DOCTYPE html><html><head>
+				<title>Plain title</title>
+				<meta property="og:title" content="OG &amp; title">
+				<meta property="og:description" content="  An
+					article ">
+				<meta name="description" content="Plain description">
+				<meta property="og:image" content="/img/cover.png">
+				<meta property="og:site_name" content="Example">
+				<link rel="shortcut icon" href="//cdn.example.com/fav.ico">
+			</head><body><meta property="og:title" content="ignored"></body></html>`,
+			want: models.LinkPreview{
+				Title:       "OG & title",
+				Description: "An article",
+				ImageURL:    "https://example.com/img/cover.png",
+				SiteName:    "Example",
+				FaviconURL:  "https://cdn.example.com/fav.ico",
+			},
+		},
+		{
+			name: "plain",
+			page: `<HTML><HEAD><TITLE>Caf&eacute; <b>menu</b></TITLE>
+				<META NAME=description CONTENT=Lunch>
+				<link rel=apple-touch-icon href="touch.png"/>
+				</HEAD>`,
+			want: models.LinkPreview{
+				Title:       "Café <b>menu</b>",
+				Description: "Lunch",
+				FaviconURL:  "https://example.com/blog/touch.png",
+			},
+		},
+		{
+			name: "twitter card",
+			page: `<head><meta name="twitter:title" content="Card"><meta name="twitter:image" content="https://img.example.com/a.jpg"></head>`,
+			want: models.LinkPreview{
+				Title:      "Card",
+				ImageURL:   "https://img.example.com/a.jpg",
+				FaviconURL: "https://example.com/favicon.ico",
+			},
+		},
+		{
+			name: "comments and scripts are skipped",
+			page: `<head><!-- <title>Comment</title> --><script>var s = "<title>Script</title>";</script>
+				<meta property="og:image" content="javascript:alert(1)"><title>Real</title></head>`,
+			want: models.LinkPreview{
+				Title:      "Real",
+				FaviconURL: "https://example.com/favicon.ico",
+			},
+		},
+		{
+			name: "not html",
+			page: `just some text`,
+			want: models.LinkPreview{FaviconURL: "https://example.com/favicon.ico"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(strings.NewReader(tt.page), base)
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTruncates(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	page := "<title>" + strings.Repeat("é", 300) + "</title>"
+
+	got := Parse(strings.NewReader(page), base)
+	if got.Title != strings.Repeat("é", maxTitleLength) {
+		t.Errorf("Title has %d characters, want %d", len([]rune(got.Title)), maxTitleLength)
+	}
+}
@@ -0,0 +1,125 @@
+package preview
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Store is the part of the short URL repository used by the refresher
+type Store interface {
+	ListForPreview(limit int) ([]*models.ShortURL, error)
+	UpdatePreview(id int, originalURL string, preview models.LinkPreview) error
+}
+
+// Refresher fetches the previews of new links and of links whose destination
+// changed, which the repository lists as having none
+type Refresher struct {
+	store       Store
+	fetcher     *Fetcher
+	interval    time.Duration
+	concurrency int
+	batchSize   int
+	now         func() time.Time
+}
+
+// NewRefresher creates a Refresher that fetches pages with client, see
+// NewFetcher.
+func NewRefresher(store Store, client *http.Client, cfg config.PreviewConfig) *Refresher {
+	r := &Refresher{
+		store:       store,
+		fetcher:     NewFetcher(client, cfg),
+		interval:    time.Duration(cfg.IntervalSeconds) * time.Second,
+		concurrency: cfg.Concurrency,
+		batchSize:   cfg.BatchSize,
+		now:         time.Now,
+	}
+	if r.interval <= 0 {
+		r.interval = 15 * time.Second
+	}
+	if r.concurrency <= 0 {
+		r.concurrency = 4
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = 50
+	}
+	return r
+}
+
+// Run refreshes a batch of previews every interval until ctx is cancelled
+func (r *Refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Refresh(ctx); err != nil {
+			logger.GetLogger().Error("Preview refresh failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the previews of up to one batch of links and returns how
+// many were stored. A page that can't be fetched is stored as an empty
+// preview, so it isn't tried again until the destination changes.
+func (r *Refresher) Refresh(ctx context.Context) (int, error) {
+	batch, err := r.store.ListForPreview(r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan *models.ShortURL)
+	var stored int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for su := range jobs {
+				preview, err := r.fetcher.Fetch(ctx, su.OriginalURL)
+				if ctx.Err() != nil {
+					continue
+				}
+				if err != nil {
+					logger.GetLogger().Debug("Could not fetch link preview", zap.String("short_code", su.ShortCode), zap.Error(err))
+					preview = models.LinkPreview{}
+				}
+				preview.FetchedAt = r.now()
+				if err := r.store.UpdatePreview(su.ID, su.OriginalURL, preview); err != nil {
+					logger.GetLogger().Error("Failed to store link preview", zap.String("short_code", su.ShortCode), zap.Error(err))
+					continue
+				}
+				mu.Lock()
+				stored++
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, su := range batch {
+		select {
+		case jobs <- su:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return stored, ctx.Err()
+}
@@ -0,0 +1,87 @@
+package preview
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	links    []*models.ShortURL
+	previews map[int]models.LinkPreview
+}
+
+func (s *fakeStore) ListForPreview(limit int) ([]*models.ShortURL, error) {
+	if len(s.links) > limit {
+		return s.links[:limit], nil
+	}
+	return s.links, nil
+}
+
+func (s *fakeStore) UpdatePreview(id int, originalURL string, preview models.LinkPreview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previews[id] = preview
+	return nil
+}
+
+func TestRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<title>Page</title>`))
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	store := &fakeStore{previews: map[int]models.LinkPreview{}}
+	for i, path := range []string{"/page", "/moved", "/loop", "/image", "/missing"} {
+		store.links = append(store.links, &models.ShortURL{ID: i + 1, ShortCode: path, OriginalURL: server.URL + path})
+	}
+
+	fetchedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRefresher(store, client, config.PreviewConfig{MaxRedirects: 3})
+	r.now = func() time.Time { return fetchedAt }
+
+	stored, err := r.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if stored != 5 {
+		t.Errorf("stored = %d, want 5", stored)
+	}
+
+	for id, want := range map[int]models.LinkPreview{
+		1: {Title: "Page", FaviconURL: server.URL + "/favicon.ico", FetchedAt: fetchedAt},
+		2: {Title: "Page", FaviconURL: server.URL + "/favicon.ico", FetchedAt: fetchedAt},
+		3: {FetchedAt: fetchedAt},
+		4: {FetchedAt: fetchedAt},
+		5: {FetchedAt: fetchedAt},
+	} {
+		if got := store.previews[id]; got != want {
+			t.Errorf("link %d: preview = %+v, want %+v", id, got, want)
+		}
+	}
+}
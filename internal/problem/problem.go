@@ -0,0 +1,134 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json).
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// requestIDHeader is set on every response by the request ID middleware
+const requestIDHeader = "X-Request-ID"
+
+// Code identifies the kind of error. Codes are part of the API and must not
+// change; clients should branch on them instead of the human readable detail.
+type Code string
+
+const (
+	CodeInvalidBody        Code = "invalid_body"
+	CodeBodyTooLarge       Code = "body_too_large"
+	CodeInvalidParameter   Code = "invalid_parameter"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthorized       Code = "unauthorized" // no credentials
+	CodeInvalidToken       Code = "invalid_token"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeInvalidMFACode     Code = "invalid_mfa_code"
+	CodeMFANotEnrolled     Code = "mfa_not_enrolled"
+	CodeForbidden          Code = "forbidden"
+	CodeInsufficientRole   Code = "insufficient_role"
+	CodeNotFound           Code = "not_found"
+	CodeExpired            Code = "expired"
+	CodeConflict           Code = "conflict"
+	CodePreconditionFailed Code = "precondition_failed" // If-Match doesn't match
+	CodeAlreadyExists      Code = "already_exists"
+	CodeRequestInProgress  Code = "request_in_progress"    // same Idempotency-Key still being handled
+	CodeIdempotencyKeyUsed Code = "idempotency_key_reused" // same Idempotency-Key, different request
+	CodeRateLimited        Code = "rate_limited"
+	CodeLoginThrottled     Code = "login_throttled"
+	CodeUpstreamFailed     Code = "upstream_failed"
+	CodeTimeout            Code = "timeout" // not done in time, retry
+	CodeInternal           Code = "internal_error"
+)
+
+// Problem is the body of an error response. Type is always about:blank, so
+// Title is the status text and Code carries the error kind.
+type Problem struct {
+	Type      string                    `json:"type"`
+	Title     string                    `json:"title"`
+	Status    int                       `json:"status"`
+	Detail    string                    `json:"detail,omitempty"`
+	Instance  string                    `json:"instance,omitempty"`
+	Code      Code                      `json:"code"`
+	RequestID string                    `json:"requestId,omitempty"`
+	Errors    []*models.ValidationError `json:"errors,omitempty"`
+	// WorkspaceIDs lists the workspaces that keep a request from succeeding,
+	// e.g. those the user is the only owner of
+	WorkspaceIDs []int `json:"workspaceIds,omitempty"`
+}
+
+// New builds a problem for the request
+func New(r *http.Request, status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+// Write writes p as the response
+func (p *Problem) Write(w http.ResponseWriter) {
+	p.RequestID = w.Header().Get(requestIDHeader)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Write writes a problem response
+func Write(w http.ResponseWriter, r *http.Request, status int, code Code, detail string) {
+	New(r, status, code, detail).Write(w)
+}
+
+// ValidationFailed writes a 400 response listing the invalid fields
+func ValidationFailed(w http.ResponseWriter, r *http.Request, errs ...*models.ValidationError) {
+	p := New(r, http.StatusBadRequest, CodeValidationFailed, "")
+	p.Errors = errs
+	if len(errs) == 1 {
+		p.Detail = errs[0].Error()
+	} else {
+		p.Detail = "The request has invalid fields"
+	}
+	p.Write(w)
+}
+
+// Field writes a 400 response for a single invalid field
+func Field(w http.ResponseWriter, r *http.Request, field, message string) {
+	ValidationFailed(w, r, &models.ValidationError{Field: field, Message: message})
+}
+
+// Invalid writes a 400 response for err, with field details if it is a
+// *models.ValidationError
+func Invalid(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		ValidationFailed(w, r, validationErr)
+		return
+	}
+	Write(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+}
+
+// Internal logs err with msg and writes a 500 response that doesn't reveal it
+func Internal(w http.ResponseWriter, r *http.Request, msg string, err error, fields ...zap.Field) {
+	fields = append(fields,
+		zap.String("request_id", w.Header().Get(requestIDHeader)),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Error(err),
+	)
+	logger.GetLogger().Error(msg, fields...)
+
+	Write(w, r, http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
@@ -0,0 +1,98 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url_shortener/internal/models"
+)
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	r := httptest.NewRequest(http.MethodGet, "/api/shorten/abc123", nil)
+
+	Write(rec, r, http.StatusNotFound, CodeNotFound, "Short URL not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	p := decode(t, rec)
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "Short URL not found",
+		Instance:  "/api/shorten/abc123",
+		Code:      CodeNotFound,
+		RequestID: "req-1",
+	}
+	if p.Type != want.Type || p.Title != want.Title || p.Status != want.Status || p.Detail != want.Detail ||
+		p.Instance != want.Instance || p.Code != want.Code || p.RequestID != want.RequestID {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestValidationFailed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+
+	ValidationFailed(rec, r,
+		&models.ValidationError{Field: "url", Message: "is required"},
+		&models.ValidationError{Field: "fallbackUrl", Message: "Invalid URL format"},
+	)
+
+	p := decode(t, rec)
+	if rec.Code != http.StatusBadRequest || p.Code != CodeValidationFailed {
+		t.Errorf("got status %d code %q, want 400 %q", rec.Code, p.Code, CodeValidationFailed)
+	}
+	if len(p.Errors) != 2 || p.Errors[0].Field != "url" || p.Errors[1].Field != "fallbackUrl" {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/auth/signup", nil)
+
+	Invalid(rec, r, &models.ValidationError{Field: "password", Message: "too short"})
+
+	p := decode(t, rec)
+	if p.Code != CodeValidationFailed || len(p.Errors) != 1 || p.Errors[0].Field != "password" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestInternalHidesError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/shorten", nil)
+
+	Internal(rec, r, "Failed to list short URLs", errors.New("Error 1146: Table 'short_urls' doesn't exist"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "1146") || strings.Contains(body, "short_urls") {
+		t.Errorf("response leaks the internal error: %s", body)
+	}
+	if p := decode(t, rec); p.Code != CodeInternal {
+		t.Errorf("code = %q, want %q", p.Code, CodeInternal)
+	}
+}
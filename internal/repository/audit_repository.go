@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"url_shortener/internal/models"
+)
+
+// AuditFilter selects the events returned by AuditRepository.List. Zero
+// fields are ignored. Events are returned newest first; BeforeID continues a
+// listing after the last event of the previous page.
+type AuditFilter struct {
+	ActorID    int
+	Action     models.AuditAction
+	TargetType string
+	TargetID   string
+	BeforeID   int64
+	Limit      int
+}
+
+// AuditRepository gives access to the append-only audit log. Events that
+// accompany a mutation are written by the mutating repository in the same
+// transaction; Record is for standalone events such as logins.
+type AuditRepository interface {
+	Record(event *models.AuditEvent) error
+	List(filter AuditFilter) ([]*models.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordAuditEvent inserts an audit event using exec, usually the
+// transaction of the mutation it describes
+func recordAuditEvent(exec execer, event *models.AuditEvent) error {
+	result, err := exec.Exec(`
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, before_value, after_value, ip, user_agent, request_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		nullInt(event.ActorID),
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		nullString(event.IP),
+		nullString(truncate(event.UserAgent, 255)),
+		nullString(event.RequestID),
+		event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// recordAudit builds an event from the audit context and inserts it
+func recordAudit(exec execer, ac models.AuditContext, action models.AuditAction, targetType, targetID string, before, after interface{}) error {
+	event, err := ac.NewEvent(action, targetType, targetID, before, after)
+	if err != nil {
+		return err
+	}
+	return recordAuditEvent(exec, event)
+}
+
+func (r *auditRepository) Record(event *models.AuditEvent) error {
+	return recordAuditEvent(r.db, event)
+}
+
+func (r *auditRepository) List(filter AuditFilter) ([]*models.AuditEvent, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+
+	var conditions []string
+	var args []interface{}
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.BeforeID != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := `
+		SELECT id, actor_id, action, target_type, target_id, before_value, after_value, ip, user_agent, request_id, created_at
+		FROM audit_events
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var actorID sql.NullInt64
+		var before, after []byte
+		var ip, userAgent, requestID sql.NullString
+		err := rows.Scan(
+			&event.ID,
+			&actorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&before,
+			&after,
+			&ip,
+			&userAgent,
+			&requestID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.ActorID = int(actorID.Int64)
+		event.Before = before
+		event.After = after
+		event.IP = ip.String
+		event.UserAgent = userAgent.String
+		event.RequestID = requestID.String
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("tag or collection not found")
+	ErrGroupNameTaken = errors.New("tag or collection name already taken")
+)
+
+// GroupRepository stores tags and collections of links
+type GroupRepository interface {
+	Create(group *models.LinkGroup) error
+	Get(kind models.GroupKind, id int) (*models.LinkGroup, error)
+	List(kind models.GroupKind, userID, workspaceID int) ([]*models.LinkGroup, error)
+	Update(group *models.LinkGroup) error
+	Delete(kind models.GroupKind, id int) error
+	AddLinks(groupID int, shortURLIDs []int) (int64, error)
+	RemoveLink(groupID, shortURLID int) error
+	Stats(groupID int, since time.Time) (*models.GroupStats, error)
+}
+
+type groupRepository struct {
+	db *sql.DB
+}
+
+func NewGroupRepository(db *sql.DB) GroupRepository {
+	return &groupRepository{db: db}
+}
+
+// groupColumns is the column list scanned by scanGroup, with the number of
+// links of the group that aren't in the trash
+const groupColumns = `g.id, g.kind, g.name, g.description, g.user_id, g.workspace_id, g.created_at,
+	(SELECT COUNT(*) FROM link_group_links m JOIN short_urls s ON s.id = m.short_url_id WHERE m.group_id = g.id AND s.deleted_at IS NULL)`
+
+// Create inserts a tag or collection. It returns ErrGroupNameTaken if its
+// owner already has one of the kind with the same name.
+func (r *groupRepository) Create(group *models.LinkGroup) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkGroupName(tx, group); err != nil {
+		return err
+	}
+
+	group.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO link_groups (kind, name, description, user_id, workspace_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, group.Kind, group.Name, nullString(group.Description), nullInt(group.UserID), nullInt(group.WorkspaceID), group.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	group.ID = int(id)
+	group.LinkCount = 0
+
+	return tx.Commit()
+}
+
+// Get retrieves a tag or collection by ID.
+func (r *groupRepository) Get(kind models.GroupKind, id int) (*models.LinkGroup, error) {
+	query := `SELECT ` + groupColumns + ` FROM link_groups g WHERE g.id = ? AND g.kind = ?`
+
+	group, err := scanGroup(r.db.QueryRow(query, id, kind))
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	return group, err
+}
+
+// List returns the tags or collections of a workspace, or of a user when
+// workspaceID is 0, by name.
+func (r *groupRepository) List(kind models.GroupKind, userID, workspaceID int) ([]*models.LinkGroup, error) {
+	query := `SELECT ` + groupColumns + ` FROM link_groups g WHERE g.kind = ? `
+	args := []interface{}{kind}
+	if workspaceID != 0 {
+		query += `AND g.workspace_id = ? `
+		args = append(args, workspaceID)
+	} else {
+		query += `AND g.user_id = ? AND g.workspace_id IS NULL `
+		args = append(args, userID)
+	}
+	query += `ORDER BY g.name, g.id`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*models.LinkGroup{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// Update sets the name and description of a tag or collection. Like Create
+// it returns ErrGroupNameTaken if another one has the name.
+func (r *groupRepository) Update(group *models.LinkGroup) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM link_groups WHERE id = ? AND kind = ? FOR UPDATE`, group.ID, group.Kind).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := checkGroupName(tx, group); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE link_groups
+		SET name = ?, description = ?
+		WHERE id = ?
+	`, group.Name, nullString(group.Description), group.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a tag or collection; its links stay.
+func (r *groupRepository) Delete(kind models.GroupKind, id int) error {
+	result, err := r.db.Exec(`DELETE FROM link_groups WHERE id = ? AND kind = ?`, id, kind)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// AddLinks adds links to a tag or collection and returns how many weren't
+// in it yet. The caller checks that the links belong to its owner.
+func (r *groupRepository) AddLinks(groupID int, shortURLIDs []int) (int64, error) {
+	if len(shortURLIDs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	args := make([]interface{}, 0, len(shortURLIDs)*3)
+	for _, id := range shortURLIDs {
+		args = append(args, groupID, id, now)
+	}
+	query := `INSERT IGNORE INTO link_group_links (group_id, short_url_id, created_at) VALUES ` + placeholders(len(shortURLIDs), 3)
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RemoveLink removes a link from a tag or collection. It returns
+// ErrShortURLNotFound if the link isn't in it.
+func (r *groupRepository) RemoveLink(groupID, shortURLID int) error {
+	result, err := r.db.Exec(`DELETE FROM link_group_links WHERE group_id = ? AND short_url_id = ?`, groupID, shortURLID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrShortURLNotFound
+	}
+	return nil
+}
+
+// Stats sums the all-time clicks of the links of a tag or collection and
+// their clicks per day since the day of since. Links in the trash are left
+// out.
+func (r *groupRepository) Stats(groupID int, since time.Time) (*models.GroupStats, error) {
+	stats := models.GroupStats{Daily: []models.DailyClicks{}}
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(s.access_count), 0)
+		FROM link_group_links m
+		JOIN short_urls s ON s.id = m.short_url_id
+		WHERE m.group_id = ? AND s.deleted_at IS NULL
+	`, groupID).Scan(&stats.LinkCount, &stats.TotalClicks)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT d.day, SUM(d.clicks)
+		FROM link_group_links m
+		JOIN short_urls s ON s.id = m.short_url_id
+		JOIN daily_clicks d ON d.short_url_id = m.short_url_id
+		WHERE m.group_id = ? AND s.deleted_at IS NULL AND d.day >= ?
+		GROUP BY d.day
+		ORDER BY d.day
+	`, groupID, since.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day time.Time
+		var clicks int64
+		if err := rows.Scan(&day, &clicks); err != nil {
+			return nil, err
+		}
+		stats.Daily = append(stats.Daily, models.DailyClicks{Date: day.Format("2006-01-02"), Clicks: clicks})
+	}
+
+	return &stats, rows.Err()
+}
+
+// checkGroupName locks the groups of the owner and kind of group with its
+// name, including the gap where one would go, and returns ErrGroupNameTaken
+// if one other than group exists.
+func checkGroupName(tx *sql.Tx, group *models.LinkGroup) error {
+	query := `SELECT id FROM link_groups WHERE kind = ? AND name = ? `
+	args := []interface{}{group.Kind, group.Name}
+	if group.WorkspaceID != 0 {
+		query += `AND workspace_id = ? `
+		args = append(args, group.WorkspaceID)
+	} else {
+		query += `AND user_id = ? AND workspace_id IS NULL `
+		args = append(args, group.UserID)
+	}
+	query += `FOR UPDATE`
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		if id != group.ID {
+			return ErrGroupNameTaken
+		}
+	}
+	return rows.Err()
+}
+
+func scanGroup(row rowScanner) (*models.LinkGroup, error) {
+	var group models.LinkGroup
+	var description sql.NullString
+	var userID, workspaceID sql.NullInt64
+	err := row.Scan(
+		&group.ID,
+		&group.Kind,
+		&group.Name,
+		&description,
+		&userID,
+		&workspaceID,
+		&group.CreatedAt,
+		&group.LinkCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	group.Description = description.String
+	group.UserID = int(userID.Int64)
+	group.WorkspaceID = int(workspaceID.Int64)
+	return &group, nil
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+var (
+	ErrImportJobNotFound = errors.New("import job not found")
+)
+
+// ImportResultFilter selects the row results returned by ListResults, in
+// line order; AfterLine continues a listing after the last row of the
+// previous page.
+type ImportResultFilter struct {
+	Status    models.ImportRowStatus
+	AfterLine int
+	Limit     int
+}
+
+// ImportRepository stores import jobs and the results of their rows
+type ImportRepository interface {
+	CreateJob(job *models.ImportJob) error
+	GetJob(id int) (*models.ImportJob, error)
+	StartJob(id int) error
+	RecordResults(id int, results []*models.ImportRowResult) error
+	FinishJob(id int, status models.ImportStatus, errMsg string) error
+	FailInterrupted() (int64, error)
+	ListResults(id int, filter ImportResultFilter) ([]*models.ImportRowResult, error)
+}
+
+type importRepository struct {
+	db *sql.DB
+}
+
+func NewImportRepository(db *sql.DB) ImportRepository {
+	return &importRepository{db: db}
+}
+
+const importJobColumns = `id, user_id, workspace_id, format, on_conflict, status, total_rows, processed_rows, created_rows, failed_rows, error, created_at, finished_at`
+
+// CreateJob stores a new queued job.
+func (r *importRepository) CreateJob(job *models.ImportJob) error {
+	job.Status = models.ImportQueued
+	job.CreatedAt = time.Now()
+
+	result, err := r.db.Exec(`
+		INSERT INTO import_jobs (user_id, workspace_id, format, on_conflict, status, total_rows, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.UserID, nullInt(job.WorkspaceID), job.Format, job.OnConflict, job.Status, job.TotalRows, job.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = int(id)
+	return nil
+}
+
+// GetJob retrieves a job by ID.
+func (r *importRepository) GetJob(id int) (*models.ImportJob, error) {
+	var job models.ImportJob
+	var workspaceID sql.NullInt64
+	var errMsg sql.NullString
+	var finishedAt sql.NullTime
+	err := r.db.QueryRow(`SELECT `+importJobColumns+` FROM import_jobs WHERE id = ?`, id).Scan(
+		&job.ID,
+		&job.UserID,
+		&workspaceID,
+		&job.Format,
+		&job.OnConflict,
+		&job.Status,
+		&job.TotalRows,
+		&job.ProcessedRows,
+		&job.CreatedRows,
+		&job.FailedRows,
+		&errMsg,
+		&job.CreatedAt,
+		&finishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrImportJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	job.WorkspaceID = int(workspaceID.Int64)
+	job.Error = errMsg.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// StartJob marks a queued job as running.
+func (r *importRepository) StartJob(id int) error {
+	_, err := r.db.Exec(`UPDATE import_jobs SET status = ? WHERE id = ?`, models.ImportRunning, id)
+	return err
+}
+
+// RecordResults stores the results of rows and adds them to the job's
+// counters in one transaction, so the counters always match the results.
+func (r *importRepository) RecordResults(id int, results []*models.ImportRowResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var created, failed int
+	args := make([]interface{}, 0, len(results)*6)
+	for _, res := range results {
+		if res.Status == models.ImportRowCreated {
+			created++
+		} else {
+			failed++
+		}
+		args = append(args, id, res.Line, res.Status, nullString(res.ShortCode), nullString(truncate(res.RequestedCode, 255)), nullString(truncate(res.Error, 255)))
+	}
+
+	query := `INSERT INTO import_job_results (job_id, line, status, short_code, requested_code, error) VALUES ` + placeholders(len(results), 6)
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE import_jobs
+		SET processed_rows = processed_rows + ?, created_rows = created_rows + ?, failed_rows = failed_rows + ?
+		WHERE id = ?
+	`, len(results), created, failed, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FinishJob marks a job as completed or failed.
+func (r *importRepository) FinishJob(id int, status models.ImportStatus, errMsg string) error {
+	_, err := r.db.Exec(`
+		UPDATE import_jobs
+		SET status = ?, error = ?, finished_at = ?
+		WHERE id = ?
+	`, status, nullString(errMsg), time.Now(), id)
+	return err
+}
+
+// FailInterrupted marks the jobs that were queued or running when the
+// service stopped as failed. Jobs only run in memory, so they can't resume.
+func (r *importRepository) FailInterrupted() (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE import_jobs
+		SET status = ?, error = ?, finished_at = ?
+		WHERE status IN (?, ?)
+	`, models.ImportFailed, "Interrupted by a restart, rows without a result were not imported", time.Now(), models.ImportQueued, models.ImportRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListResults returns the row results of a job matching filter.
+func (r *importRepository) ListResults(id int, filter ImportResultFilter) ([]*models.ImportRowResult, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	query := `SELECT line, status, short_code, requested_code, error FROM import_job_results WHERE job_id = ? AND line > ? `
+	args := []interface{}{id, filter.AfterLine}
+	if filter.Status != "" {
+		query += `AND status = ? `
+		args = append(args, filter.Status)
+	}
+	query += `ORDER BY line LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.ImportRowResult{}
+	for rows.Next() {
+		var res models.ImportRowResult
+		var shortCode, requestedCode, errMsg sql.NullString
+		if err := rows.Scan(&res.Line, &res.Status, &shortCode, &requestedCode, &errMsg); err != nil {
+			return nil, err
+		}
+		res.ShortCode = shortCode.String
+		res.RequestedCode = requestedCode.String
+		res.Error = errMsg.String
+		results = append(results, &res)
+	}
+
+	return results, rows.Err()
+}
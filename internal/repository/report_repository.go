@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrDuplicateReport = errors.New("report already submitted")
+	ErrReportClosed    = errors.New("report already reviewed")
+)
+
+// ReportFilter selects the reports returned by ReportRepository.List. Reports
+// are returned oldest first so the queue is worked in order; AfterID
+// continues a listing after the last report of the previous page.
+type ReportFilter struct {
+	Status    models.ReportStatus
+	ShortCode string
+	AfterID   int
+	Limit     int
+}
+
+// ReportRepository stores abuse reports and their moderation
+type ReportRepository interface {
+	Create(report *models.LinkReport, suspendThreshold int, ac models.AuditContext) (suspended bool, err error)
+	GetByID(id int) (*models.LinkReport, error)
+	List(filter ReportFilter) ([]*models.LinkReport, error)
+	Dismiss(id int, ac models.AuditContext) error
+	Disable(id int, reason models.ReportReason, ac models.AuditContext) error
+}
+
+type reportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) ReportRepository {
+	return &reportRepository{db: db}
+}
+
+const reportColumns = `r.id, r.short_url_id, s.short_code, r.reason, r.details, r.reporter_ip, r.status, r.reviewed_by, r.reviewed_at, r.created_at`
+
+// Create stores a report about the link with report.ShortCode. Reporters are
+// told apart by report.ReporterNetwork. A reporter can have only one open
+// report per link; further ones fail with ErrDuplicateReport. Once open
+// reports from suspendThreshold distinct reporters exist the link is
+// disabled in the same transaction, with the reason of the report that
+// crossed the threshold.
+func (r *reportRepository) Create(report *models.LinkReport, suspendThreshold int, ac models.AuditContext) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Locking the link serializes reports about it
+	su, err := getForUpdate(tx, report.ShortCode)
+	if err != nil {
+		return false, err
+	}
+
+	var existing int
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM link_reports
+		WHERE short_url_id = ? AND COALESCE(reporter_network, reporter_ip) = ? AND status = 'open'
+	`, su.ID, report.ReporterNetwork).Scan(&existing)
+	if err != nil {
+		return false, err
+	}
+	if existing > 0 {
+		return false, ErrDuplicateReport
+	}
+
+	report.ShortURLID = su.ID
+	report.Status = models.ReportOpen
+	report.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO link_reports (short_url_id, reason, details, reporter_ip, reporter_network, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, su.ID, report.Reason, nullString(report.Details), report.ReporterIP, report.ReporterNetwork, report.Status, report.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	report.ID = int(id)
+
+	suspended := false
+	if suspendThreshold > 0 && su.DisabledAt == nil {
+		var reporters int
+		err = tx.QueryRow(`
+			SELECT COUNT(DISTINCT COALESCE(reporter_network, reporter_ip))
+			FROM link_reports
+			WHERE short_url_id = ? AND status = 'open'
+		`, su.ID).Scan(&reporters)
+		if err != nil {
+			return false, err
+		}
+		if reporters >= suspendThreshold {
+			// The suspension is made by the system, not the reporter
+			if err := setDisabled(tx, su, report.Reason, models.AuditContext{RequestID: ac.RequestID}); err != nil {
+				return false, err
+			}
+			suspended = true
+		}
+	}
+
+	return suspended, tx.Commit()
+}
+
+func (r *reportRepository) GetByID(id int) (*models.LinkReport, error) {
+	query := `SELECT ` + reportColumns + ` FROM link_reports r JOIN short_urls s ON s.id = r.short_url_id WHERE r.id = ?`
+
+	report, err := scanReport(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrReportNotFound
+	}
+	return report, err
+}
+
+func (r *reportRepository) List(filter ReportFilter) ([]*models.LinkReport, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+
+	query := `SELECT ` + reportColumns + ` FROM link_reports r JOIN short_urls s ON s.id = r.short_url_id WHERE r.id > ?`
+	args := []interface{}{filter.AfterID}
+	if filter.Status != "" {
+		query += ` AND r.status = ?`
+		args = append(args, filter.Status)
+	}
+	if filter.ShortCode != "" {
+		query += ` AND s.short_code = ?`
+		args = append(args, filter.ShortCode)
+	}
+	query += ` ORDER BY r.id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*models.LinkReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// Dismiss closes all open reports about the link of the given report. A link
+// that was suspended automatically is enabled again; links disabled by a
+// moderator stay disabled.
+func (r *reportRepository) Dismiss(id int, ac models.AuditContext) error {
+	return r.review(id, ac, func(tx *sql.Tx, su *models.ShortURL, report *models.LinkReport) (models.ReportStatus, error) {
+		if su.DisabledAt != nil && r.autoSuspended(tx, su) {
+			if err := setDisabled(tx, su, "", ac); err != nil {
+				return "", err
+			}
+		}
+		return models.ReportDismissed, nil
+	})
+}
+
+// Disable closes all open reports about the link of the given report as
+// actioned and disables the link. An empty reason uses the report's.
+func (r *reportRepository) Disable(id int, reason models.ReportReason, ac models.AuditContext) error {
+	return r.review(id, ac, func(tx *sql.Tx, su *models.ShortURL, report *models.LinkReport) (models.ReportStatus, error) {
+		if reason == "" {
+			reason = report.Reason
+		}
+		if err := setDisabled(tx, su, reason, ac); err != nil {
+			return "", err
+		}
+		return models.ReportActioned, nil
+	})
+}
+
+// review locks the link of an open report, lets decide act on the link and closes
+// all of the link's open reports with the returned status
+func (r *reportRepository) review(id int, ac models.AuditContext, decide func(*sql.Tx, *models.ShortURL, *models.LinkReport) (models.ReportStatus, error)) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	report, err := scanReport(tx.QueryRow(`SELECT `+reportColumns+` FROM link_reports r JOIN short_urls s ON s.id = r.short_url_id WHERE r.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return ErrReportNotFound
+	} else if err != nil {
+		return err
+	}
+
+	su, err := getForUpdate(tx, report.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	// Re-read the status now that the link is locked
+	if err := tx.QueryRow(`SELECT status FROM link_reports WHERE id = ?`, id).Scan(&report.Status); err != nil {
+		return err
+	}
+	if report.Status != models.ReportOpen {
+		return ErrReportClosed
+	}
+
+	status, err := decide(tx, su, report)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE link_reports
+		SET status = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE short_url_id = ? AND status = 'open'
+	`, status, nullInt(ac.ActorID), time.Now(), su.ID)
+	if err != nil {
+		return err
+	}
+	closed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if status == models.ReportDismissed {
+		after := map[string]int64{"reportsDismissed": closed}
+		if err := recordAudit(tx, ac, models.ActionReportsDismiss, models.TargetShortURL, su.ShortCode, nil, after); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// autoSuspended reports whether the link's current suspension was made by the
+// system rather than a moderator
+func (r *reportRepository) autoSuspended(tx *sql.Tx, su *models.ShortURL) bool {
+	var actorID sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT actor_id
+		FROM audit_events
+		WHERE target_type = ? AND target_id = ? AND action = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, models.TargetShortURL, su.ShortCode, models.ActionShortURLDisable).Scan(&actorID)
+	return err == nil && !actorID.Valid
+}
+
+func scanReport(row rowScanner) (*models.LinkReport, error) {
+	var report models.LinkReport
+	var details sql.NullString
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+
+	err := row.Scan(
+		&report.ID,
+		&report.ShortURLID,
+		&report.ShortCode,
+		&report.Reason,
+		&details,
+		&report.ReporterIP,
+		&report.Status,
+		&reviewedBy,
+		&reviewedAt,
+		&report.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Details = details.String
+	report.ReviewedBy = int(reviewedBy.Int64)
+	if reviewedAt.Valid {
+		report.ReviewedAt = &reviewedAt.Time
+	}
+	return &report, nil
+}
@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+var (
+	ErrRevisionNotFound        = errors.New("revision not found")
+	ErrScheduledChangeNotFound = errors.New("scheduled change not found")
+)
+
+// RevisionRepository serves the revision history of links and their
+// scheduled destination changes. Revisions are written by the short URL
+// repository along with the changes themselves.
+type RevisionRepository interface {
+	ListRevisions(shortURLID, beforeID, limit int) ([]*models.Revision, error)
+	GetRevision(shortURLID, id int) (*models.Revision, error)
+	ScheduleChange(change *models.ScheduledChange, ac models.AuditContext) error
+	ListScheduledChanges(shortURLID int) ([]*models.ScheduledChange, error)
+	CancelScheduledChange(shortURLID, id int, ac models.AuditContext) error
+	ListDueChanges(now time.Time, limit int) ([]*models.ScheduledChange, error)
+	ApplyScheduledChange(change *models.ScheduledChange) error
+}
+
+type revisionRepository struct {
+	db *sql.DB
+}
+
+func NewRevisionRepository(db *sql.DB) RevisionRepository {
+	return &revisionRepository{db: db}
+}
+
+const revisionColumns = `id, short_url_id, version, source, original_url, fallback_url, expires_at, author_id, created_at`
+
+// ListRevisions returns up to limit revisions of a link with an ID below
+// beforeID, newest first. A beforeID of 0 starts with the latest revision.
+func (r *revisionRepository) ListRevisions(shortURLID, beforeID, limit int) ([]*models.Revision, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+
+	query := `SELECT ` + revisionColumns + ` FROM short_url_revisions WHERE short_url_id = ? `
+	args := []interface{}{shortURLID}
+	if beforeID > 0 {
+		query += `AND id < ? `
+		args = append(args, beforeID)
+	}
+	query += `ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevision retrieves a revision of a link.
+func (r *revisionRepository) GetRevision(shortURLID, id int) (*models.Revision, error) {
+	query := `SELECT ` + revisionColumns + ` FROM short_url_revisions WHERE id = ? AND short_url_id = ?`
+
+	rev, err := scanRevision(r.db.QueryRow(query, id, shortURLID))
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	return rev, err
+}
+
+// ScheduleChange stores a destination change to be applied at its
+// ActivateAt.
+func (r *revisionRepository) ScheduleChange(change *models.ScheduledChange, ac models.AuditContext) error {
+	change.CreatedAt = time.Now()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO scheduled_changes (short_url_id, url, canonical_url_hash, resolved_url, unicode_host, flag_reason, activate_at, author_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		change.ShortURLID,
+		change.URL,
+		nullString(change.CanonicalURLHash),
+		nullString(change.ResolvedURL),
+		nullString(change.UnicodeHost),
+		nullString(change.FlagReason),
+		change.ActivateAt,
+		nullInt(change.AuthorID),
+		change.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	change.ID = int(id)
+
+	if err := recordAudit(tx, ac, models.ActionChangeSchedule, models.TargetShortURL, change.ShortCode, nil, change); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const scheduledChangeColumns = `c.id, c.short_url_id, s.short_code, c.url, c.canonical_url_hash, c.resolved_url, c.unicode_host, c.flag_reason, c.activate_at, c.author_id, c.created_at`
+
+// ListScheduledChanges returns the pending changes of a link, earliest first.
+func (r *revisionRepository) ListScheduledChanges(shortURLID int) ([]*models.ScheduledChange, error) {
+	return r.listScheduledChanges(`
+		SELECT `+scheduledChangeColumns+`
+		FROM scheduled_changes c
+		JOIN short_urls s ON s.id = c.short_url_id
+		WHERE c.short_url_id = ?
+		ORDER BY c.activate_at, c.id
+	`, shortURLID)
+}
+
+// CancelScheduledChange deletes a pending change of a link.
+func (r *revisionRepository) CancelScheduledChange(shortURLID, id int, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	change, err := scanScheduledChange(tx.QueryRow(`
+		SELECT `+scheduledChangeColumns+`
+		FROM scheduled_changes c
+		JOIN short_urls s ON s.id = c.short_url_id
+		WHERE c.id = ? AND c.short_url_id = ?
+		FOR UPDATE
+	`, id, shortURLID))
+	if err == sql.ErrNoRows {
+		return ErrScheduledChangeNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM scheduled_changes WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := recordAudit(tx, ac, models.ActionChangeCancel, models.TargetShortURL, change.ShortCode, change, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListDueChanges returns up to limit changes whose time has come, earliest
+// first. Changes of links in the trash wait until they are restored.
+func (r *revisionRepository) ListDueChanges(now time.Time, limit int) ([]*models.ScheduledChange, error) {
+	return r.listScheduledChanges(`
+		SELECT `+scheduledChangeColumns+`
+		FROM scheduled_changes c
+		JOIN short_urls s ON s.id = c.short_url_id
+		WHERE c.activate_at <= ? AND s.deleted_at IS NULL
+		ORDER BY c.activate_at, c.id
+		LIMIT ?
+	`, now, limit)
+}
+
+// ApplyScheduledChange sets the destination of the change's link and deletes
+// the change, recording the change as made by its author. A change that was
+// canceled in the meantime is skipped.
+func (r *revisionRepository) ApplyScheduledChange(change *models.ScheduledChange) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM scheduled_changes WHERE id = ? FOR UPDATE`, change.ID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	before, err := getForUpdate(tx, change.ShortCode)
+	if err != nil {
+		return err
+	}
+	after := *before
+	after.OriginalURL = change.URL
+	after.CanonicalURLHash = change.CanonicalURLHash
+	after.ResolvedURL = change.ResolvedURL
+	after.UnicodeHost = change.UnicodeHost
+	if change.FlagReason != "" {
+		after.FlagReason = change.FlagReason
+	}
+
+	ac := models.AuditContext{ActorID: change.AuthorID}
+	if err := writeChanges(tx, before, &after, models.RevisionScheduled, models.ActionChangeApply, ac); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM scheduled_changes WHERE id = ?`, change.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *revisionRepository) listScheduledChanges(query string, args ...interface{}) ([]*models.ScheduledChange, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.ScheduledChange{}
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// recordRevision stores the state of a link after a change if its
+// destination or attributes changed. Links last changed before revisions
+// were kept get their previous state stored first, so it isn't lost.
+func recordRevision(tx *sql.Tx, before, after *models.ShortURL, source models.RevisionSource, authorID int) error {
+	if before.OriginalURL == after.OriginalURL && before.FallbackURL == after.FallbackURL && sameTime(before.ExpiresAt, after.ExpiresAt) {
+		return nil
+	}
+
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM short_url_revisions WHERE short_url_id = ?)`, before.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	revision := models.RevisionOf(after, source, authorID)
+	if exists {
+		return insertRevisions(tx, revision)
+	}
+	initial := models.RevisionOf(before, models.RevisionInitial, 0)
+	initial.CreatedAt = before.UpdatedAt
+	return insertRevisions(tx, initial, revision)
+}
+
+// insertRevisions stores revisions with a single multi-row insert.
+func insertRevisions(exec execer, revisions ...*models.Revision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(revisions)*8)
+	for _, rev := range revisions {
+		args = append(args, rev.ShortURLID, rev.Version, rev.Source, rev.OriginalURL, nullString(rev.FallbackURL), rev.ExpiresAt, nullInt(rev.AuthorID), rev.CreatedAt)
+	}
+	query := `INSERT INTO short_url_revisions (short_url_id, version, source, original_url, fallback_url, expires_at, author_id, created_at) VALUES ` + placeholders(len(revisions), 8)
+	_, err := exec.Exec(query, args...)
+	return err
+}
+
+func scanRevision(row rowScanner) (*models.Revision, error) {
+	var rev models.Revision
+	var fallbackURL sql.NullString
+	var expiresAt sql.NullTime
+	var authorID sql.NullInt64
+	err := row.Scan(
+		&rev.ID,
+		&rev.ShortURLID,
+		&rev.Version,
+		&rev.Source,
+		&rev.OriginalURL,
+		&fallbackURL,
+		&expiresAt,
+		&authorID,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.FallbackURL = fallbackURL.String
+	if expiresAt.Valid {
+		rev.ExpiresAt = &expiresAt.Time
+	}
+	rev.AuthorID = int(authorID.Int64)
+	return &rev, nil
+}
+
+func scanScheduledChange(row rowScanner) (*models.ScheduledChange, error) {
+	var change models.ScheduledChange
+	var canonicalURLHash, resolvedURL, unicodeHost, flagReason sql.NullString
+	var authorID sql.NullInt64
+	err := row.Scan(
+		&change.ID,
+		&change.ShortURLID,
+		&change.ShortCode,
+		&change.URL,
+		&canonicalURLHash,
+		&resolvedURL,
+		&unicodeHost,
+		&flagReason,
+		&change.ActivateAt,
+		&authorID,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	change.CanonicalURLHash = canonicalURLHash.String
+	change.ResolvedURL = resolvedURL.String
+	change.UnicodeHost = unicodeHost.String
+	change.FlagReason = flagReason.String
+	change.AuthorID = int(authorID.Int64)
+	return &change, nil
+}
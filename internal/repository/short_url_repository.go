@@ -3,21 +3,70 @@ package repository
 import (
     "database/sql"
     "errors"
+    "strings"
     "time"
+    "unicode"
 
     "url_shortener/internal/models"
 )
 
 var (
     ErrShortURLNotFound = errors.New("short URL not found")
+    ErrShortCodeTaken   = errors.New("short code already taken")
+    ErrVersionMismatch  = errors.New("short URL was changed concurrently")
 )
 
+// ShortURLFilter selects the short URLs returned by List. Links of a
+// workspace are listed when WorkspaceID is set, otherwise the personal links
+// of UserID. Deleted selects the links in the trash instead of the others.
+// Tags and CollectionID narrow the list to links with all of the tags and in
+// the collection.
+type ShortURLFilter struct {
+    UserID       int
+    WorkspaceID  int
+    Deleted      bool
+    Tags         []string
+    CollectionID int
+    Limit        int
+    Offset       int
+}
+
+// shortURLColumns is the column list scanned by scanShortURL
+const shortURLColumns = `id, short_code, original_url, access_count, created_at, updated_at, user_id, workspace_id, flag_reason, canonical_url_hash, resolved_url, unicode_host, fallback_url, health_status, last_status_code, last_latency_ms, last_checked_at, health_failures, disabled_at, disabled_reason, expires_at, version, deleted_at, title, description, notes, preview_title, preview_description, preview_image_url, preview_site_name, favicon_url, preview_fetched_at, og_title, og_description, og_image_url, owner_deleted_at`
+
+// shortURLInsertColumns is the column list written by insertArgs
+const shortURLInsertColumns = `short_code, original_url, access_count, created_at, updated_at, user_id, workspace_id, flag_reason, canonical_url_hash, resolved_url, unicode_host, fallback_url, expires_at, title, description, notes, og_title, og_description, og_image_url`
+
+// resetPreview clears the fetched preview of a record so that it is fetched
+// again for a new destination
+const resetPreview = `preview_title = NULL, preview_description = NULL, preview_image_url = NULL, preview_site_name = NULL, favicon_url = NULL, preview_fetched_at = NULL`
+
 type ShortURLRepository interface {
-    Create(shortURL *models.ShortURL) error
+    Create(shortURL *models.ShortURL, ac models.AuditContext) error
+    CreateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error)
     GetByShortCode(shortCode string) (*models.ShortURL, error)
-    Update(shortURL *models.ShortURL) error
-    DeleteByShortCode(shortCode string) error
+    GetDeletedByShortCode(shortCode string) (*models.ShortURL, error)
+    GetByShortCodes(shortCodes []string) (map[string]*models.ShortURL, error)
+    FindByCanonicalURL(userID, workspaceID int, canonicalURLHash string) (*models.ShortURL, error)
+    List(filter ShortURLFilter) ([]*models.ShortURL, error)
+    ListForExport(filter ShortURLFilter, afterID int) ([]*models.ShortURL, error)
+    Search(filter ShortURLFilter, q string) ([]*models.SearchResult, error)
+    Update(shortURL *models.ShortURL, ac models.AuditContext) error
+    Patch(shortURL *models.ShortURL, ac models.AuditContext) error
+    Rollback(shortURL *models.ShortURL, ac models.AuditContext) error
+    UpdateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error)
+    DeleteByShortCode(shortCode string, ac models.AuditContext) error
+    DeleteBatch(shortCodes []string, ac models.AuditContext) ([]error, error)
+    Restore(shortURL *models.ShortURL, ac models.AuditContext) error
+    PurgeDeleted(deletedBefore time.Time, quarantine time.Duration, limit int) (int, error)
+    ReleaseQuarantinedCodes(now time.Time) (int64, error)
     IncrementAccessCount(shortCode string) error
+    SetFlag(shortCode string, reason string, ac models.AuditContext) error
+    SetDisabled(shortCode string, reason models.ReportReason, ac models.AuditContext) error
+    ListForHealthCheck(afterID, limit int) ([]*models.ShortURL, error)
+    UpdateHealth(id int, result models.HealthCheckResult) error
+    ListForPreview(limit int) ([]*models.ShortURL, error)
+    UpdatePreview(id int, originalURL string, preview models.LinkPreview) error
 }
 
 type shortURLRepository struct {
@@ -28,117 +77,881 @@ func NewShortURLRepository(db *sql.DB) ShortURLRepository {
     return &shortURLRepository{db: db}
 }
 
-// Create inserts a new short URL record.
-func (r *shortURLRepository) Create(shortURL *models.ShortURL) error {
+// Create inserts a new short URL record along with its audit event. It
+// returns ErrShortCodeTaken if the short code is in use, including by a
+// deleted record, or quarantined.
+func (r *shortURLRepository) Create(shortURL *models.ShortURL, ac models.AuditContext) error {
     now := time.Now()
     shortURL.CreatedAt = now
     shortURL.UpdatedAt = now
 
-    query := `
-        INSERT INTO short_urls (short_code, original_url, access_count, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?)
-    `
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
 
-    result, err := r.db.Exec(
-        query,
-        shortURL.ShortCode,
-        shortURL.OriginalURL,
-        shortURL.AccessCount,
-        shortURL.CreatedAt,
-        shortURL.UpdatedAt,
-    )
+    query := `INSERT INTO short_urls (` + shortURLInsertColumns + `) VALUES ` + placeholders(1, 19)
+
+    result, err := tx.Exec(query, insertArgs(shortURL)...)
+    if isDuplicateKeyError(err) {
+        return ErrShortCodeTaken
+    } else if err != nil {
+        return err
+    }
+
+    // Checked after the insert, which waits for a concurrent purge of the
+    // code to commit, so the quarantine it adds is seen
+    quarantined, err := quarantinedCodes(tx, []interface{}{shortURL.ShortCode})
     if err != nil {
         return err
     }
+    if len(quarantined) > 0 {
+        return ErrShortCodeTaken
+    }
 
     id, err := result.LastInsertId()
     if err != nil {
         return err
     }
     shortURL.ID = int(id)
-    return nil
+    shortURL.HealthStatus = models.HealthUnknown
+    shortURL.Version = 1
+
+    if err := recordAudit(tx, ac, models.ActionShortURLCreate, models.TargetShortURL, shortURL.ShortCode, nil, shortURL); err != nil {
+        return err
+    }
+    if err := insertRevisions(tx, models.RevisionOf(shortURL, models.RevisionCreate, ac.ActorID)); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// CreateBatch inserts records with a single multi-row insert in one
+// transaction, along with their audit events. The returned slice holds
+// ErrShortCodeTaken for the records whose short code is already in use or
+// quarantined, including later duplicates within shortURLs; those records
+// aren't inserted and the others are.
+func (r *shortURLRepository) CreateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error) {
+    errs := make([]error, len(shortURLs))
+    if len(shortURLs) == 0 {
+        return errs, nil
+    }
+
+    tx, err := r.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Locking the codes, including the gaps of the missing ones, keeps
+    // concurrent inserts from taking them before ours
+    codes := make([]interface{}, len(shortURLs))
+    for i, su := range shortURLs {
+        codes[i] = su.ShortCode
+    }
+    query := `SELECT short_code FROM short_urls WHERE short_code IN ` + placeholders(1, len(codes)) + ` FOR UPDATE`
+    rows, err := tx.Query(query, codes...)
+    if err != nil {
+        return nil, err
+    }
+    taken := map[string]bool{}
+    for rows.Next() {
+        var code string
+        if err := rows.Scan(&code); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        taken[strings.ToLower(code)] = true
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    quarantined, err := quarantinedCodes(tx, codes)
+    if err != nil {
+        return nil, err
+    }
+    for code := range quarantined {
+        taken[code] = true
+    }
+
+    // The default collation is case-insensitive, so are the duplicates
+    now := time.Now()
+    var inserted []*models.ShortURL
+    var args []interface{}
+    for i, su := range shortURLs {
+        key := strings.ToLower(su.ShortCode)
+        if taken[key] {
+            errs[i] = ErrShortCodeTaken
+            continue
+        }
+        taken[key] = true
+        su.CreatedAt = now
+        su.UpdatedAt = now
+        inserted = append(inserted, su)
+        args = append(args, insertArgs(su)...)
+    }
+    if len(inserted) == 0 {
+        return errs, nil
+    }
+
+    query = `INSERT INTO short_urls (` + shortURLInsertColumns + `) VALUES ` + placeholders(len(inserted), 19)
+    if _, err := tx.Exec(query, args...); err != nil {
+        return nil, err
+    }
+
+    // Auto-increment IDs of a multi-row insert aren't guaranteed to be
+    // consecutive, so they are read back
+    query = `SELECT id, short_code FROM short_urls WHERE short_code IN ` + placeholders(1, len(codes))
+    rows, err = tx.Query(query, codes...)
+    if err != nil {
+        return nil, err
+    }
+    ids := map[string]int{}
+    for rows.Next() {
+        var id int
+        var code string
+        if err := rows.Scan(&id, &code); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        ids[strings.ToLower(code)] = id
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    revisions := make([]*models.Revision, len(inserted))
+    for i, su := range inserted {
+        su.ID = ids[strings.ToLower(su.ShortCode)]
+        su.HealthStatus = models.HealthUnknown
+        su.Version = 1
+        if err := recordAudit(tx, ac, models.ActionShortURLCreate, models.TargetShortURL, su.ShortCode, nil, su); err != nil {
+            return nil, err
+        }
+        revisions[i] = models.RevisionOf(su, models.RevisionCreate, ac.ActorID)
+    }
+    if err := insertRevisions(tx, revisions...); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return errs, nil
 }
 
 // GetByShortCode retrieves a record by short_code.
 func (r *shortURLRepository) GetByShortCode(shortCode string) (*models.ShortURL, error) {
-    query := `
-        SELECT id, short_code, original_url, access_count, created_at, updated_at
-        FROM short_urls
-        WHERE short_code = ?
-    `
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE short_code = ? AND deleted_at IS NULL`
 
-    row := r.db.QueryRow(query, shortCode)
+    su, err := scanShortURL(r.db.QueryRow(query, shortCode))
+    if err == sql.ErrNoRows {
+        return nil, ErrShortURLNotFound
+    } else if err != nil {
+        return nil, err
+    }
 
-    var su models.ShortURL
-    err := row.Scan(
-        &su.ID,
-        &su.ShortCode,
-        &su.OriginalURL,
-        &su.AccessCount,
-        &su.CreatedAt,
-        &su.UpdatedAt,
-    )
+    return su, nil
+}
+
+// GetDeletedByShortCode retrieves a record in the trash by short_code.
+func (r *shortURLRepository) GetDeletedByShortCode(shortCode string) (*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE short_code = ? AND deleted_at IS NOT NULL`
+
+    su, err := scanShortURL(r.db.QueryRow(query, shortCode))
     if err == sql.ErrNoRows {
         return nil, ErrShortURLNotFound
     } else if err != nil {
         return nil, err
     }
 
-    return &su, nil
+    return su, nil
+}
+
+// GetByShortCodes retrieves the records with the given short codes, keyed by
+// the lower-cased short code since short codes are matched case-insensitively.
+// Missing codes are left out.
+func (r *shortURLRepository) GetByShortCodes(shortCodes []string) (map[string]*models.ShortURL, error) {
+    shortURLs := map[string]*models.ShortURL{}
+    if len(shortCodes) == 0 {
+        return shortURLs, nil
+    }
+
+    args := make([]interface{}, len(shortCodes))
+    for i, code := range shortCodes {
+        args[i] = code
+    }
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE short_code IN ` + placeholders(1, len(args)) + ` AND deleted_at IS NULL`
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            return nil, err
+        }
+        shortURLs[strings.ToLower(su.ShortCode)] = su
+    }
+
+    return shortURLs, rows.Err()
+}
+
+// FindByCanonicalURL returns the newest short URL with the given canonical URL
+// hash owned by the workspace, or by the user when workspaceID is 0.
+func (r *shortURLRepository) FindByCanonicalURL(userID, workspaceID int, canonicalURLHash string) (*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE canonical_url_hash = ? AND deleted_at IS NULL `
+    args := []interface{}{canonicalURLHash}
+    if workspaceID != 0 {
+        query += `AND workspace_id = ? `
+        args = append(args, workspaceID)
+    } else {
+        query += `AND user_id = ? AND workspace_id IS NULL `
+        args = append(args, userID)
+    }
+    query += `ORDER BY created_at DESC, id DESC LIMIT 1`
+
+    su, err := scanShortURL(r.db.QueryRow(query, args...))
+    if err == sql.ErrNoRows {
+        return nil, ErrShortURLNotFound
+    } else if err != nil {
+        return nil, err
+    }
+
+    return su, nil
+}
+
+// List returns the short URLs matching filter, newest first, or most recently
+// deleted first for the trash.
+func (r *shortURLRepository) List(filter ShortURLFilter) ([]*models.ShortURL, error) {
+    limit := filter.Limit
+    if limit <= 0 || limit > 100 {
+        limit = 100
+    }
+
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls `
+    var args []interface{}
+    if filter.WorkspaceID != 0 {
+        query += `WHERE workspace_id = ? `
+        args = append(args, filter.WorkspaceID)
+    } else {
+        query += `WHERE user_id = ? AND workspace_id IS NULL `
+        args = append(args, filter.UserID)
+    }
+    for _, tag := range filter.Tags {
+        query += `AND EXISTS (
+            SELECT 1 FROM link_group_links m JOIN link_groups g ON g.id = m.group_id
+            WHERE m.short_url_id = short_urls.id AND g.kind = ? AND g.name = ?
+        ) `
+        args = append(args, models.GroupTag, tag)
+    }
+    if filter.CollectionID != 0 {
+        query += `AND EXISTS (SELECT 1 FROM link_group_links m WHERE m.short_url_id = short_urls.id AND m.group_id = ?) `
+        args = append(args, filter.CollectionID)
+    }
+    if filter.Deleted {
+        query += `AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC `
+    } else {
+        query += `AND deleted_at IS NULL ORDER BY created_at DESC, id DESC `
+    }
+    query += `LIMIT ? OFFSET ?`
+    args = append(args, limit, filter.Offset)
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    shortURLs := []*models.ShortURL{}
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            return nil, err
+        }
+        shortURLs = append(shortURLs, su)
+    }
+
+    return shortURLs, rows.Err()
+}
+
+// ListForExport returns up to filter.Limit short URLs of the owner selected
+// by filter with an ID above afterID in ID order, for walking all of them in
+// batches. Offset is ignored.
+func (r *shortURLRepository) ListForExport(filter ShortURLFilter, afterID int) ([]*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE id > ? AND deleted_at IS NULL `
+    args := []interface{}{afterID}
+    if filter.WorkspaceID != 0 {
+        query += `AND workspace_id = ? `
+        args = append(args, filter.WorkspaceID)
+    } else {
+        query += `AND user_id = ? AND workspace_id IS NULL `
+        args = append(args, filter.UserID)
+    }
+    query += `ORDER BY id LIMIT ?`
+    args = append(args, filter.Limit)
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    shortURLs := []*models.ShortURL{}
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            return nil, err
+        }
+        shortURLs = append(shortURLs, su)
+    }
+
+    return shortURLs, rows.Err()
+}
+
+// Search returns the short URLs of the owner selected by filter whose short
+// code, destination, title, description, notes, page title or tags match q,
+// best match first. A link whose short code is q comes first. Deleted, Tags
+// and CollectionID are ignored.
+func (r *shortURLRepository) Search(filter ShortURLFilter, q string) ([]*models.SearchResult, error) {
+    limit := filter.Limit
+    if limit <= 0 || limit > 100 {
+        limit = 100
+    }
+    terms := fulltextQuery(q)
+
+    query := `
+        SELECT ` + shortURLColumns + `,
+            MATCH (short_code, original_url) AGAINST (? IN BOOLEAN MODE) +
+            MATCH (title, description, notes, preview_title) AGAINST (? IN BOOLEAN MODE) + COALESCE((
+                SELECT SUM(MATCH (g.name) AGAINST (? IN BOOLEAN MODE))
+                FROM link_group_links m JOIN link_groups g ON g.id = m.group_id
+                WHERE m.short_url_id = s.id AND g.kind = ?
+            ), 0) AS score
+        FROM short_urls s
+    `
+    args := []interface{}{terms, terms, terms, models.GroupTag}
+    if filter.WorkspaceID != 0 {
+        query += `WHERE workspace_id = ? `
+        args = append(args, filter.WorkspaceID)
+    } else {
+        query += `WHERE user_id = ? AND workspace_id IS NULL `
+        args = append(args, filter.UserID)
+    }
+    query += `
+        AND deleted_at IS NULL
+        AND (short_code = ? OR MATCH (short_code, original_url) AGAINST (? IN BOOLEAN MODE)
+            OR MATCH (title, description, notes, preview_title) AGAINST (? IN BOOLEAN MODE) OR EXISTS (
+            SELECT 1 FROM link_group_links m JOIN link_groups g ON g.id = m.group_id
+            WHERE m.short_url_id = s.id AND g.kind = ? AND MATCH (g.name) AGAINST (? IN BOOLEAN MODE)
+        ))
+        ORDER BY short_code = ? DESC, score DESC, id DESC
+        LIMIT ? OFFSET ?
+    `
+    args = append(args, q, terms, terms, models.GroupTag, terms, q, limit, filter.Offset)
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    results := []*models.SearchResult{}
+    for rows.Next() {
+        var score float64
+        su, err := scanShortURL(scoredRow{rows, &score})
+        if err != nil {
+            return nil, err
+        }
+        results = append(results, &models.SearchResult{ShortURL: su, Score: score})
+    }
+
+    return results, rows.Err()
+}
+
+// fulltextQuery turns free text into a boolean mode full-text query that
+// matches any of its words or words starting with them. Everything but
+// letters and digits is dropped so that users can't inject operators.
+func fulltextQuery(q string) string {
+    words := strings.FieldsFunc(strings.ToLower(q), func(c rune) bool {
+        return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+    })
+    seen := map[string]bool{}
+    var terms []string
+    for _, word := range words {
+        if seen[word] || len(terms) == 20 {
+            continue
+        }
+        seen[word] = true
+        terms = append(terms, word+"*")
+    }
+    return strings.Join(terms, " ")
+}
+
+// scoredRow scans the shortURLColumns followed by a score column.
+type scoredRow struct {
+    rowScanner
+    score *float64
+}
+
+func (r scoredRow) Scan(dest ...interface{}) error {
+    return r.rowScanner.Scan(append(dest, r.score)...)
+}
+
+// Update updates the original_url with the values derived from it (canonical
+// hash, resolved URL, Unicode host and flag), the fallback_url, expires_at,
+// title, description, notes, social preview overrides and updated_at for a
+// record. The previous state is captured for the audit event
+// in the same transaction.
+//
+// shortURL.Version must be the version the changes were based on; if the
+// record was changed since, ErrVersionMismatch is returned and nothing is
+// written. On success shortURL.Version is the new version.
+func (r *shortURLRepository) Update(shortURL *models.ShortURL, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := updateShortURL(tx, shortURL, ac); err != nil {
+        return err
+    }
+
+    return tx.Commit()
 }
 
-// Update updates the original_url (and updated_at) for a record.
-func (r *shortURLRepository) Update(shortURL *models.ShortURL) error {
+// UpdateBatch updates records like Update in one transaction. The returned
+// slice holds ErrShortURLNotFound for the records that no longer exist and
+// ErrVersionMismatch for those changed since they were read.
+func (r *shortURLRepository) UpdateBatch(shortURLs []*models.ShortURL, ac models.AuditContext) ([]error, error) {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    errs := make([]error, len(shortURLs))
+    for i, su := range shortURLs {
+        err := updateShortURL(tx, su, ac)
+        if err == ErrShortURLNotFound || err == ErrVersionMismatch {
+            errs[i] = err
+        } else if err != nil {
+            return nil, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return errs, nil
+}
+
+// updateShortURL updates a record within tx. A changed destination starts
+// over with an unknown health and no preview. The version is checked by the
+// UPDATE itself, so a concurrent change can't slip in between the check and
+// the write.
+func updateShortURL(tx *sql.Tx, shortURL *models.ShortURL, ac models.AuditContext) error {
+    before, err := getForUpdate(tx, shortURL.ShortCode)
+    if err != nil {
+        return err
+    }
     shortURL.UpdatedAt = time.Now()
 
     query := `
         UPDATE short_urls
-        SET original_url = ?, updated_at = ?
-        WHERE short_code = ?
+        SET original_url = ?, canonical_url_hash = ?, resolved_url = ?, unicode_host = ?, flag_reason = ?, fallback_url = ?, expires_at = ?, title = ?, description = ?, notes = ?, og_title = ?, og_description = ?, og_image_url = ?, updated_at = ?, version = version + 1
+        WHERE short_code = ? AND version = ?
     `
-    result, err := r.db.Exec(query, shortURL.OriginalURL, shortURL.UpdatedAt, shortURL.ShortCode)
+    result, err := tx.Exec(
+        query,
+        shortURL.OriginalURL,
+        nullString(shortURL.CanonicalURLHash),
+        nullString(shortURL.ResolvedURL),
+        nullString(shortURL.UnicodeHost),
+        nullString(shortURL.FlagReason),
+        nullString(shortURL.FallbackURL),
+        shortURL.ExpiresAt,
+        nullString(shortURL.Title),
+        nullString(shortURL.Description),
+        nullString(shortURL.Notes),
+        nullString(shortURL.OGTitle),
+        nullString(shortURL.OGDescription),
+        nullString(shortURL.OGImageURL),
+        shortURL.UpdatedAt,
+        shortURL.ShortCode,
+        shortURL.Version,
+    )
     if err != nil {
         return err
     }
-
     rowsAffected, err := result.RowsAffected()
     if err != nil {
         return err
     }
     if rowsAffected == 0 {
-        return ErrShortURLNotFound
+        return ErrVersionMismatch
     }
+    shortURL.Version++
 
-    return nil
+    if err := recordRevision(tx, before, shortURL, models.RevisionUpdate, ac.ActorID); err != nil {
+        return err
+    }
+
+    if before.OriginalURL != shortURL.OriginalURL {
+        query := `
+            UPDATE short_urls
+            SET health_status = ?, last_status_code = NULL, last_latency_ms = NULL, last_checked_at = NULL, health_failures = 0, ` + resetPreview + `
+            WHERE short_code = ?
+        `
+        if _, err := tx.Exec(query, models.HealthUnknown, shortURL.ShortCode); err != nil {
+            return err
+        }
+        shortURL.HealthStatus = models.HealthUnknown
+        shortURL.LastStatusCode = 0
+        shortURL.LastLatencyMs = 0
+        shortURL.LastCheckedAt = nil
+        shortURL.HealthFailures = 0
+        shortURL.Preview = nil
+    }
+
+    return recordAudit(tx, ac, models.ActionShortURLUpdate, models.TargetShortURL, shortURL.ShortCode, before, shortURL)
 }
 
-// DeleteByShortCode deletes a record by its short_code.
-func (r *shortURLRepository) DeleteByShortCode(shortCode string) error {
-    query := `
-        DELETE FROM short_urls
-        WHERE short_code = ?
-    `
-    result, err := r.db.Exec(query, shortCode)
+// Patch writes the editable columns of a record that differ from the stored
+// values, along with updated_at, and records the change for the audit log.
+// Like Update it fails with ErrVersionMismatch if the record was changed
+// since shortURL.Version. Nothing is written if no column changed.
+func (r *shortURLRepository) Patch(shortURL *models.ShortURL, ac models.AuditContext) error {
+    return r.patch(shortURL, models.RevisionUpdate, models.ActionShortURLUpdate, ac)
+}
+
+// Rollback writes a record set back to the state of a revision like Patch,
+// recording the change as a rollback.
+func (r *shortURLRepository) Rollback(shortURL *models.ShortURL, ac models.AuditContext) error {
+    return r.patch(shortURL, models.RevisionRollback, models.ActionShortURLRollback, ac)
+}
+
+func (r *shortURLRepository) patch(shortURL *models.ShortURL, source models.RevisionSource, action models.AuditAction, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
     if err != nil {
         return err
     }
+    defer tx.Rollback()
 
+    before, err := getForUpdate(tx, shortURL.ShortCode)
+    if err != nil {
+        return err
+    }
+    if before.Version != shortURL.Version {
+        return ErrVersionMismatch
+    }
+
+    if err := writeChanges(tx, before, shortURL, source, action, ac); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// writeChanges writes the editable columns of after that differ from before,
+// the locked record, and records the change. A changed destination starts
+// over with an unknown health and no preview. On success after.Version is
+// the new version.
+func writeChanges(tx *sql.Tx, before, after *models.ShortURL, source models.RevisionSource, action models.AuditAction, ac models.AuditContext) error {
+    sets, args := changedColumns(before, after)
+    if len(sets) == 0 {
+        return nil
+    }
+    if before.OriginalURL != after.OriginalURL {
+        sets = append(sets, "health_status = ?", "last_status_code = NULL", "last_latency_ms = NULL", "last_checked_at = NULL", "health_failures = 0", resetPreview)
+        args = append(args, models.HealthUnknown)
+        after.HealthStatus = models.HealthUnknown
+        after.LastStatusCode = 0
+        after.LastLatencyMs = 0
+        after.LastCheckedAt = nil
+        after.HealthFailures = 0
+        after.Preview = nil
+    }
+    after.UpdatedAt = time.Now()
+
+    query := `UPDATE short_urls SET ` + strings.Join(sets, ", ") + `, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?`
+    args = append(args, after.UpdatedAt, before.ID, before.Version)
+    result, err := tx.Exec(query, args...)
+    if err != nil {
+        return err
+    }
     rowsAffected, err := result.RowsAffected()
     if err != nil {
         return err
     }
     if rowsAffected == 0 {
+        return ErrVersionMismatch
+    }
+    after.Version = before.Version + 1
+
+    if err := recordRevision(tx, before, after, source, ac.ActorID); err != nil {
+        return err
+    }
+    return recordAudit(tx, ac, action, models.TargetShortURL, after.ShortCode, before, after)
+}
+
+// changedColumns returns the assignments and values of the editable columns
+// whose value differs between before and after.
+func changedColumns(before, after *models.ShortURL) ([]string, []interface{}) {
+    var sets []string
+    var args []interface{}
+    set := func(column string, changed bool, value interface{}) {
+        if changed {
+            sets = append(sets, column+" = ?")
+            args = append(args, value)
+        }
+    }
+
+    set("original_url", before.OriginalURL != after.OriginalURL, after.OriginalURL)
+    set("canonical_url_hash", before.CanonicalURLHash != after.CanonicalURLHash, nullString(after.CanonicalURLHash))
+    set("resolved_url", before.ResolvedURL != after.ResolvedURL, nullString(after.ResolvedURL))
+    set("unicode_host", before.UnicodeHost != after.UnicodeHost, nullString(after.UnicodeHost))
+    set("flag_reason", before.FlagReason != after.FlagReason, nullString(after.FlagReason))
+    set("fallback_url", before.FallbackURL != after.FallbackURL, nullString(after.FallbackURL))
+    set("expires_at", !sameTime(before.ExpiresAt, after.ExpiresAt), after.ExpiresAt)
+    set("title", before.Title != after.Title, nullString(after.Title))
+    set("description", before.Description != after.Description, nullString(after.Description))
+    set("notes", before.Notes != after.Notes, nullString(after.Notes))
+    set("og_title", before.OGTitle != after.OGTitle, nullString(after.OGTitle))
+    set("og_description", before.OGDescription != after.OGDescription, nullString(after.OGDescription))
+    set("og_image_url", before.OGImageURL != after.OGImageURL, nullString(after.OGImageURL))
+    return sets, args
+}
+
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return a.Equal(*b)
+}
+
+// DeleteByShortCode moves a record to the trash by its short_code. It stays
+// there, keeping its short code, until it is restored or purged.
+func (r *shortURLRepository) DeleteByShortCode(shortCode string, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := deleteShortURL(tx, shortCode, ac); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// DeleteBatch moves records to the trash by short_code in one transaction,
+// like DeleteByShortCode. The returned
+// slice holds ErrShortURLNotFound for the codes that don't exist.
+func (r *shortURLRepository) DeleteBatch(shortCodes []string, ac models.AuditContext) ([]error, error) {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    errs := make([]error, len(shortCodes))
+    for i, code := range shortCodes {
+        err := deleteShortURL(tx, code, ac)
+        if err == ErrShortURLNotFound {
+            errs[i] = err
+        } else if err != nil {
+            return nil, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return errs, nil
+}
+
+// deleteShortURL moves a record to the trash within tx.
+func deleteShortURL(tx *sql.Tx, shortCode string, ac models.AuditContext) error {
+    before, err := getForUpdate(tx, shortCode)
+    if err != nil {
+        return err
+    }
+
+    now := time.Now()
+    query := `
+        UPDATE short_urls
+        SET deleted_at = ?, version = version + 1
+        WHERE id = ?
+    `
+    if _, err := tx.Exec(query, now, before.ID); err != nil {
+        return err
+    }
+
+    after := *before
+    after.DeletedAt = &now
+    after.Version++
+    return recordAudit(tx, ac, models.ActionShortURLDelete, models.TargetShortURL, shortCode, before, &after)
+}
+
+// Restore takes the record with the short code of shortURL out of the trash
+// and sets shortURL to the restored record. It returns ErrShortURLNotFound if
+// no record with the short code is in the trash.
+func (r *shortURLRepository) Restore(shortURL *models.ShortURL, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE short_code = ? AND deleted_at IS NOT NULL FOR UPDATE`
+    before, err := scanShortURL(tx.QueryRow(query, shortURL.ShortCode))
+    if err == sql.ErrNoRows {
         return ErrShortURLNotFound
+    } else if err != nil {
+        return err
     }
+
+    query = `
+        UPDATE short_urls
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = ?
+    `
+    if _, err := tx.Exec(query, before.ID); err != nil {
+        return err
+    }
+
+    after := *before
+    after.DeletedAt = nil
+    after.Version++
+    if err := recordAudit(tx, ac, models.ActionShortURLRestore, models.TargetShortURL, before.ShortCode, before, &after); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    *shortURL = after
     return nil
 }
 
-// IncrementAccessCount increments the access_count of a short URL whenever it's accessed.
+// PurgeDeleted removes up to limit records deleted before deletedBefore for
+// good and returns how many were removed. The short codes of the records are
+// quarantined until quarantine has passed since their deletion.
+func (r *shortURLRepository) PurgeDeleted(deletedBefore time.Time, quarantine time.Duration, limit int) (int, error) {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE deleted_at < ? ORDER BY deleted_at LIMIT ? FOR UPDATE`
+    rows, err := tx.Query(query, deletedBefore, limit)
+    if err != nil {
+        return 0, err
+    }
+    var purged []*models.ShortURL
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            rows.Close()
+            return 0, err
+        }
+        purged = append(purged, su)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+    if len(purged) == 0 {
+        return 0, nil
+    }
+
+    now := time.Now()
+    ids := make([]interface{}, len(purged))
+    var quarantineArgs []interface{}
+    for i, su := range purged {
+        ids[i] = su.ID
+        if releasedAt := su.DeletedAt.Add(quarantine); releasedAt.After(now) {
+            quarantineArgs = append(quarantineArgs, su.ShortCode, releasedAt)
+        }
+    }
+
+    if len(quarantineArgs) > 0 {
+        query = `
+            INSERT INTO quarantined_codes (short_code, released_at)
+            VALUES ` + placeholders(len(quarantineArgs)/2, 2) + `
+            ON DUPLICATE KEY UPDATE released_at = GREATEST(released_at, VALUES(released_at))
+        `
+        if _, err := tx.Exec(query, quarantineArgs...); err != nil {
+            return 0, err
+        }
+    }
+
+    if _, err := tx.Exec(`DELETE FROM short_urls WHERE id IN `+placeholders(1, len(ids)), ids...); err != nil {
+        return 0, err
+    }
+    for _, su := range purged {
+        if err := recordAudit(tx, models.AuditContext{}, models.ActionShortURLPurge, models.TargetShortURL, su.ShortCode, su, nil); err != nil {
+            return 0, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, err
+    }
+    return len(purged), nil
+}
+
+// ReleaseQuarantinedCodes forgets the quarantines that ended by now and
+// returns how many there were.
+func (r *shortURLRepository) ReleaseQuarantinedCodes(now time.Time) (int64, error) {
+    result, err := r.db.Exec(`DELETE FROM quarantined_codes WHERE released_at <= ?`, now)
+    if err != nil {
+        return 0, err
+    }
+    return result.RowsAffected()
+}
+
+// quarantinedCodes locks and returns the codes in quarantine among codes,
+// lower-cased.
+func quarantinedCodes(tx *sql.Tx, codes []interface{}) (map[string]bool, error) {
+    query := `SELECT short_code FROM quarantined_codes WHERE short_code IN ` + placeholders(1, len(codes)) + ` AND released_at > ? FOR UPDATE`
+    rows, err := tx.Query(query, append(codes[:len(codes):len(codes)], time.Now())...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    quarantined := map[string]bool{}
+    for rows.Next() {
+        var code string
+        if err := rows.Scan(&code); err != nil {
+            return nil, err
+        }
+        quarantined[strings.ToLower(code)] = true
+    }
+
+    return quarantined, rows.Err()
+}
+
+// IncrementAccessCount increments the access_count of a short URL whenever
+// it's accessed, along with its clicks of the day.
 func (r *shortURLRepository) IncrementAccessCount(shortCode string) error {
     query := `
         UPDATE short_urls
         SET access_count = access_count + 1
-        WHERE short_code = ?
+        WHERE short_code = ? AND deleted_at IS NULL
     `
     result, err := r.db.Exec(query, shortCode)
     if err != nil {
@@ -152,5 +965,340 @@ func (r *shortURLRepository) IncrementAccessCount(shortCode string) error {
     if rowsAffected == 0 {
         return ErrShortURLNotFound
     }
-    return nil
+
+    query = `
+        INSERT INTO daily_clicks (short_url_id, day, clicks)
+        SELECT id, ?, 1 FROM short_urls WHERE short_code = ?
+        ON DUPLICATE KEY UPDATE clicks = clicks + 1
+    `
+    _, err = r.db.Exec(query, time.Now().UTC().Format("2006-01-02"), shortCode)
+    return err
+}
+
+// SetFlag flags a record as dangerous with the given reason, or clears the
+// flag when reason is empty.
+func (r *shortURLRepository) SetFlag(shortCode string, reason string, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := getForUpdate(tx, shortCode)
+    if err != nil {
+        return err
+    }
+
+    query := `
+        UPDATE short_urls
+        SET flag_reason = ?, version = version + 1
+        WHERE short_code = ?
+    `
+    if _, err := tx.Exec(query, nullString(reason), shortCode); err != nil {
+        return err
+    }
+
+    action := models.ActionShortURLFlag
+    if reason == "" {
+        action = models.ActionShortURLUnflag
+    }
+    after := *before
+    after.FlagReason = reason
+    after.Version++
+    if err := recordAudit(tx, ac, action, models.TargetShortURL, shortCode, before, &after); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// SetDisabled disables a link for the given reason, or enables it again when
+// reason is empty. Open reports about the link are left for moderators.
+func (r *shortURLRepository) SetDisabled(shortCode string, reason models.ReportReason, ac models.AuditContext) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := getForUpdate(tx, shortCode)
+    if err != nil {
+        return err
+    }
+
+    if err := setDisabled(tx, before, reason, ac); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// setDisabled changes the disabled state of a locked link and records the
+// change. Nothing is written if the link already is in that state.
+func setDisabled(tx *sql.Tx, before *models.ShortURL, reason models.ReportReason, ac models.AuditContext) error {
+    if (before.DisabledAt != nil) == (reason != "") && before.DisabledReason == reason {
+        return nil
+    }
+
+    after := *before
+    after.DisabledReason = reason
+    after.DisabledAt = nil
+    after.Version++
+    action := models.ActionShortURLEnable
+    if reason != "" {
+        now := time.Now()
+        after.DisabledAt = &now
+        action = models.ActionShortURLDisable
+    }
+
+    query := `
+        UPDATE short_urls
+        SET disabled_at = ?, disabled_reason = ?, version = version + 1
+        WHERE id = ?
+    `
+    if _, err := tx.Exec(query, after.DisabledAt, nullString(string(reason)), before.ID); err != nil {
+        return err
+    }
+
+    return recordAudit(tx, ac, action, models.TargetShortURL, before.ShortCode, before, &after)
+}
+
+// ListForHealthCheck returns up to limit records with an ID above afterID in
+// ID order, for walking all links in batches.
+func (r *shortURLRepository) ListForHealthCheck(afterID, limit int) ([]*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE id > ? AND deleted_at IS NULL ORDER BY id LIMIT ?`
+
+    rows, err := r.db.Query(query, afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    shortURLs := []*models.ShortURL{}
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            return nil, err
+        }
+        shortURLs = append(shortURLs, su)
+    }
+
+    return shortURLs, rows.Err()
+}
+
+// UpdateHealth stores the result of a destination health check. It doesn't
+// touch updated_at, which tracks changes made by users.
+func (r *shortURLRepository) UpdateHealth(id int, result models.HealthCheckResult) error {
+    query := `
+        UPDATE short_urls
+        SET health_status = ?, last_status_code = ?, last_latency_ms = ?, last_checked_at = ?, health_failures = ?
+        WHERE id = ?
+    `
+    _, err := r.db.Exec(
+        query,
+        result.Status,
+        nullInt(result.StatusCode),
+        result.Latency.Milliseconds(),
+        result.CheckedAt,
+        result.Failures,
+        id,
+    )
+    return err
+}
+
+// ListForPreview returns up to limit records whose destination page wasn't
+// fetched yet, oldest first.
+func (r *shortURLRepository) ListForPreview(limit int) ([]*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE preview_fetched_at IS NULL AND deleted_at IS NULL ORDER BY id LIMIT ?`
+
+    rows, err := r.db.Query(query, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    shortURLs := []*models.ShortURL{}
+    for rows.Next() {
+        su, err := scanShortURL(rows)
+        if err != nil {
+            return nil, err
+        }
+        shortURLs = append(shortURLs, su)
+    }
+
+    return shortURLs, rows.Err()
+}
+
+// UpdatePreview stores the preview fetched from originalURL. It is dropped
+// if the destination changed while the page was fetched, as the new one
+// needs its own. Like UpdateHealth it doesn't touch updated_at or the
+// version.
+func (r *shortURLRepository) UpdatePreview(id int, originalURL string, preview models.LinkPreview) error {
+    query := `
+        UPDATE short_urls
+        SET preview_title = ?, preview_description = ?, preview_image_url = ?, preview_site_name = ?, favicon_url = ?, preview_fetched_at = ?
+        WHERE id = ? AND original_url = ?
+    `
+    _, err := r.db.Exec(
+        query,
+        nullString(preview.Title),
+        nullString(preview.Description),
+        nullString(preview.ImageURL),
+        nullString(preview.SiteName),
+        nullString(preview.FaviconURL),
+        preview.FetchedAt,
+        id,
+        originalURL,
+    )
+    return err
+}
+
+// getForUpdate reads and locks a record that isn't deleted within tx.
+func getForUpdate(tx *sql.Tx, shortCode string) (*models.ShortURL, error) {
+    query := `SELECT ` + shortURLColumns + ` FROM short_urls WHERE short_code = ? AND deleted_at IS NULL FOR UPDATE`
+
+    su, err := scanShortURL(tx.QueryRow(query, shortCode))
+    if err == sql.ErrNoRows {
+        return nil, ErrShortURLNotFound
+    }
+    return su, err
+}
+
+// insertArgs returns the values of the shortURLInsertColumns of a record.
+func insertArgs(su *models.ShortURL) []interface{} {
+    return []interface{}{
+        su.ShortCode,
+        su.OriginalURL,
+        su.AccessCount,
+        su.CreatedAt,
+        su.UpdatedAt,
+        nullInt(su.UserID),
+        nullInt(su.WorkspaceID),
+        nullString(su.FlagReason),
+        nullString(su.CanonicalURLHash),
+        nullString(su.ResolvedURL),
+        nullString(su.UnicodeHost),
+        nullString(su.FallbackURL),
+        su.ExpiresAt,
+        nullString(su.Title),
+        nullString(su.Description),
+        nullString(su.Notes),
+        nullString(su.OGTitle),
+        nullString(su.OGDescription),
+        nullString(su.OGImageURL),
+    }
+}
+
+// placeholders returns rows groups of columns placeholders, e.g. "(?, ?), (?, ?)".
+func placeholders(rows, columns int) string {
+    group := "(" + strings.TrimSuffix(strings.Repeat("?, ", columns), ", ") + ")"
+    return strings.TrimSuffix(strings.Repeat(group+", ", rows), ", ")
+}
+
+func nullInt(i int) sql.NullInt64 {
+    return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanShortURL scans the shortURLColumns of a row.
+func scanShortURL(row rowScanner) (*models.ShortURL, error) {
+    var su models.ShortURL
+    var userID, workspaceID sql.NullInt64
+    var flagReason, canonicalURLHash, resolvedURL, unicodeHost, fallbackURL sql.NullString
+    var lastStatusCode, lastLatencyMs sql.NullInt64
+    var lastCheckedAt, disabledAt, expiresAt, deletedAt sql.NullTime
+    var disabledReason sql.NullString
+    var title, description, notes sql.NullString
+    var previewTitle, previewDescription, previewImageURL, previewSiteName, faviconURL sql.NullString
+    var previewFetchedAt sql.NullTime
+    var ogTitle, ogDescription, ogImageURL sql.NullString
+    var ownerDeletedAt sql.NullTime
+    err := row.Scan(
+        &su.ID,
+        &su.ShortCode,
+        &su.OriginalURL,
+        &su.AccessCount,
+        &su.CreatedAt,
+        &su.UpdatedAt,
+        &userID,
+        &workspaceID,
+        &flagReason,
+        &canonicalURLHash,
+        &resolvedURL,
+        &unicodeHost,
+        &fallbackURL,
+        &su.HealthStatus,
+        &lastStatusCode,
+        &lastLatencyMs,
+        &lastCheckedAt,
+        &su.HealthFailures,
+        &disabledAt,
+        &disabledReason,
+        &expiresAt,
+        &su.Version,
+        &deletedAt,
+        &title,
+        &description,
+        &notes,
+        &previewTitle,
+        &previewDescription,
+        &previewImageURL,
+        &previewSiteName,
+        &faviconURL,
+        &previewFetchedAt,
+        &ogTitle,
+        &ogDescription,
+        &ogImageURL,
+        &ownerDeletedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    su.UserID = int(userID.Int64)
+    su.WorkspaceID = int(workspaceID.Int64)
+    su.FlagReason = flagReason.String
+    su.CanonicalURLHash = canonicalURLHash.String
+    su.ResolvedURL = resolvedURL.String
+    su.UnicodeHost = unicodeHost.String
+    su.FallbackURL = fallbackURL.String
+    su.LastStatusCode = int(lastStatusCode.Int64)
+    su.LastLatencyMs = int(lastLatencyMs.Int64)
+    if lastCheckedAt.Valid {
+        su.LastCheckedAt = &lastCheckedAt.Time
+    }
+    if disabledAt.Valid {
+        su.DisabledAt = &disabledAt.Time
+    }
+    su.DisabledReason = models.ReportReason(disabledReason.String)
+    if expiresAt.Valid {
+        su.ExpiresAt = &expiresAt.Time
+    }
+    if deletedAt.Valid {
+        su.DeletedAt = &deletedAt.Time
+    }
+    su.Title = title.String
+    su.Description = description.String
+    su.Notes = notes.String
+    su.OGTitle = ogTitle.String
+    su.OGDescription = ogDescription.String
+    su.OGImageURL = ogImageURL.String
+    if ownerDeletedAt.Valid {
+        su.OwnerDeletedAt = &ownerDeletedAt.Time
+    }
+    if previewFetchedAt.Valid {
+        su.Preview = &models.LinkPreview{
+            Title:       previewTitle.String,
+            Description: previewDescription.String,
+            ImageURL:    previewImageURL.String,
+            SiteName:    previewSiteName.String,
+            FaviconURL:  faviconURL.String,
+            FetchedAt:   previewFetchedAt.Time,
+        }
+    }
+    return &su, nil
 }
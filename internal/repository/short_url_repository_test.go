@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFulltextQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want string
+	}{
+		{"words", "Summer Sale", "summer* sale*"},
+		{"operators", `+launch -draft "exact phrase" (group) >more <less ~not docs*`, "launch* draft* exact* phrase* group* more* less* not* docs*"},
+		{"at and quotes", `@distance 'quoted'`, "distance* quoted*"},
+		{"punctuation splits words", "example.com/path?utm_source=x", "example* com* path* utm* source* x*"},
+		{"short terms", "a b 7 go", "a* b* 7* go*"},
+		{"duplicates", "Go go GO", "go*"},
+		{"unicode", "Café Zürich 東京", "café* zürich* 東京*"},
+		{"only operators", `+-"*()<>~@`, ""},
+		{"empty", "   ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fulltextQuery(tt.q); got != tt.want {
+				t.Errorf("fulltextQuery(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFulltextQueryLimitsTerms(t *testing.T) {
+	var words []string
+	for c := 'a'; c <= 'z'; c++ {
+		words = append(words, string(c)+"word")
+	}
+
+	terms := strings.Fields(fulltextQuery(strings.Join(words, " ")))
+	if len(terms) != 20 {
+		t.Fatalf("got %d terms, want 20", len(terms))
+	}
+	if terms[0] != "aword*" || terms[19] != "tword*" {
+		t.Errorf("terms = %v, want the first 20 words", terms)
+	}
+}
@@ -3,18 +3,35 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"strconv"
+	"time"
+
 	"url_shortener/internal/models"
 )
 
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrInvalidMFACode    = errors.New("invalid MFA code")
 )
 
+// userColumns is the column list scanned by scanUser
+const userColumns = `id, username, email, password_hash, is_admin, totp_enabled, totp_secret, totp_last_step, created_at, updated_at`
+
 type UserRepository interface {
-	Create(user *models.User, password string) error
+	Create(user *models.User, password string, ac models.AuditContext) error
 	GetByUsername(username string) (*models.User, error)
 	GetByID(id int) (*models.User, error)
+	UpdatePassword(id int, passwordHash string, ac models.AuditContext) error
+	Delete(id int, deleteLinks bool, ac models.AuditContext) error
+	CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash string, passwordHash string, ac models.AuditContext) (int, error)
+	SetTOTPSecret(id int, secret string) error
+	EnableTOTP(id int, recoveryCodeHashes []string, ac models.AuditContext) error
+	DisableTOTP(id int, ac models.AuditContext) error
+	UseTOTPStep(id int, step int64) error
+	ConsumeRecoveryCode(id int, codeHash string) error
 }
 
 type userRepository struct {
@@ -25,13 +42,19 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *models.User, password string) error {
+func (r *userRepository) Create(user *models.User, password string, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO users (username, password_hash)
-		VALUES (?, ?)
+		INSERT INTO users (username, email, password_hash)
+		VALUES (?, ?, ?)
 	`
 
-	result, err := r.db.Exec(query, user.Username, password)
+	result, err := tx.Exec(query, user.Username, nullString(user.Email), password)
 	if err != nil {
 		if isDuplicateKeyError(err) {
 			return ErrUserAlreadyExists
@@ -43,48 +66,373 @@ func (r *userRepository) Create(user *models.User, password string) error {
 	if err != nil {
 		return err
 	}
-
 	user.ID = int(id)
-	return nil
+
+	// Users sign themselves up
+	if ac.ActorID == 0 {
+		ac.ActorID = user.ID
+	}
+	if err := recordAudit(tx, ac, models.ActionUserSignup, models.TargetUser, strconv.Itoa(user.ID), nil, user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userRepository) GetByUsername(username string) (*models.User, error) {
-	var user models.User
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+
+	return scanUser(r.db.QueryRow(query, username))
+}
+
+func (r *userRepository) GetByID(id int) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
+	return scanUser(r.db.QueryRow(query, id))
+}
+
+// UpdatePassword replaces the password hash of a user and invalidates the
+// user's outstanding password reset tokens
+func (r *userRepository) UpdatePassword(id int, passwordHash string, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updatePassword(tx, id, passwordHash); err != nil {
+		return err
+	}
+
+	if err := recordAudit(tx, ac, models.ActionUserPasswordChange, models.TargetUser, strconv.Itoa(id), nil, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updatePassword sets the password hash of a user within tx and invalidates
+// the user's outstanding reset tokens, which were issued for the old password.
+func updatePassword(tx *sql.Tx, id int, passwordHash string) error {
 	query := `
-		SELECT id, username, password_hash, created_at, updated_at
-		FROM users
-		WHERE username = ?
+		UPDATE users
+		SET password_hash = ?
+		WHERE id = ?
 	`
 
-	err := r.db.QueryRow(query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	result, err := tx.Exec(query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.Exec(`
+		UPDATE password_reset_tokens
+		SET used_at = ?
+		WHERE user_id = ? AND used_at IS NULL
+	`, time.Now(), id)
+	return err
+}
+
+// Delete removes a user. When deleteLinks is set the user's personal short
+// URLs are moved to the trash in the same transaction, to be purged like
+// other deleted links, otherwise they are kept without an owner. Either way
+// they are marked with owner_deleted_at so nobody can read them afterwards.
+// Links that belong to a workspace stay with the workspace.
+//
+// A user who is the only owner of a workspace can't be deleted; a
+// *SoleOwnerError listing those workspaces is returned instead.
+func (r *userRepository) Delete(id int, deleteLinks bool, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ? FOR UPDATE`, id))
+	if err != nil {
+		return err
+	}
+
+	sole, err := soleOwnedWorkspaces(tx, id)
+	if err != nil {
+		return err
+	}
+	if len(sole) > 0 {
+		return &SoleOwnerError{WorkspaceIDs: sole}
+	}
+
+	var linksDeleted int64
+	if deleteLinks {
+		result, err := tx.Exec(`
+			UPDATE short_urls
+			SET deleted_at = ?, version = version + 1
+			WHERE user_id = ? AND workspace_id IS NULL AND deleted_at IS NULL
+		`, time.Now(), id)
+		if err != nil {
+			return err
+		}
+		if linksDeleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE short_urls
+		SET owner_deleted_at = ?
+		WHERE user_id = ? AND workspace_id IS NULL
+	`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	after := map[string]int64{"linksDeleted": linksDeleted}
+	if err := recordAudit(tx, ac, models.ActionUserDelete, models.TargetUser, strconv.Itoa(id), before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreatePasswordResetToken stores the hash of a new reset token. Any tokens
+// previously issued to the user are invalidated.
+func (r *userRepository) CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE password_reset_tokens
+		SET used_at = ?
+		WHERE user_id = ? AND used_at IS NULL
+	`, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword consumes an unused, unexpired reset token and sets the new
+// password of the user it was issued to in the same transaction. The user's
+// ID is returned.
+func (r *userRepository) ResetPassword(tokenHash string, passwordHash string, ac models.AuditContext) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	var userID int
+	err = tx.QueryRow(`
+		SELECT user_id
+		FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE
+	`, tokenHash, time.Now()).Scan(&userID)
 	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+		return 0, ErrInvalidResetToken
 	} else if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &user, nil
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ?`, time.Now(), tokenHash); err != nil {
+		return 0, err
+	}
+
+	if err := updatePassword(tx, userID, passwordHash); err != nil {
+		return 0, err
+	}
+
+	if ac.ActorID == 0 {
+		ac.ActorID = userID
+	}
+	if err := recordAudit(tx, ac, models.ActionUserPasswordReset, models.TargetUser, strconv.Itoa(userID), nil, nil); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
 }
 
-func (r *userRepository) GetByID(id int) (*models.User, error) {
-	var user models.User
+// SetTOTPSecret stores a pending TOTP secret. Two-factor authentication stays
+// disabled until the enrollment is confirmed with EnableTOTP.
+func (r *userRepository) SetTOTPSecret(id int, secret string) error {
 	query := `
-		SELECT id, username, password_hash, created_at, updated_at
-		FROM users
+		UPDATE users
+		SET totp_secret = ?, totp_enabled = FALSE, totp_last_step = 0
 		WHERE id = ?
 	`
 
-	err := r.db.QueryRow(query, id).Scan(
+	result, err := r.db.Exec(query, secret, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication and replaces the user's
+// recovery codes with the given hashes
+func (r *userRepository) EnableTOTP(id int, recoveryCodeHashes []string, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET totp_enabled = TRUE WHERE id = ? AND totp_secret IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)`, id, hash); err != nil {
+			return err
+		}
+	}
+
+	if err := recordAudit(tx, ac, models.ActionUserMFAEnable, models.TargetUser, strconv.Itoa(id), nil, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication and removes the secret and
+// recovery codes
+func (r *userRepository) DisableTOTP(id int, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+
+	if err := recordAudit(tx, ac, models.ActionUserMFADisable, models.TargetUser, strconv.Itoa(id), nil, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code. It fails with
+// ErrInvalidMFACode if that step (or a later one) was already used, so a code
+// can't be replayed.
+func (r *userRepository) UseTOTPStep(id int, step int64) error {
+	result, err := r.db.Exec(`
+		UPDATE users
+		SET totp_last_step = ?
+		WHERE id = ? AND totp_last_step < ?
+	`, step, id, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used
+func (r *userRepository) ConsumeRecoveryCode(id int, codeHash string) error {
+	result, err := r.db.Exec(`
+		UPDATE mfa_recovery_codes
+		SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+		LIMIT 1
+	`, time.Now(), id, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var email, totpSecret sql.NullString
+
+	err := row.Scan(
 		&user.ID,
 		&user.Username,
+		&email,
 		&user.PasswordHash,
+		&user.IsAdmin,
+		&user.TOTPEnabled,
+		&totpSecret,
+		&user.TOTPLastStep,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -95,9 +443,15 @@ func (r *userRepository) GetByID(id int) (*models.User, error) {
 		return nil, err
 	}
 
+	user.Email = email.String
+	user.TOTPSecret = totpSecret.String
 	return &user, nil
 }
 
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func isDuplicateKeyError(err error) bool {
 	return err != nil && err.Error()[0:10] == "Error 1062"
-} 
\ No newline at end of file
+}
@@ -0,0 +1,462 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"url_shortener/internal/models"
+)
+
+var (
+	ErrWorkspaceNotFound      = errors.New("workspace not found")
+	ErrNotWorkspaceMember     = errors.New("not a workspace member")
+	ErrLastWorkspaceOwner     = errors.New("workspace must keep at least one owner")
+	ErrInvalidInvitation      = errors.New("invalid or expired invitation")
+	ErrAlreadyWorkspaceMember = errors.New("already a workspace member")
+)
+
+// SoleOwnerError is returned when a user can't leave because they are the
+// only owner of some workspaces. It matches ErrLastWorkspaceOwner.
+type SoleOwnerError struct {
+	WorkspaceIDs []int
+}
+
+func (e *SoleOwnerError) Error() string {
+	return ErrLastWorkspaceOwner.Error()
+}
+
+func (e *SoleOwnerError) Is(target error) bool {
+	return target == ErrLastWorkspaceOwner
+}
+
+type WorkspaceRepository interface {
+	Create(workspace *models.Workspace, ac models.AuditContext) error
+	GetByID(id int) (*models.Workspace, error)
+	ListForUser(userID int) ([]*models.Workspace, error)
+	GetMemberRole(workspaceID, userID int) (models.WorkspaceRole, error)
+	ListMembers(workspaceID int) ([]*models.WorkspaceMember, error)
+	SetMemberRole(workspaceID, userID int, role models.WorkspaceRole, ac models.AuditContext) error
+	RemoveMember(workspaceID, userID int, ac models.AuditContext) error
+	CreateInvitation(invitation *models.WorkspaceInvitation, tokenHash string, ac models.AuditContext) error
+	AcceptInvitation(tokenHash string, userID int, ac models.AuditContext) (*models.WorkspaceMember, error)
+	UpdateSettings(workspace *models.Workspace, ac models.AuditContext) error
+}
+
+type workspaceRepository struct {
+	db *sql.DB
+}
+
+func NewWorkspaceRepository(db *sql.DB) WorkspaceRepository {
+	return &workspaceRepository{db: db}
+}
+
+// Create inserts a workspace and makes its creator the owner
+func (r *workspaceRepository) Create(workspace *models.Workspace, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	workspace.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO workspaces (name, created_by, created_at, strip_tracking_params)
+		VALUES (?, ?, ?, ?)
+	`, workspace.Name, workspace.CreatedBy, workspace.CreatedAt, workspace.StripTrackingParams)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	workspace.ID = int(id)
+
+	_, err = tx.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES (?, ?, ?)
+	`, workspace.ID, workspace.CreatedBy, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	workspace.Role = models.RoleOwner
+	if err := recordAudit(tx, ac, models.ActionWorkspaceCreate, models.TargetWorkspace, strconv.Itoa(workspace.ID), nil, workspace); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *workspaceRepository) GetByID(id int) (*models.Workspace, error) {
+	var ws models.Workspace
+	var createdBy sql.NullInt64
+
+	err := r.db.QueryRow(`
+		SELECT id, name, created_by, created_at, strip_tracking_params
+		FROM workspaces
+		WHERE id = ?
+	`, id).Scan(&ws.ID, &ws.Name, &createdBy, &ws.CreatedAt, &ws.StripTrackingParams)
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkspaceNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	ws.CreatedBy = int(createdBy.Int64)
+	return &ws, nil
+}
+
+// ListForUser returns the workspaces the user is a member of, with their role
+func (r *workspaceRepository) ListForUser(userID int) ([]*models.Workspace, error) {
+	rows, err := r.db.Query(`
+		SELECT w.id, w.name, w.created_by, w.created_at, w.strip_tracking_params, m.role
+		FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = ?
+		ORDER BY w.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*models.Workspace{}
+	for rows.Next() {
+		var ws models.Workspace
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&ws.ID, &ws.Name, &createdBy, &ws.CreatedAt, &ws.StripTrackingParams, &ws.Role); err != nil {
+			return nil, err
+		}
+		ws.CreatedBy = int(createdBy.Int64)
+		workspaces = append(workspaces, &ws)
+	}
+
+	return workspaces, rows.Err()
+}
+
+// GetMemberRole returns the role of a user in a workspace
+func (r *workspaceRepository) GetMemberRole(workspaceID, userID int) (models.WorkspaceRole, error) {
+	var role models.WorkspaceRole
+	err := r.db.QueryRow(`
+		SELECT role
+		FROM workspace_members
+		WHERE workspace_id = ? AND user_id = ?
+	`, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotWorkspaceMember
+	} else if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (r *workspaceRepository) ListMembers(workspaceID int) ([]*models.WorkspaceMember, error) {
+	rows, err := r.db.Query(`
+		SELECT m.workspace_id, m.user_id, u.username, m.role, m.created_at
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = ?
+		ORDER BY u.username
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.WorkspaceMember{}
+	for rows.Next() {
+		var m models.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, &m)
+	}
+
+	return members, rows.Err()
+}
+
+// UpdateSettings stores the settings of a workspace
+func (r *workspaceRepository) UpdateSettings(workspace *models.Workspace, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before models.Workspace
+	var createdBy sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT id, name, created_by, created_at, strip_tracking_params
+		FROM workspaces
+		WHERE id = ?
+		FOR UPDATE
+	`, workspace.ID).Scan(&before.ID, &before.Name, &createdBy, &before.CreatedAt, &before.StripTrackingParams)
+	if err == sql.ErrNoRows {
+		return ErrWorkspaceNotFound
+	} else if err != nil {
+		return err
+	}
+	before.CreatedBy = int(createdBy.Int64)
+
+	_, err = tx.Exec(`
+		UPDATE workspaces
+		SET strip_tracking_params = ?
+		WHERE id = ?
+	`, workspace.StripTrackingParams, workspace.ID)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.StripTrackingParams = workspace.StripTrackingParams
+	if err := recordAudit(tx, ac, models.ActionWorkspaceSettings, models.TargetWorkspace, strconv.Itoa(workspace.ID), before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetMemberRole changes the role of an existing member. The last owner can't
+// be demoted.
+func (r *workspaceRepository) SetMemberRole(workspaceID, userID int, role models.WorkspaceRole, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != models.RoleOwner {
+		if err := ensureOtherOwner(tx, workspaceID, userID); err != nil {
+			return err
+		}
+	}
+
+	previous, err := getMemberRoleTx(tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE workspace_members
+		SET role = ?
+		WHERE workspace_id = ? AND user_id = ?
+	`, role, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	before := memberAudit{UserID: userID, Role: previous}
+	after := memberAudit{UserID: userID, Role: role}
+	if err := recordAudit(tx, ac, models.ActionWorkspaceMemberRole, models.TargetWorkspace, strconv.Itoa(workspaceID), before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes a user from a workspace. The last owner can't be removed.
+func (r *workspaceRepository) RemoveMember(workspaceID, userID int, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureOtherOwner(tx, workspaceID, userID); err != nil {
+		return err
+	}
+
+	role, err := getMemberRoleTx(tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM workspace_members
+		WHERE workspace_id = ? AND user_id = ?
+	`, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	before := memberAudit{UserID: userID, Role: role}
+	if err := recordAudit(tx, ac, models.ActionWorkspaceMemberRemove, models.TargetWorkspace, strconv.Itoa(workspaceID), before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateInvitation stores a new invitation identified by the hash of its token
+func (r *workspaceRepository) CreateInvitation(invitation *models.WorkspaceInvitation, tokenHash string, ac models.AuditContext) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	invitation.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, invitation.WorkspaceID, invitation.Email, invitation.Role, tokenHash,
+		invitation.InvitedBy, invitation.ExpiresAt, invitation.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invitation.ID = int(id)
+
+	if err := recordAudit(tx, ac, models.ActionWorkspaceInvite, models.TargetWorkspace, strconv.Itoa(invitation.WorkspaceID), nil, invitation); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AcceptInvitation consumes an unused, unexpired invitation and adds the user
+// to the workspace with the invited role
+func (r *workspaceRepository) AcceptInvitation(tokenHash string, userID int, ac models.AuditContext) (*models.WorkspaceMember, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	member := models.WorkspaceMember{UserID: userID}
+	err = tx.QueryRow(`
+		SELECT id, workspace_id, role
+		FROM workspace_invitations
+		WHERE token_hash = ? AND accepted_at IS NULL AND expires_at > ?
+		FOR UPDATE
+	`, tokenHash, time.Now()).Scan(&id, &member.WorkspaceID, &member.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidInvitation
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := getMemberRoleTx(tx, member.WorkspaceID, userID); err == nil {
+		return nil, ErrAlreadyWorkspaceMember
+	} else if err != ErrNotWorkspaceMember {
+		return nil, err
+	}
+
+	member.CreatedAt = time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, member.WorkspaceID, userID, member.Role, member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE workspace_invitations
+		SET accepted_at = ?, accepted_by = ?
+		WHERE id = ?
+	`, member.CreatedAt, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	after := map[string]interface{}{"invitationId": id, "userId": userID, "role": member.Role}
+	if err := recordAudit(tx, ac, models.ActionWorkspaceJoin, models.TargetWorkspace, strconv.Itoa(member.WorkspaceID), nil, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// memberAudit is the audited state of a workspace membership
+type memberAudit struct {
+	UserID int                  `json:"userId"`
+	Role   models.WorkspaceRole `json:"role"`
+}
+
+// ensureOtherOwner fails with ErrLastWorkspaceOwner if userID is the only
+// owner of the workspace. The owner rows are locked until the transaction ends.
+func ensureOtherOwner(tx *sql.Tx, workspaceID, userID int) error {
+	var owners int
+	err := tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM workspace_members
+		WHERE workspace_id = ? AND role = ? AND user_id <> ?
+		FOR UPDATE
+	`, workspaceID, models.RoleOwner, userID).Scan(&owners)
+	if err != nil {
+		return err
+	}
+
+	if owners == 0 {
+		role, err := getMemberRoleTx(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if role == models.RoleOwner {
+			return ErrLastWorkspaceOwner
+		}
+	}
+	return nil
+}
+
+// soleOwnedWorkspaces returns the workspaces userID is the only owner of,
+// locking their owner rows like ensureOtherOwner
+func soleOwnedWorkspaces(tx *sql.Tx, userID int) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT workspace_id
+		FROM workspace_members
+		WHERE user_id = ? AND role = ?
+		ORDER BY workspace_id
+		FOR UPDATE
+	`, userID, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	var owned []int
+	for rows.Next() {
+		var workspaceID int
+		if err := rows.Scan(&workspaceID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owned = append(owned, workspaceID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var sole []int
+	for _, workspaceID := range owned {
+		switch err := ensureOtherOwner(tx, workspaceID, userID); err {
+		case nil:
+		case ErrLastWorkspaceOwner:
+			sole = append(sole, workspaceID)
+		default:
+			return nil, err
+		}
+	}
+	return sole, nil
+}
+
+func getMemberRoleTx(tx *sql.Tx, workspaceID, userID int) (models.WorkspaceRole, error) {
+	var role models.WorkspaceRole
+	err := tx.QueryRow(`
+		SELECT role
+		FROM workspace_members
+		WHERE workspace_id = ? AND user_id = ?
+	`, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotWorkspaceMember
+	}
+	return role, err
+}
@@ -0,0 +1,95 @@
+// Package scheduler applies scheduled destination changes of short URLs
+// when they are due.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+	"url_shortener/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Store is the part of the revision repository used by the scheduler
+type Store interface {
+	ListDueChanges(now time.Time, limit int) ([]*models.ScheduledChange, error)
+	ApplyScheduledChange(change *models.ScheduledChange) error
+}
+
+// Scheduler polls for due changes every interval
+type Scheduler struct {
+	store     Store
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+// New creates a Scheduler
+func New(store Store, cfg config.ScheduledChangesConfig) *Scheduler {
+	s := &Scheduler{
+		store:     store,
+		interval:  time.Duration(cfg.IntervalSeconds) * time.Second,
+		batchSize: cfg.BatchSize,
+		now:       time.Now,
+	}
+	if s.interval <= 0 {
+		s.interval = 30 * time.Second
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = 100
+	}
+	return s
+}
+
+// Run applies due changes every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.ApplyDue(ctx); err != nil {
+			logger.GetLogger().Error("Applying scheduled changes failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyDue applies the changes that are due and returns how many were
+// applied. A change that fails stays due and is retried on the next run.
+func (s *Scheduler) ApplyDue(ctx context.Context) (int, error) {
+	var applied int
+	for ctx.Err() == nil {
+		changes, err := s.store.ListDueChanges(s.now(), s.batchSize)
+		if err != nil {
+			return applied, err
+		}
+
+		failed := false
+		for _, change := range changes {
+			if err := s.store.ApplyScheduledChange(change); err != nil {
+				logger.GetLogger().Error("Failed to apply scheduled change",
+					zap.Int("change_id", change.ID),
+					zap.String("short_code", change.ShortCode),
+					zap.Error(err),
+				)
+				failed = true
+				continue
+			}
+			applied++
+		}
+
+		// Failed changes would be listed again right away
+		if failed || len(changes) < s.batchSize {
+			break
+		}
+	}
+	return applied, nil
+}
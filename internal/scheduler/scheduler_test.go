@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+type fakeStore struct {
+	pending []*models.ScheduledChange
+	fail    map[int]bool
+	applied []int
+}
+
+func (s *fakeStore) ListDueChanges(now time.Time, limit int) ([]*models.ScheduledChange, error) {
+	var due []*models.ScheduledChange
+	for _, c := range s.pending {
+		if !c.ActivateAt.After(now) && len(due) < limit {
+			due = append(due, c)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) ApplyScheduledChange(change *models.ScheduledChange) error {
+	if s.fail[change.ID] {
+		return errors.New("apply failed")
+	}
+	s.applied = append(s.applied, change.ID)
+	for i, c := range s.pending {
+		if c.ID == change.ID {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestApplyDue(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{fail: map[int]bool{}}
+	for id := 1; id <= 5; id++ {
+		store.pending = append(store.pending, &models.ScheduledChange{ID: id, ActivateAt: now.Add(-time.Minute)})
+	}
+	store.pending = append(store.pending, &models.ScheduledChange{ID: 6, ActivateAt: now.Add(time.Minute)})
+
+	s := New(store, config.ScheduledChangesConfig{BatchSize: 2})
+	s.now = func() time.Time { return now }
+
+	// Due changes are applied over several batches, future ones are left
+	applied, err := s.ApplyDue(context.Background())
+	if err != nil || applied != 5 {
+		t.Fatalf("ApplyDue() = %d, %v, want 5", applied, err)
+	}
+	if len(store.pending) != 1 || store.pending[0].ID != 6 {
+		t.Errorf("pending = %v, want only change 6", store.pending)
+	}
+
+	// A failing change doesn't keep the run going forever
+	now = now.Add(time.Hour)
+	store.fail[6] = true
+	applied, err = s.ApplyDue(context.Background())
+	if err != nil || applied != 0 {
+		t.Errorf("ApplyDue() with a failing change = %d, %v, want 0", applied, err)
+	}
+}
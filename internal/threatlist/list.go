@@ -0,0 +1,309 @@
+// Package threatlist matches destination URLs against locally stored
+// malware and phishing feeds.
+package threatlist
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Feed formats
+const (
+	// FormatHosts is a hosts file: "0.0.0.0 evil.example" lines or bare
+	// entries. Entries containing a slash are URL prefixes, anything else a
+	// hostname that also matches its subdomains.
+	FormatHosts = "hosts"
+	// FormatHashPrefix lists hex encoded SHA-256 prefixes (4 to 32 bytes) of
+	// Safe Browsing style URL expressions, one per line
+	FormatHashPrefix = "hashprefix"
+)
+
+// Match describes the feed entry a URL was found in
+type Match struct {
+	Feed  string `json:"feed"`
+	Entry string `json:"entry"`
+}
+
+// entries is an immutable snapshot of all loaded feeds
+type entries struct {
+	hosts       map[string]string         // hostname -> feed
+	urlPrefixes []Match                   // host/path prefixes
+	hashes      map[int]map[string]string // prefix length -> prefix -> feed
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// List holds the loaded threat feeds. It is safe for concurrent use and
+// reloads feeds whose files change when Watch is running.
+type List struct {
+	feeds []config.ThreatFeedConfig
+
+	mu      sync.RWMutex
+	entries *entries
+	files   map[string]fileState
+}
+
+// New loads the configured feeds. With no feeds the list matches nothing.
+func New(cfg config.ThreatListConfig) (*List, error) {
+	l := &List{feeds: cfg.Feeds}
+	for _, f := range l.feeds {
+		if f.Format != FormatHosts && f.Format != FormatHashPrefix {
+			return nil, fmt.Errorf("threatlist: feed %q has unknown format %q", f.Name, f.Format)
+		}
+	}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads all feeds and replaces the current entries. If any feed fails
+// to load the current entries are kept.
+func (l *List) Reload() error {
+	e := &entries{
+		hosts:  make(map[string]string),
+		hashes: make(map[int]map[string]string),
+	}
+	files := make(map[string]fileState, len(l.feeds))
+
+	for _, f := range l.feeds {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return fmt.Errorf("threatlist: %w", err)
+		}
+		if err := e.load(f); err != nil {
+			return err
+		}
+		files[f.Path] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	l.mu.Lock()
+	l.entries = e
+	l.files = files
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the feeds whenever one of their files changes, checking every
+// interval until ctx is cancelled
+func (l *List) Watch(ctx context.Context, interval time.Duration) {
+	if len(l.feeds) == 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				logger.GetLogger().Error("Failed to reload threat feeds", zap.Error(err))
+				continue
+			}
+			logger.GetLogger().Info("Reloaded threat feeds", zap.Int("feeds", len(l.feeds)))
+		}
+	}
+}
+
+func (l *List) changed() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, f := range l.feeds {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			continue
+		}
+		if prev := l.files[f.Path]; !info.ModTime().Equal(prev.modTime) || info.Size() != prev.size {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports whether rawURL matches any loaded feed
+func (l *List) Check(rawURL string) (Match, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return Match{}, false
+	}
+	host := canonicalHost(u.Hostname())
+	if host == "" {
+		return Match{}, false
+	}
+
+	l.mu.RLock()
+	e := l.entries
+	l.mu.RUnlock()
+	if e == nil {
+		return Match{}, false
+	}
+
+	for h := host; h != ""; {
+		if feed, ok := e.hosts[h]; ok {
+			return Match{Feed: feed, Entry: h}, true
+		}
+		_, h, _ = strings.Cut(h, ".")
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	hostPath := host + path
+	for _, p := range e.urlPrefixes {
+		if strings.HasPrefix(hostPath, p.Entry) {
+			return p, true
+		}
+	}
+
+	if len(e.hashes) > 0 {
+		for _, expr := range expressions(host, path, u.RawQuery) {
+			sum := sha256.Sum256([]byte(expr))
+			for n, prefixes := range e.hashes {
+				if feed, ok := prefixes[string(sum[:n])]; ok {
+					return Match{Feed: feed, Entry: expr}, true
+				}
+			}
+		}
+	}
+
+	return Match{}, false
+}
+
+func (e *entries) load(f config.ThreatFeedConfig) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("threatlist: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch f.Format {
+		case FormatHosts:
+			// "0.0.0.0 evil.example www.evil.example" or just "evil.example"
+			if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+				fields = fields[1:]
+			}
+			for _, entry := range fields {
+				e.addHostEntry(f.Name, entry)
+			}
+		case FormatHashPrefix:
+			prefix, err := hex.DecodeString(fields[0])
+			if err != nil || len(prefix) < 4 || len(prefix) > sha256.Size {
+				return fmt.Errorf("threatlist: %s:%d: invalid hash prefix", f.Path, n)
+			}
+			if e.hashes[len(prefix)] == nil {
+				e.hashes[len(prefix)] = make(map[string]string)
+			}
+			e.hashes[len(prefix)][string(prefix)] = f.Name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("threatlist: %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// hostsFileNames are the standard entries of a hosts file, never threats
+var hostsFileNames = map[string]bool{
+	"localhost": true, "localhost.localdomain": true, "local": true,
+	"broadcasthost": true, "ip6-localhost": true, "ip6-loopback": true, "0.0.0.0": true,
+}
+
+func (e *entries) addHostEntry(feed, entry string) {
+	entry = strings.TrimPrefix(strings.TrimPrefix(entry, "http://"), "https://")
+	host, path, hasPath := strings.Cut(entry, "/")
+	host = canonicalHost(host)
+	if host == "" || hostsFileNames[host] {
+		return
+	}
+	if hasPath {
+		e.urlPrefixes = append(e.urlPrefixes, Match{Feed: feed, Entry: host + "/" + path})
+		return
+	}
+	e.hosts[host] = feed
+}
+
+func canonicalHost(host string) string {
+	return strings.Trim(strings.ToLower(host), ".")
+}
+
+// expressions returns the host suffix / path prefix combinations that are
+// hashed for a URL, following the Safe Browsing lookup rules: the exact host
+// plus up to four suffixes built from the last five labels, combined with the
+// exact path with and without query plus up to four leading path prefixes.
+func expressions(host, path, query string) []string {
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		start := len(labels) - 5
+		if start < 1 {
+			start = 1
+		}
+		for i := start; i < len(labels)-1; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	var paths []string
+	if query != "" {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, added := 0, 0; i < len(segments) && added < 4; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+			added++
+		}
+		if segments[i] == "" {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			expr := h + p
+			if !seen[expr] {
+				seen[expr] = true
+				exprs = append(exprs, expr)
+			}
+		}
+	}
+	return exprs
+}
@@ -0,0 +1,119 @@
+package threatlist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+)
+
+func writeFeed(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hashPrefix(expr string, n int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:n])
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	hosts := writeFeed(t, dir, "hosts.txt", `# malware hosts
+127.0.0.1 localhost
+0.0.0.0 malware.example www.bad.example
+phish.example/login
+`)
+	hashes := writeFeed(t, dir, "hashes.txt", hashPrefix("evil.example/", 4)+"\n"+hashPrefix("docs.example/phish/", 32)+"\n")
+
+	l, err := New(config.ThreatListConfig{Feeds: []config.ThreatFeedConfig{
+		{Name: "malware", Path: hosts, Format: FormatHosts},
+		{Name: "phishing", Path: hashes, Format: FormatHashPrefix},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		feed string
+	}{
+		{"http://malware.example/", "malware"},
+		{"https://cdn.MALWARE.example./x", "malware"},
+		{"http://www.bad.example/", "malware"},
+		{"http://bad.example/", ""},
+		{"http://phish.example/login?next=/", "malware"},
+		{"http://phish.example/about", ""},
+		{"http://evil.example/any/path?q=1", "phishing"},
+		{"http://a.b.evil.example/", "phishing"},
+		{"http://docs.example/phish/page.html", "phishing"},
+		{"http://docs.example/other", ""},
+		{"http://localhost/", ""},
+		{"https://example.com/", ""},
+	}
+
+	for _, tt := range tests {
+		m, ok := l.Check(tt.url)
+		if ok != (tt.feed != "") || m.Feed != tt.feed {
+			t.Errorf("Check(%q) = %+v, %v, want feed %q", tt.url, m, ok, tt.feed)
+		}
+	}
+}
+
+func TestReloadKeepsEntriesOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFeed(t, dir, "hashes.txt", hashPrefix("evil.example/", 4)+"\n")
+
+	l, err := New(config.ThreatListConfig{Feeds: []config.ThreatFeedConfig{
+		{Name: "phishing", Path: path, Format: FormatHashPrefix},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFeed(t, dir, "hashes.txt", "not hex\n")
+	if err := l.Reload(); err == nil {
+		t.Fatal("Reload accepted an invalid feed")
+	}
+	if _, ok := l.Check("http://evil.example/"); !ok {
+		t.Error("entries were dropped after a failed reload")
+	}
+
+	writeFeed(t, dir, "hashes.txt", hashPrefix("other.example/", 4)+"\n")
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if !l.changed() {
+		t.Fatal("changed feed not detected")
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Check("http://evil.example/"); ok {
+		t.Error("stale entry matched after reload")
+	}
+	if _, ok := l.Check("http://other.example/"); !ok {
+		t.Error("new entry not matched after reload")
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	got := expressions("a.b.c.d.e.f.g", "/1/2.html", "param=1")
+	want := []string{
+		"a.b.c.d.e.f.g/1/2.html?param=1", "a.b.c.d.e.f.g/1/2.html", "a.b.c.d.e.f.g/", "a.b.c.d.e.f.g/1/",
+		"c.d.e.f.g/1/2.html?param=1", "c.d.e.f.g/1/2.html", "c.d.e.f.g/", "c.d.e.f.g/1/",
+		"d.e.f.g/1/2.html?param=1", "d.e.f.g/1/2.html", "d.e.f.g/", "d.e.f.g/1/",
+		"e.f.g/1/2.html?param=1", "e.f.g/1/2.html", "e.f.g/", "e.f.g/1/",
+		"f.g/1/2.html?param=1", "f.g/1/2.html", "f.g/", "f.g/1/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expressions() = %v, want %v", got, want)
+	}
+}
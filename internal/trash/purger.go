@@ -0,0 +1,97 @@
+// Package trash purges deleted short URLs once their retention period has
+// passed.
+package trash
+
+import (
+	"context"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Store is the part of the short URL repository used by the purger
+type Store interface {
+	PurgeDeleted(deletedBefore time.Time, quarantine time.Duration, limit int) (int, error)
+	ReleaseQuarantinedCodes(now time.Time) (int64, error)
+}
+
+// Purger removes links that have been in the trash for longer than the
+// retention period every interval
+type Purger struct {
+	store      Store
+	retention  time.Duration
+	quarantine time.Duration
+	interval   time.Duration
+	batchSize  int
+	now        func() time.Time
+}
+
+// New creates a Purger
+func New(store Store, cfg config.TrashConfig) *Purger {
+	p := &Purger{
+		store:      store,
+		retention:  time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		quarantine: time.Duration(cfg.QuarantineDays) * 24 * time.Hour,
+		interval:   time.Duration(cfg.PurgeIntervalMinutes) * time.Minute,
+		batchSize:  cfg.BatchSize,
+		now:        time.Now,
+	}
+	if p.retention <= 0 {
+		p.retention = 30 * 24 * time.Hour
+	}
+	if p.quarantine < 0 {
+		p.quarantine = 0
+	}
+	if p.interval <= 0 {
+		p.interval = time.Hour
+	}
+	if p.batchSize <= 0 {
+		p.batchSize = 500
+	}
+	return p
+}
+
+// Run purges the trash every interval until ctx is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := p.Purge(ctx); err != nil {
+			logger.GetLogger().Error("Purging deleted links failed", zap.Error(err))
+		} else if purged > 0 {
+			logger.GetLogger().Info("Purged deleted links", zap.Int("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the links whose retention period has passed, in batches, and
+// returns how many were removed. Quarantines that have ended are released.
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	now := p.now()
+	var purged int
+	for ctx.Err() == nil {
+		n, err := p.store.PurgeDeleted(now.Add(-p.retention), p.quarantine, p.batchSize)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+		if n < p.batchSize {
+			break
+		}
+	}
+
+	if _, err := p.store.ReleaseQuarantinedCodes(now); err != nil {
+		return purged, err
+	}
+	return purged, nil
+}
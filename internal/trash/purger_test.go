@@ -0,0 +1,78 @@
+package trash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+)
+
+type fakeStore struct {
+	deleted     []time.Time // deletion times of the links in the trash
+	quarantined map[time.Time]bool
+	calls       int
+	released    time.Time
+}
+
+func (s *fakeStore) PurgeDeleted(deletedBefore time.Time, quarantine time.Duration, limit int) (int, error) {
+	s.calls++
+	var kept []time.Time
+	var n int
+	for _, at := range s.deleted {
+		if at.Before(deletedBefore) && n < limit {
+			s.quarantined[at.Add(quarantine)] = true
+			n++
+			continue
+		}
+		kept = append(kept, at)
+	}
+	s.deleted = kept
+	return n, nil
+}
+
+func (s *fakeStore) ReleaseQuarantinedCodes(now time.Time) (int64, error) {
+	s.released = now
+	return 0, nil
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	store := &fakeStore{quarantined: map[time.Time]bool{}}
+	for i := 0; i < 5; i++ {
+		store.deleted = append(store.deleted, now.Add(-40*day))
+	}
+	store.deleted = append(store.deleted, now.Add(-10*day))
+
+	p := New(store, config.TrashConfig{RetentionDays: 30, QuarantineDays: 90, BatchSize: 2})
+	p.now = func() time.Time { return now }
+
+	// Links past the retention period are purged over several batches
+	purged, err := p.Purge(context.Background())
+	if err != nil || purged != 5 {
+		t.Fatalf("Purge() = %d, %v, want 5", purged, err)
+	}
+	if store.calls != 3 {
+		t.Errorf("PurgeDeleted called %d times, want 3", store.calls)
+	}
+	if len(store.deleted) != 1 || !store.deleted[0].Equal(now.Add(-10*day)) {
+		t.Errorf("trash = %v, want only the recent link", store.deleted)
+	}
+
+	// Codes are quarantined from their deletion time, and ended quarantines
+	// are released
+	if !store.quarantined[now.Add(50*day)] {
+		t.Errorf("quarantined = %v, want until %v", store.quarantined, now.Add(50*day))
+	}
+	if !store.released.Equal(now) {
+		t.Errorf("released at %v, want %v", store.released, now)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	p := New(&fakeStore{}, config.TrashConfig{QuarantineDays: -1})
+	if p.retention != 30*24*time.Hour || p.quarantine != 0 || p.interval != time.Hour || p.batchSize != 500 {
+		t.Errorf("defaults = %v %v %v %d", p.retention, p.quarantine, p.interval, p.batchSize)
+	}
+}
@@ -0,0 +1,37 @@
+// Package unfurl recognizes the bots of chats and social networks that fetch
+// links to show a preview of them.
+package unfurl
+
+import "strings"
+
+// Detector matches User-Agent headers against the known unfurling bots. A
+// nil Detector matches nothing.
+type Detector struct {
+	tokens []string
+}
+
+// NewDetector creates a Detector for bots whose User-Agent contains one of
+// tokens, ignoring case
+func NewDetector(tokens []string) *Detector {
+	d := &Detector{}
+	for _, token := range tokens {
+		if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+			d.tokens = append(d.tokens, token)
+		}
+	}
+	return d
+}
+
+// IsUnfurler reports whether userAgent belongs to an unfurling bot
+func (d *Detector) IsUnfurler(userAgent string) bool {
+	if d == nil || userAgent == "" {
+		return false
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, token := range d.tokens {
+		if strings.Contains(userAgent, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package unfurl
+
+import "testing"
+
+func TestIsUnfurler(t *testing.T) {
+	d := NewDetector([]string{"facebookexternalhit", "Twitterbot", " Slackbot-LinkExpanding ", ""})
+
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Twitterbot/1.0", true},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Slackbot 1.0 (+https://api.slack.com/robots)", false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := d.IsUnfurler(tt.userAgent); got != tt.want {
+			t.Errorf("IsUnfurler(%q) = %v, want %v", tt.userAgent, got, tt.want)
+		}
+	}
+
+	var disabled *Detector
+	if disabled.IsUnfurler("Twitterbot/1.0") {
+		t.Error("nil Detector matched")
+	}
+}
@@ -0,0 +1,171 @@
+package urlcheck
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/idna"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps characters that render like Latin letters to the letter
+// they imitate. It covers the Cyrillic, Greek and other look-alikes commonly
+// used in IDN spoofing, after NFKC normalization has folded fullwidth and
+// compatibility forms.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r',
+	'ѕ': 's', 'т': 't', 'υ': 'u', 'ս': 'u', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y', 'ү': 'y',
+	'ɡ': 'g', 'ց': 'g', 'ո': 'n', 'օ': 'o', 'ρ': 'p',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'τ': 't', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+	// Latin look-alikes outside ASCII
+	'ı': 'i', 'ȷ': 'j', 'ł': 'l', 'ƅ': 'b', 'ɑ': 'a', 'ɩ': 'i', 'ʏ': 'y', 'ɴ': 'n', 'ʀ': 'r',
+	'ꮃ': 'w', 'ꭰ': 'd',
+}
+
+// compatibleScripts are script combinations that are normal within a single
+// label: Japanese, Chinese and Korean text mixed with Latin
+var compatibleScripts = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// commonScripts are checked first when looking up the script of a character
+var commonScripts = []string{"Latin", "Cyrillic", "Greek", "Han", "Hiragana", "Katakana", "Hangul", "Arabic", "Hebrew", "Armenian"}
+
+// HomographDetector spots IDN hosts that imitate other hosts
+type HomographDetector struct {
+	brands []string
+	reject bool
+}
+
+// NewHomographDetector creates a detector protecting the configured brands. A
+// brand is either a name matched against each label ("paypal") or a domain
+// matched against the host and its parent domains ("paypal.com").
+func NewHomographDetector(cfg config.HomographConfig) *HomographDetector {
+	return &HomographDetector{
+		brands: normalizeDomains(cfg.ProtectedBrands),
+		reject: cfg.Action == "reject",
+	}
+}
+
+// Rejects reports whether suspicious hosts are rejected rather than flagged
+func (d *HomographDetector) Rejects() bool {
+	return d.reject
+}
+
+// Check inspects an ASCII (Punycode) host. It returns the decoded Unicode
+// host when it differs from host, and a reason when the host mixes scripts
+// within a label or imitates a protected brand with look-alike characters.
+func (d *HomographDetector) Check(host string) (unicodeHost string, reason string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	decoded, err := idna.ToUnicode(host)
+	if err != nil {
+		return "", "Host contains invalid punycode"
+	}
+	if decoded == host {
+		return "", ""
+	}
+
+	labels := strings.Split(decoded, ".")
+	for _, label := range labels {
+		if scripts := labelScripts(label); !scriptsCompatible(scripts) {
+			reason = "Host " + decoded + " mixes " + strings.Join(scripts, " and ") + " characters"
+			break
+		}
+	}
+
+	skeletonLabels := make([]string, len(labels))
+	for i, label := range labels {
+		skeletonLabels[i] = skeleton(label)
+	}
+	skeletonHost := strings.Join(skeletonLabels, ".")
+
+	for _, brand := range d.brands {
+		if strings.Contains(brand, ".") {
+			if skeletonHost != host && (skeletonHost == brand || strings.HasSuffix(skeletonHost, "."+brand)) {
+				return decoded, "Host " + decoded + " imitates " + brand
+			}
+			continue
+		}
+		for i, s := range skeletonLabels {
+			if s == brand && labels[i] != brand {
+				return decoded, "Host " + decoded + " imitates " + brand
+			}
+		}
+	}
+
+	return decoded, reason
+}
+
+// skeleton maps a label to the Latin characters it looks like
+func skeleton(label string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKC.String(strings.ToLower(label)) {
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// labelScripts returns the sorted scripts used in a label, ignoring
+// characters shared by all scripts such as digits and hyphens
+func labelScripts(label string) []string {
+	seen := make(map[string]bool)
+	for _, r := range label {
+		if s := scriptOf(r); s != "" {
+			seen[s] = true
+		}
+	}
+	scripts := make([]string, 0, len(seen))
+	for s := range seen {
+		scripts = append(scripts, s)
+	}
+	sort.Strings(scripts)
+	return scripts
+}
+
+func scriptOf(r rune) string {
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for _, name := range commonScripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+func scriptsCompatible(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+	for _, allowed := range compatibleScripts {
+		ok := true
+		for _, s := range scripts {
+			if !allowed[s] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
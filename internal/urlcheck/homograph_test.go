@@ -0,0 +1,46 @@
+package urlcheck
+
+import (
+	"strings"
+	"testing"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/idna"
+)
+
+func TestHomographDetector(t *testing.T) {
+	d := NewHomographDetector(config.HomographConfig{ProtectedBrands: []string{"paypal", "apple.com"}})
+
+	tests := []struct {
+		host       string
+		suspicious bool
+	}{
+		{"example.com", false},
+		{"paypal.com", false},
+		{"bücher.example", false},
+		{"пример.рф", false},
+		{"日本語テスト.jp", false},
+		{"한국어abc.kr", false},
+		{"pаypal.com", true},         // Cyrillic а
+		{"рaypal.example.net", true}, // Cyrillic р
+		{"аррӏе.com", true},          // all Cyrillic, imitates apple.com
+		{"www.аррӏе.com", true},
+		{"аррӏе.org", false},  // apple is only protected as apple.com
+		{"gοοgle.com", true},  // Greek ο mixed with Latin
+		{"ｐａｙｐａｌ.com", false}, // fullwidth folds to plain paypal.com
+	}
+
+	for _, tt := range tests {
+		ascii, err := idna.ToASCII(tt.host)
+		if err != nil {
+			t.Fatalf("ToASCII(%q): %v", tt.host, err)
+		}
+		unicodeHost, reason := d.Check(ascii)
+		if (reason != "") != tt.suspicious {
+			t.Errorf("Check(%q) reason = %q, want suspicious=%v", tt.host, reason, tt.suspicious)
+		}
+		if strings.Contains(ascii, "xn--") && unicodeHost == "" {
+			t.Errorf("Check(%q) returned no Unicode host", tt.host)
+		}
+	}
+}
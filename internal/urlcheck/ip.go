@@ -0,0 +1,138 @@
+package urlcheck
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// blockedPrefixes are the networks a destination may not point into:
+// loopback, private, link-local, CGNAT, multicast and other reserved ranges
+var blockedPrefixes = mustParsePrefixes(
+	// IPv4
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10", // carrier-grade NAT
+	"127.0.0.0/8",
+	"169.254.0.0/16", // link-local, includes cloud metadata endpoints
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4", // reserved, includes broadcast
+	// IPv6
+	"::/96", // unspecified, loopback and IPv4-compatible
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"fec0::/10",
+	"ff00::/8",
+)
+
+// nat64Prefix embeds an IPv4 address in its last four bytes
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		parsed[i] = netip.MustParsePrefix(p)
+	}
+	return parsed
+}
+
+// IsBlockedIP reports whether addr is in a private, loopback, link-local or
+// otherwise non-public range. IPv4-mapped and NAT64 addresses are checked
+// against the IPv4 address they embed.
+func IsBlockedIP(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]})
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPLiteral interprets host the way inet_aton and most HTTP clients do,
+// so "2130706433", "0x7f.1" and "0177.0.0.1" are all recognised as
+// 127.0.0.1. isIP is false for ordinary hostnames. canonical is false when the
+// address isn't written as a plain dotted quad or IPv6 literal, which is only
+// ever done to disguise the destination.
+func parseIPLiteral(host string) (addr netip.Addr, isIP bool, canonical bool) {
+	if strings.Contains(host, ":") {
+		addr, err := netip.ParseAddr(host)
+		if err != nil || addr.Zone() != "" {
+			return netip.Addr{}, true, false
+		}
+		return addr, true, true
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false, false
+	}
+
+	values := make([]uint64, len(parts))
+	canonical = len(parts) == 4
+	for i, part := range parts {
+		v, plain, ok := parseIPv4Part(part)
+		if !ok {
+			return netip.Addr{}, false, false
+		}
+		values[i] = v
+		canonical = canonical && plain
+	}
+
+	// Every part but the last is a single byte, the last one fills the
+	// remaining bytes of the address
+	var n uint64
+	for i, v := range values[:len(values)-1] {
+		if v > 0xff {
+			return netip.Addr{}, true, false
+		}
+		n |= v << (8 * (3 - i))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return netip.Addr{}, true, false
+	}
+	n |= last
+
+	addr = netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	return addr, true, canonical
+}
+
+// parseIPv4Part parses one dot-separated component of an IPv4 address in
+// decimal, octal (leading 0) or hex (0x prefix). plain is true for decimal
+// without leading zeros.
+func parseIPv4Part(part string) (v uint64, plain bool, ok bool) {
+	base := 10
+	digits := part
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, digits = 16, part[2:]
+		if digits == "" {
+			return 0, false, true
+		}
+	case len(part) > 1 && part[0] == '0':
+		base, digits = 8, part[1:]
+	}
+	if digits == "" {
+		return 0, false, false
+	}
+
+	v, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, false, false
+	}
+	return v, base == 10, true
+}
@@ -0,0 +1,156 @@
+package urlcheck
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+// RedirectChecker detects destinations that point back at this service and
+// resolves links of other URL shorteners to where they really lead
+type RedirectChecker struct {
+	client       *http.Client
+	validator    *Validator
+	ownDomains   []string
+	shorteners   []string
+	maxRedirects int
+}
+
+// NewRedirectChecker creates a RedirectChecker. Every hop is checked with
+// validator before it is requested. A nil client uses NewHTTPClient; tests can
+// pass the client of an httptest server.
+func NewRedirectChecker(cfg config.RedirectCheckConfig, client *http.Client, validator *Validator) *RedirectChecker {
+	if client == nil {
+		timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		client = NewHTTPClient(timeout, validator.allowPrivate)
+	}
+	// Redirects are followed one hop at a time by Resolve
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = 5
+	}
+	return &RedirectChecker{
+		client:       &noFollow,
+		validator:    validator,
+		ownDomains:   normalizeDomains(cfg.OwnDomains),
+		shorteners:   normalizeDomains(cfg.KnownShorteners),
+		maxRedirects: maxRedirects,
+	}
+}
+
+// Resolve returns the final destination of rawURL. Destinations on the
+// service's own domains are rejected, links of known shorteners are followed
+// until they leave the shortener, up to the redirect limit. Loops, hops to
+// non-public hosts and shorteners that can't be resolved are rejected with a
+// *models.ValidationError.
+func (c *RedirectChecker) Resolve(ctx context.Context, rawURL string) (string, error) {
+	current := rawURL
+	visited := make(map[string]bool)
+
+	for hops := 0; ; hops++ {
+		u, err := url.Parse(current)
+		if err != nil {
+			return "", invalid("URL redirects to an invalid URL")
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+		if matchDomain(host, c.ownDomains) {
+			if hops == 0 {
+				return "", invalid("URL points back to this service")
+			}
+			return "", invalid("URL redirects back to this service")
+		}
+		if !matchDomain(host, c.shorteners) {
+			return current, nil
+		}
+
+		if visited[current] {
+			return "", invalid("URL redirects in a loop")
+		}
+		visited[current] = true
+		if hops >= c.maxRedirects {
+			return "", invalid("URL redirects too many times")
+		}
+
+		if hops > 0 {
+			if err := models.ValidateURL(current); err != nil {
+				return "", err
+			}
+			if err := c.validator.Validate(ctx, current); err != nil {
+				return "", err
+			}
+		}
+
+		next, ok, err := c.next(ctx, u)
+		if err != nil {
+			return "", invalid("URL shortener " + host + " could not be resolved")
+		}
+		if !ok {
+			// The shortener answered without redirecting, e.g. with its
+			// own landing page
+			return current, nil
+		}
+		current = next
+	}
+}
+
+// CheckHost rejects rawURL without requesting anything if it points at one
+// of the service's own domains or at a known shortener, whose destination
+// could only be found by following it
+func (c *RedirectChecker) CheckHost(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return invalid("Invalid URL format")
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if matchDomain(host, c.ownDomains) {
+		return invalid("URL points back to this service")
+	}
+	if matchDomain(host, c.shorteners) {
+		return invalid("URL is a link of another URL shortener, use its destination instead")
+	}
+	return nil
+}
+
+// next requests u and returns the location it redirects to, if any. HEAD is
+// tried first, GET if the server doesn't support it.
+func (c *RedirectChecker) next(ctx context.Context, u *url.URL) (string, bool, error) {
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return "", false, err
+		}
+		req.Header.Set("User-Agent", "url-shortener-redirect-check/1.0")
+
+		resp, err = c.client.Do(req)
+		if err != nil {
+			return "", false, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", false, nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", false, nil
+	}
+	return location.String(), true, nil
+}
@@ -0,0 +1,114 @@
+package urlcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"url_shortener/internal/config"
+)
+
+func TestResolve(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/direct", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/landing", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/chain", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/direct", http.StatusFound)
+	})
+	mux.HandleFunc("/loop-a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-b", http.StatusFound)
+	})
+	mux.HandleFunc("/loop-b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-a", http.StatusFound)
+	})
+	mux.HandleFunc("/self", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://sho.rt/abc123", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(w, r, "https://example.com/from-get", http.StatusFound)
+	})
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("shortener home page"))
+	})
+	for i := 0; i < 10; i++ {
+		mux.HandleFunc("/deep"+string(rune('0'+i)), func(i int) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/deep"+string(rune('0'+i+1)), http.StatusFound)
+			}
+		}(i))
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	v := New(config.URLValidationConfig{AllowPrivateNetworks: true}, nil)
+	c := NewRedirectChecker(config.RedirectCheckConfig{
+		OwnDomains:      []string{"sho.rt"},
+		KnownShorteners: []string{serverURL.Hostname()},
+		MaxRedirects:    5,
+	}, server.Client(), v)
+
+	tests := []struct {
+		url   string
+		final string
+		ok    bool
+	}{
+		{"https://example.com/page", "https://example.com/page", true},
+		{server.URL + "/direct", "https://example.com/landing", true},
+		{server.URL + "/chain", "https://example.com/landing", true},
+		{server.URL + "/get-only", "https://example.com/from-get", true},
+		{server.URL + "/landing", server.URL + "/landing", true},
+		{"https://sho.rt/abc123", "", false},
+		{"https://www.sho.rt/abc123", "", false},
+		{server.URL + "/self", "", false},
+		{server.URL + "/loop-a", "", false},
+		{server.URL + "/deep0", "", false},
+	}
+
+	for _, tt := range tests {
+		final, err := c.Resolve(context.Background(), tt.url)
+		if (err == nil) != tt.ok || final != tt.final {
+			t.Errorf("Resolve(%q) = %q, %v, want %q ok=%v", tt.url, final, err, tt.final, tt.ok)
+		}
+	}
+}
+
+func TestResolveRejectsPrivateHops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	v := New(config.URLValidationConfig{}, resolver)
+	c := NewRedirectChecker(config.RedirectCheckConfig{
+		KnownShorteners: []string{serverURL.Hostname(), "169.254.169.254"},
+	}, server.Client(), v)
+
+	if _, err := c.Resolve(context.Background(), server.URL+"/x"); err == nil {
+		t.Error("redirect to a private address accepted")
+	}
+}
+
+func TestHTTPClientBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := NewHTTPClient(time.Second, false).Get(server.URL); err == nil {
+		t.Error("connection to loopback allowed")
+	}
+	resp, err := NewHTTPClient(time.Second, true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("connection with private networks allowed failed: %v", err)
+	}
+	resp.Body.Close()
+}
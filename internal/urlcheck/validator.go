@@ -0,0 +1,158 @@
+// Package urlcheck vets short URL destinations before they are stored, so the
+// service can't be used to reach hosts on its own private network.
+package urlcheck
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"url_shortener/internal/config"
+	"url_shortener/internal/models"
+)
+
+// Resolver looks up the addresses of a hostname. *net.Resolver implements it;
+// tests substitute a fixed table.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// internalSuffixes are name suffixes that only resolve on local networks
+var internalSuffixes = []string{".localhost", ".local", ".localdomain", ".internal", ".intranet", ".lan", ".home.arpa", ".corp"}
+
+// Validator checks that a destination URL points at a public host
+type Validator struct {
+	resolver       Resolver
+	resolveTimeout time.Duration
+	allowPrivate   bool
+	allowedDomains []string
+	deniedDomains  []string
+}
+
+// New creates a Validator. A nil resolver uses the system resolver.
+func New(cfg config.URLValidationConfig, resolver Resolver) *Validator {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	timeout := time.Duration(cfg.ResolveTimeoutMillis) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Validator{
+		resolver:       resolver,
+		resolveTimeout: timeout,
+		allowPrivate:   cfg.AllowPrivateNetworks,
+		allowedDomains: normalizeDomains(cfg.AllowedDomains),
+		deniedDomains:  normalizeDomains(cfg.DeniedDomains),
+	}
+}
+
+// Validate checks the host of rawURL, which must already have passed
+// models.ValidateURL. Denied domains and obfuscated IP addresses are always
+// rejected. Unless private networks are allowed, IP literals and hostnames
+// resolving into non-public ranges are rejected too; hosts on the allowed
+// domain list are trusted and not resolved.
+func (v *Validator) Validate(ctx context.Context, rawURL string) error {
+	host, resolve, err := v.checkHost(rawURL)
+	if err != nil || !resolve {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.resolveTimeout)
+	defer cancel()
+
+	addrs, err := v.resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return invalid("URL host could not be resolved")
+	}
+	for _, a := range addrs {
+		addr, ok := netip.AddrFromSlice(a.IP)
+		if !ok || IsBlockedIP(addr) {
+			return invalid("URL resolves to a private or reserved network address")
+		}
+	}
+
+	return nil
+}
+
+// ValidateStatic runs the checks of Validate that don't need DNS: the domain
+// lists, IP literals and names that only exist on local networks. Other
+// hostnames pass without being resolved.
+func (v *Validator) ValidateStatic(rawURL string) error {
+	_, _, err := v.checkHost(rawURL)
+	return err
+}
+
+// checkHost runs the checks of Validate on the host of rawURL that don't need
+// DNS. It returns the host and whether it still has to be resolved.
+func (v *Validator) checkHost(rawURL string) (string, bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, invalid("Invalid URL format")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", false, invalid("URL must contain a valid host")
+	}
+
+	if matchDomain(host, v.deniedDomains) {
+		return "", false, invalid("URL host is not allowed")
+	}
+
+	if addr, isIP, canonical := parseIPLiteral(host); isIP {
+		if !canonical {
+			return "", false, invalid("URL host is an obfuscated or malformed IP address")
+		}
+		if !v.allowPrivate && IsBlockedIP(addr) {
+			return "", false, invalid("URL points to a private or reserved network address")
+		}
+		return host, false, nil
+	}
+
+	if v.allowPrivate || matchDomain(host, v.allowedDomains) {
+		return host, false, nil
+	}
+
+	if !strings.Contains(host, ".") || host == "localhost" || hasInternalSuffix(host) {
+		return "", false, invalid("URL host is not publicly reachable")
+	}
+	return host, true, nil
+}
+
+func invalid(message string) error {
+	return &models.ValidationError{Field: "url", Message: message}
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d != "" {
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
+
+// matchDomain reports whether host is one of domains or a subdomain of one
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasInternalSuffix(host string) bool {
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
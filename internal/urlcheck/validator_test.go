@@ -0,0 +1,167 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"url_shortener/internal/config"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return addrs, nil
+}
+
+var resolver = fakeResolver{
+	"example.com":          {"93.184.216.34"},
+	"www.example.com":      {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+	"internal.example.com": {"10.0.0.5"},
+	"rebind.example.com":   {"93.184.216.34", "127.0.0.1"},
+	"metadata.example.com": {"169.254.169.254"},
+	"cgnat.example.com":    {"100.64.1.1"},
+	"v6local.example.com":  {"fd00::1"},
+	"mapped.example.com":   {"::ffff:192.168.1.1"},
+	"nat64.example.com":    {"64:ff9b::7f00:1"},
+}
+
+func TestValidate(t *testing.T) {
+	v := New(config.URLValidationConfig{
+		AllowedDomains: []string{"intranet.example.org"},
+		DeniedDomains:  []string{"evil.example.com"},
+	}, resolver)
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/path", true},
+		{"http://www.example.com", true},
+		{"https://EXAMPLE.com./", true},
+		{"http://93.184.216.34/", true},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]/", true},
+
+		{"http://127.0.0.1/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://10.1.2.3:8080/", false},
+		{"http://192.168.0.1/", false},
+		{"http://100.64.0.1/", false},
+		{"http://0.0.0.0/", false},
+		{"http://[::1]/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://[fe80::1%25eth0]/", false},
+
+		// Obfuscated forms are rejected even for public addresses
+		{"http://2130706433/", false},
+		{"http://0x7f000001/", false},
+		{"http://0177.0.0.1/", false},
+		{"http://0x7f.0.0.1/", false},
+		{"http://127.1/", false},
+		{"http://1572395042/", false},
+		{"http://256.1.1.1/", false},
+
+		{"http://localhost/", false},
+		{"http://intranet/", false},
+		{"http://db.internal/", false},
+		{"http://printer.local/", false},
+		{"http://internal.example.com/", false},
+		{"http://rebind.example.com/", false},
+		{"http://metadata.example.com/", false},
+		{"http://cgnat.example.com/", false},
+		{"http://v6local.example.com/", false},
+		{"http://mapped.example.com/", false},
+		{"http://nat64.example.com/", false},
+		{"http://unknown.example.com/", false},
+
+		{"http://evil.example.com/", false},
+		{"http://www.evil.example.com/", false},
+		{"http://wiki.intranet.example.org/", true},
+	}
+
+	for _, tt := range tests {
+		err := v.Validate(context.Background(), tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("Validate(%q) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateAllowPrivate(t *testing.T) {
+	v := New(config.URLValidationConfig{AllowPrivateNetworks: true}, resolver)
+
+	for _, u := range []string{"http://localhost:3000/", "http://10.0.0.5/", "http://internal.example.com/"} {
+		if err := v.Validate(context.Background(), u); err != nil {
+			t.Errorf("Validate(%q) = %v, want nil", u, err)
+		}
+	}
+	if err := v.Validate(context.Background(), "http://0x7f000001/"); err == nil {
+		t.Error("obfuscated IP accepted with private networks allowed")
+	}
+}
+
+func TestValidateStatic(t *testing.T) {
+	v := New(config.URLValidationConfig{DeniedDomains: []string{"evil.example.com"}}, fakeResolver{})
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		// Hostnames aren't resolved
+		{"https://unknown.example.com/", true},
+		{"http://93.184.216.34/", true},
+
+		{"http://10.1.2.3/", false},
+		{"http://0x7f000001/", false},
+		{"http://localhost/", false},
+		{"http://db.internal/", false},
+		{"http://www.evil.example.com/", false},
+	}
+
+	for _, tt := range tests {
+		err := v.ValidateStatic(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateStatic(%q) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestParseIPLiteral(t *testing.T) {
+	tests := []struct {
+		host      string
+		want      string
+		isIP      bool
+		canonical bool
+	}{
+		{"1.2.3.4", "1.2.3.4", true, true},
+		{"2130706433", "127.0.0.1", true, false},
+		{"0x7f000001", "127.0.0.1", true, false},
+		{"017700000001", "127.0.0.1", true, false},
+		{"0177.0.0.01", "127.0.0.1", true, false},
+		{"127.1", "127.0.0.1", true, false},
+		{"169.254.43518", "169.254.169.254", true, false},
+		{"example.com", "", false, false},
+		{"0xcafe.com", "", false, false},
+		{"1.2.3.4.5", "", false, false},
+	}
+
+	for _, tt := range tests {
+		addr, isIP, canonical := parseIPLiteral(tt.host)
+		if isIP != tt.isIP || canonical != tt.canonical {
+			t.Errorf("parseIPLiteral(%q) isIP=%v canonical=%v, want %v %v", tt.host, isIP, canonical, tt.isIP, tt.canonical)
+			continue
+		}
+		if tt.want != "" && addr.String() != tt.want {
+			t.Errorf("parseIPLiteral(%q) = %s, want %s", tt.host, addr, tt.want)
+		}
+	}
+}
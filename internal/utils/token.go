@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// DefaultTokenBytes is the amount of randomness used for opaque tokens
+const DefaultTokenBytes = 32
+
+// GenerateSecureToken returns a URL-safe random token built from numBytes
+// bytes of cryptographically secure randomness
+func GenerateSecureToken(numBytes int) (string, error) {
+	if numBytes <= 0 {
+		numBytes = DefaultTokenBytes
+	}
+
+	b := make([]byte, numBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of token. Only the hash of
+// single-use tokens is persisted so a database leak doesn't expose them.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
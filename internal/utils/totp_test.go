@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := TOTPCode(secret, TOTPStep(now.Add(-TOTPPeriod)))
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, now, 1)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Errorf("ValidateTOTP() = %v, %v, want previous step accepted", step, ok)
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now, 0); ok {
+		t.Error("ValidateTOTP() accepted a code outside the allowed skew")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now, 1); ok {
+		t.Error("ValidateTOTP() accepted a code with the wrong length")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("URL Shortener", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/URL%20Shortener:alice@example.com?") {
+		t.Errorf("TOTPURI() = %v, unexpected label", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=URL+Shortener") {
+		t.Errorf("TOTPURI() = %v, missing parameters", uri)
+	}
+}
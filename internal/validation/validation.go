@@ -0,0 +1,266 @@
+// Package validation checks structs against their `validate` field tags.
+//
+// A tag is a comma separated list of rules, e.g. `validate:"required,max=255"`.
+// The built-in rules are:
+//
+//	required   the value must not be the zero value (nil for pointers)
+//	omitempty  skip the remaining rules when the value is the zero value
+//	min=N      minimum length of strings (in characters) and slices, or value of numbers
+//	max=N      maximum length of strings and slices, or value of numbers
+//	oneof=a b  the value must be one of the space separated values
+//	dive       validate the elements of a slice
+//	email      a single email address
+//	slug       only ASCII letters, digits, '-' and '_'
+//	url        a destination URL accepted by models.ValidateURL
+//
+// Further rules can be added with Register. Nested structs and pointers to
+// structs are validated as well, slices of structs only with the dive rule.
+// Their errors are reported as "parent.field" and "items[0].field".
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"url_shortener/internal/models"
+)
+
+// Rule checks a field value against a rule with an optional parameter. It
+// returns a message describing the problem, or "" if the value is valid.
+// Rules are only called for non-nil values; pointers are dereferenced.
+type Rule func(v reflect.Value, param string) string
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]Rule{
+		"min":   minRule,
+		"max":   maxRule,
+		"oneof": oneOfRule,
+		"email": emailRule,
+		"slug":  slugRule,
+		"url":   urlRule,
+	}
+)
+
+// Register adds or replaces a rule
+func Register(name string, rule Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = rule
+}
+
+// Struct validates s, a struct or a pointer to one, and returns all errors
+// in field order. Field names are taken from the json tags.
+func Struct(s interface{}) []*models.ValidationError {
+	var errs []*models.ValidationError
+	validateStruct(reflect.ValueOf(s), "", &errs)
+	return errs
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *[]*models.ValidationError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		tag := field.Tag.Get("validate")
+		if msg := validateField(fv, tag); msg != "" {
+			*errs = append(*errs, &models.ValidationError{Field: prefix + name, Message: msg})
+			continue
+		}
+		validateNested(fv, prefix+name, hasRule(tag, "dive"), errs)
+	}
+}
+
+// validateNested descends into struct values, and into slices when dive is set
+func validateNested(v reflect.Value, path string, dive bool, errs *[]*models.ValidationError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		validateStruct(v, path+".", errs)
+	case reflect.Slice, reflect.Array:
+		if !dive {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateNested(v.Index(i), path+"["+strconv.Itoa(i)+"]", false, errs)
+		}
+	}
+}
+
+// validateField applies the rules of a tag and returns the first failure
+func validateField(v reflect.Value, tag string) string {
+	if tag == "" {
+		return ""
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			continue
+		case "required":
+			if v.IsZero() {
+				return "is required"
+			}
+			continue
+		case "omitempty":
+			if v.IsZero() {
+				return ""
+			}
+			continue
+		}
+
+		// The remaining rules apply to the value a pointer points to
+		value := v
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return ""
+			}
+			value = value.Elem()
+		}
+
+		mu.RLock()
+		check, ok := rules[name]
+		mu.RUnlock()
+		if !ok {
+			panic("validation: unknown rule " + name)
+		}
+		if msg := check(value, param); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func minRule(v reflect.Value, param string) string {
+	return compare(v, param, func(n, limit float64) bool { return n >= limit }, "at least")
+}
+
+func maxRule(v reflect.Value, param string) string {
+	return compare(v, param, func(n, limit float64) bool { return n <= limit }, "at most")
+}
+
+// compare checks the length of strings and slices or the value of numbers
+// against the limit in param
+func compare(v reflect.Value, param string, ok func(n, limit float64) bool, bound string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validation: invalid limit " + param)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if !ok(float64(utf8.RuneCountInString(v.String())), limit) {
+			return fmt.Sprintf("must be %s %s characters", bound, param)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if !ok(float64(v.Len()), limit) {
+			return fmt.Sprintf("must contain %s %s items", bound, param)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !ok(float64(v.Int()), limit) {
+			return fmt.Sprintf("must be %s %s", bound, param)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !ok(float64(v.Uint()), limit) {
+			return fmt.Sprintf("must be %s %s", bound, param)
+		}
+	case reflect.Float32, reflect.Float64:
+		if !ok(v.Float(), limit) {
+			return fmt.Sprintf("must be %s %s", bound, param)
+		}
+	}
+	return ""
+}
+
+func oneOfRule(v reflect.Value, param string) string {
+	allowed := strings.Fields(param)
+	value := fmt.Sprint(v.Interface())
+	for _, a := range allowed {
+		if value == a {
+			return ""
+		}
+	}
+
+	if len(allowed) == 1 {
+		return "must be " + allowed[0]
+	}
+	return "must be one of " + strings.Join(allowed[:len(allowed)-1], ", ") + " or " + allowed[len(allowed)-1]
+}
+
+func emailRule(v reflect.Value, _ string) string {
+	s := v.String()
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "Invalid email address"
+	}
+	return ""
+}
+
+// urlRule accepts the same destinations as models.ValidateURL. Leading and
+// trailing whitespace is ignored since destinations are trimmed when they
+// are sanitized.
+func urlRule(v reflect.Value, _ string) string {
+	if err := models.ValidateURL(strings.TrimSpace(v.String())); err != nil {
+		if validationErr, ok := err.(*models.ValidationError); ok {
+			return validationErr.Message
+		}
+		return "Invalid URL"
+	}
+	return ""
+}
+
+func slugRule(v reflect.Value, _ string) string {
+	for _, c := range v.String() {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return "may only contain letters, digits, '-' and '_'"
+		}
+	}
+	return ""
+}
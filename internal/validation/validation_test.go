@@ -0,0 +1,95 @@
+package validation
+
+import (
+	"reflect"
+	"testing"
+
+	"url_shortener/internal/models"
+)
+
+type item struct {
+	URL string `json:"url" validate:"required,url"`
+}
+
+type request struct {
+	Name     string   `json:"name" validate:"required,min=3,max=5"`
+	Email    string   `json:"email,omitempty" validate:"omitempty,email"`
+	Role     string   `json:"role" validate:"oneof=owner editor viewer"`
+	Count    int      `json:"count" validate:"min=1,max=10"`
+	Enabled  *bool    `json:"enabled" validate:"required"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Items    []item   `json:"items" validate:"dive"`
+	Skipped  []item   `json:"skipped"`
+	Ignored  string   `json:"-" validate:"required"`
+	internal string
+}
+
+func errorMap(errs []*models.ValidationError) map[string]string {
+	m := make(map[string]string)
+	for _, err := range errs {
+		m[err.Field] = err.Message
+	}
+	return m
+}
+
+func TestStruct(t *testing.T) {
+	enabled := false
+
+	valid := request{Name: "abc", Role: "viewer", Count: 1, Enabled: &enabled, Items: []item{{URL: "https://example.com"}}}
+	if errs := Struct(&valid); len(errs) != 0 {
+		t.Fatalf("valid request: got errors %v", errorMap(errs))
+	}
+
+	invalid := request{
+		Name:    "ab",
+		Email:   "not an email",
+		Role:    "admin",
+		Count:   11,
+		Tags:    []string{"a", "b", "c"},
+		Items:   []item{{URL: "https://example.com"}, {URL: "ftp://example.com"}, {}},
+		Skipped: []item{{}},
+	}
+	got := errorMap(Struct(invalid))
+	want := map[string]string{
+		"name":         "must be at least 3 characters",
+		"email":        "Invalid email address",
+		"role":         "must be one of owner, editor or viewer",
+		"count":        "must be at most 10",
+		"enabled":      "is required",
+		"tags":         "must contain at most 2 items",
+		"items[1].url": "URL must use HTTP or HTTPS scheme",
+		"items[2].url": "is required",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestStructCountsCharacters(t *testing.T) {
+	enabled := true
+	r := request{Name: "äöüßé", Role: "owner", Count: 1, Enabled: &enabled}
+	if errs := Struct(r); len(errs) != 0 {
+		t.Errorf("got errors %v", errorMap(errs))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("even", func(v reflect.Value, _ string) string {
+		if v.Int()%2 != 0 {
+			return "must be even"
+		}
+		return ""
+	})
+
+	type evenRequest struct {
+		N *int `json:"n" validate:"omitempty,even"`
+	}
+	odd := 3
+	got := errorMap(Struct(evenRequest{N: &odd}))
+	if got["n"] != "must be even" {
+		t.Errorf("got %v", got)
+	}
+	if errs := Struct(evenRequest{}); len(errs) != 0 {
+		t.Errorf("nil pointer: got %v", errorMap(errs))
+	}
+}